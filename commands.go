@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/crawler"
+	"github.com/BitcoinSchema/go-bap-indexer/database"
+	"github.com/BitcoinSchema/go-bap-indexer/server"
+	"github.com/BitcoinSchema/go-bap-indexer/snapshot"
+	"github.com/BitcoinSchema/go-bap-indexer/state"
+	"github.com/b-open-io/go-junglebus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// command is a subcommand of the indexer binary
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "run", "Serve the API and crawl (default)", func(ctx context.Context, args []string) error {
+			parseFlags("run", args)
+			return runIndexer(ctx, true, true)
+		}},
+		{"serve", "serve", "Serve the API only", func(ctx context.Context, args []string) error {
+			parseFlags("serve", args)
+			return runIndexer(ctx, true, false)
+		}},
+		{"index", "index", "Crawl only, INGEST_MODE selects dump or ingest", func(ctx context.Context, args []string) error {
+			parseFlags("index", args)
+			return runIndexer(ctx, false, true)
+		}},
+		{"rewind", "rewind --to <height>", "Roll the index and _state back to a block", rewindCommand},
+		{"reindex", "reindex --from <height> [--to <height>]", "Rewind and crawl a block range again", reindexCommand},
+		{"inspect-tx", "inspect-tx [--block <height>] [--time <unix>] <hex|file>", "Dry run: show the BAP ops of a tx and the mutations indexing it would make", inspectTxCommand},
+		{"stats", "stats", "Show indexed height, chain tip and collection counts", statsCommand},
+		{"export", "export [-o <file>]", "Write a snapshot of the index", exportCommand},
+		{"import", "import [-force] <file>", "Verify and load a snapshot", importCommand},
+		{"help", "help", "Show this help", func(ctx context.Context, args []string) error {
+			usage()
+			return nil
+		}},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", c.usage, c.summary)
+	}
+	w.Flush()
+}
+
+// parseFlags parses commands without flags of their own, so -h works
+func parseFlags(name string, args []string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Parse(args)
+	return flags
+}
+
+// runIndexer serves the API and/or crawls until ctx is cancelled
+func runIndexer(ctx context.Context, serve bool, index bool) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var wg sync.WaitGroup
+	if serve {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Start(ctx); err != nil {
+				log.Printf("[ERROR]: API server: %v", err)
+				stop()
+			}
+		}()
+	}
+
+	if index {
+		crawl(ctx)
+	} else {
+		<-ctx.Done()
+	}
+
+	// the crawl can also end on its own (e.g. failed subscription)
+	stop()
+	wg.Wait()
+	return nil
+}
+
+// crawl indexes until ctx is cancelled. INGEST_MODE splits indexing in two
+// processes: "dump" crawls and writes block files, "ingest" loads them.
+func crawl(ctx context.Context) {
+	// the crawler looks identities up by address, don't wait for the API to
+	// create the indexes
+	if err := database.GetConnection().EnsureIndexes(ctx); err != nil {
+		log.Printf("[ERROR]: %v", err)
+	}
+	currentBlock := state.LoadProgress()
+
+	crawler.CONCURRENT_INSERTS = config.PositiveInt("CONCURRENT_INSERTS", crawler.CONCURRENT_INSERTS)
+
+	switch os.Getenv("INGEST_MODE") {
+	case "ingest":
+		// blocks until shutdown, after the file being ingested is done
+		crawler.IngestFiles(ctx)
+	case "dump":
+		crawler.DumpToFiles = true
+		if err := crawler.WaitForIngest(ctx); err != nil {
+			log.Printf("[ERROR]: waiting for ingest: %v", err)
+			return
+		}
+		crawler.SyncBlocks(ctx, int(state.LoadProgress()))
+	default:
+		// blocks until shutdown, after buffered events are applied and progress saved
+		crawler.SyncBlocks(ctx, int(currentBlock))
+	}
+}
+
+func rewindCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("rewind", flag.ExitOnError)
+	to := flags.Int64("to", -1, "block height to roll back to")
+	flags.Parse(args)
+	if *to < 0 {
+		return fmt.Errorf("usage: rewind --to <height>")
+	}
+
+	res, err := crawler.Rewind(ctx, uint32(*to))
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+func reindexCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	from := flags.Uint("from", 0, "first block to index again")
+	to := flags.Uint("to", 0, "last block to index again, crawl on when unset")
+	flags.Parse(args)
+	if *from == 0 {
+		return fmt.Errorf("usage: reindex --from <height> [--to <height>]")
+	}
+
+	res, err := crawler.Reindex(ctx, uint32(*from), uint32(*to))
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+func inspectTxCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("inspect-tx", flag.ExitOnError)
+	block := flags.Uint("block", 0, "block height the tx was mined in")
+	blockTime := flags.Uint("time", 0, "block time the tx was mined at")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: inspect-tx [--block <height>] [--time <unix>] <hex|file>")
+	}
+
+	rawtx, err := readTx(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	sim, err := crawler.SimulateRawTx(rawtx, uint32(*block), uint32(*blockTime))
+	if err != nil {
+		return err
+	}
+	return printJSON(sim)
+}
+
+// readTx reads a raw tx given as hex or as a file holding hex or binary.
+// Hex is tried first, a raw tx is too long to be a file name.
+func readTx(arg string) ([]byte, error) {
+	if raw, err := hex.DecodeString(strings.TrimSpace(arg)); err == nil {
+		return raw, nil
+	}
+
+	data, err := os.ReadFile(arg)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is neither hex nor a file", arg)
+	} else if err != nil {
+		return nil, err
+	}
+	if raw, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		return raw, nil
+	}
+	return data, nil
+}
+
+func statsCommand(ctx context.Context, args []string) error {
+	parseFlags("stats", args)
+
+	height, err := state.ReadProgress()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "indexed height\t%d\n", height)
+
+	if jb, err := junglebus.New(junglebus.WithHTTP(config.JunglebusEndpoint)); err != nil {
+		fmt.Fprintf(w, "chain tip\tunknown (%v)\n", err)
+	} else if tip, err := jb.GetChainTip(ctx); err != nil {
+		fmt.Fprintf(w, "chain tip\tunknown (%v)\n", err)
+	} else {
+		fmt.Fprintf(w, "chain tip\t%d (%d behind)\n", tip.Height, int64(tip.Height)-int64(height))
+	}
+
+	conn := database.GetConnection()
+	for _, name := range []string{"id", "attest", "profile", config.BlobCollection, config.QuarantineCollection} {
+		count, err := conn.CountCollectionDocs(name, bson.M{})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\n", name, count)
+	}
+	return nil
+}
+
+func exportCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("o", "snapshot.tar.gz", "snapshot file to write")
+	flags.Parse(args)
+
+	manifest, err := snapshot.Export(ctx, *out)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported snapshot at block %d (%s) to %s", manifest.Height, manifest.BlockHash, *out)
+	for name, cm := range manifest.Collections {
+		log.Printf("  %s: %d documents", name, cm.Documents)
+	}
+	return nil
+}
+
+func importCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	force := flags.Bool("force", false, "drop existing collections before loading")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-force] <snapshot file>")
+	}
+
+	manifest, err := snapshot.Import(ctx, flags.Arg(0), *force)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported snapshot at block %d, crawling will resume from there", manifest.Height)
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadTx(t *testing.T) {
+	b, err := os.ReadFile("crawler/testdata/98a5f6ef18eaea188bdfdc048f89a48af82627a15a76fd53584975f28ab3cc39.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txHex := strings.TrimSpace(string(b))
+	raw, err := hex.DecodeString(txHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	hexFile := filepath.Join(dir, "tx.hex")
+	rawFile := filepath.Join(dir, "tx.bin")
+	if err := os.WriteFile(hexFile, []byte(txHex+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rawFile, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		arg  string
+		err  bool
+	}{
+		// longer than a file name may be
+		{name: "hex", arg: txHex},
+		{name: "hex with whitespace", arg: " " + txHex + "\n"},
+		{name: "hex file", arg: hexFile},
+		{name: "binary file", arg: rawFile},
+		{name: "missing file", arg: filepath.Join(dir, "missing"), err: true},
+		{name: "neither", arg: "not a tx", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readTx(tt.arg)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %x, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, raw) {
+				t.Errorf("got %d bytes, want the %d of the tx", len(got), len(raw))
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // There are config constants
 const (
 	SkipSPV        = true
@@ -11,3 +13,75 @@ const (
 	BockSyncRetries   = 5      // number of retries before block is marked failed
 	DeleteAfterIngest = true   // delete json data files after ingesting to db
 )
+
+// Error handling settings used by ProcessTx
+const (
+	TransientRetries     = 10                     // attempts for an op hitting transient db errors before it is quarantined
+	RetryMinDelay        = 100 * time.Millisecond // first backoff delay
+	RetryMaxDelay        = 30 * time.Second       // backoff cap
+	QuarantineCollection = "quarantine"           // malformed and unresolvable ops end up here
+	QuarantineMaxRawTx   = 4 << 20                // raw txs larger than this are quarantined without their bytes
+)
+
+// Pending op settings. Ops whose signer has no identity yet wait for the ID
+// in a bounded buffer instead of being quarantined right away.
+const (
+	PendingOpsLimit  = 10000 // ops held at once, further ones are quarantined
+	PendingOpsExpiry = 6     // blocks an op waits for its identity before it is quarantined, overridden by PENDING_OPS_EXPIRY
+)
+
+// Identity settings
+const (
+	ConflictingIdentitiesValid = true // whether identities with conflicting claims pass validity checks, overridden by CONFLICTING_IDENTITIES_VALID
+)
+
+// Trust graph settings used by the /v1/identity/:idKey/trust endpoint
+const (
+	TrustDamping        = 0.85            // personalized PageRank damping, overridden by the damping query param
+	TrustIterations     = 50              // PageRank iterations at most
+	TrustTolerance      = 1e-9            // PageRank stops once scores move less than this in total
+	TrustDecay          = 0.5             // path score kept per attestation hop, overridden by the decay query param
+	TrustMaxDepth       = 6               // longest attestation path searched
+	TrustReloadInterval = 5 * time.Minute // how often the graph is reloaded when change streams are unavailable
+)
+
+// Profile settings
+const (
+	ProfileStrict              = false    // quarantine ALIAS profiles that don't fit schema.org Person/Organization instead of storing them with warnings, overridden by PROFILE_STRICT
+	ProfileMaxBytes            = 1 << 20  // ALIAS profiles larger than this are quarantined, overridden by PROFILE_MAX_BYTES
+	ProfileInlineMediaMaxBytes = 16 << 10 // data urls longer than this are moved to BlobCollection and referenced as blob://<sha256>, overridden by PROFILE_INLINE_MEDIA_MAX_BYTES
+	BlobCollection             = "blob"   // media extracted from profiles, by sha256
+	AttestationHashMaxLength   = 128      // ATTEST and REVOKE ops with longer hashes are quarantined
+)
+
+// Offline ingest settings, see INGEST_MODE
+const (
+	DataDir          = "data"           // block files written in dump mode and read in ingest mode
+	RejectedDir      = "data/rejected"  // lines that failed validation, per block
+	IngestRescan     = 30 * time.Second // how often the ingester rescans DataDir for files it missed
+	DumpWaitInterval = 5 * time.Second  // how often the dumper checks whether pending files were ingested
+)
+
+// Pipeline settings
+const (
+	ProcessWorkers = 0     // goroutines decoding and validating txs, 0 uses one per CPU
+	PipelineDepth  = 10000 // events in flight between the listener and the ordered commit
+)
+
+// Health settings
+const (
+	ReadyMaxLag = 6 // /readyz fails when the index is more than this many blocks behind the tip, overridden by READY_MAX_LAG
+)
+
+// Image proxy settings used by the /v1/person/:field/:bapId endpoint
+const (
+	ContentGateway      = "https://ordfs.network" // fallback for on-chain content, overridden by CONTENT_GATEWAY
+	RawTxDir            = "data/tx"               // archive of raw txs (<txid> files) to extract content from
+	ImageCacheDir       = "cache/images"          // on-disk, content addressed image cache
+	ImageCacheTTL       = 24 * time.Hour          // how long a fetched image is served from cache
+	ImageCacheMaxBytes  = 512 << 20               // evict least recently used images above this size
+	ImageFetchTimeout   = 10 * time.Second        // upstream request timeout
+	ImageFetchMaxBytes  = 10 << 20                // largest upstream image we will download
+	ImageMaxDimension   = 2048                    // largest width or height accepted for resizing
+	ImageDefaultQuality = 85                      // jpeg quality used when re-encoding
+)
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// Settings documented as "overridden by NAME" read NAME through these. An
+// unset or unparsable variable leaves the default.
+
+// Int returns the non-negative integer in env var name, or def
+func Int(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
+
+// PositiveInt returns the integer in env var name if it is above zero, or def
+func PositiveInt(name string, def int) int {
+	if v := Int(name, def); v > 0 {
+		return v
+	}
+	return def
+}
+
+// Bool returns the boolean in env var name, or def
+func Bool(name string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// String returns env var name, or def when it is empty
+func String(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,37 @@
+package config
+
+import "testing"
+
+func TestEnv(t *testing.T) {
+	const name = "BAP_CONFIG_TEST"
+	tests := []struct {
+		value       string
+		int         int
+		positiveInt int
+		bool        bool
+		string      string
+	}{
+		{"", 5, 5, true, "default"},
+		{"7", 7, 7, true, "7"},
+		{"0", 0, 5, false, "0"},
+		{"-1", 5, 5, true, "-1"},
+		{"false", 5, 5, false, "false"},
+		{"1", 1, 1, true, "1"},
+		{"x", 5, 5, true, "x"},
+	}
+	for _, tt := range tests {
+		t.Setenv(name, tt.value)
+		if got := Int(name, 5); got != tt.int {
+			t.Errorf("Int(%q) = %d, want %d", tt.value, got, tt.int)
+		}
+		if got := PositiveInt(name, 5); got != tt.positiveInt {
+			t.Errorf("PositiveInt(%q) = %d, want %d", tt.value, got, tt.positiveInt)
+		}
+		if got := Bool(name, true); got != tt.bool {
+			t.Errorf("Bool(%q) = %v, want %v", tt.value, got, tt.bool)
+		}
+		if got := String(name, "default"); got != tt.string {
+			t.Errorf("String(%q) = %q, want %q", tt.value, got, tt.string)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package crawler
+
+import (
+	"context"
+	"slices"
+
+	"github.com/BitcoinSchema/go-bap-indexer/database"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// batch stages the writes of a block. Lookups see the staged state before
+// the database, and flush writes everything with one ordered BulkWrite per
+// collection.
+//
+// Every staged write is idempotent ($set, $addToSet, $pull, upserts with
+// $setOnInsert) so a flush can be retried, or a block replayed, when the
+// server doesn't support transactions.
+type batch struct {
+	// ids holds every identity read or written in this batch, by idKey, nil
+	// when known not to exist
+	ids map[string]*types.Identity
+	// byAddress maps the current address of identities in ids to their idKey
+	byAddress map[string]string
+	// attests holds attestations read or written in this batch, nil when
+	// known not to exist
+	attests map[string]*types.Attestation
+	// profiles holds the profile fields read or written in this batch, by
+	// idKey, nil when known not to exist
+	profiles map[string]bson.M
+	// blobs holds the blobs written in this batch, by hash
+	blobs map[string]*types.Blob
+	// dumped holds the block file height each carried document was last
+	// dumped to, by collection and _id, see carry
+	dumped map[string]map[string]uint32
+
+	writes map[string][]mongo.WriteModel
+	// order of collections by first write
+	order []string
+	// touched lists the _id of every document written, by collection
+	touched map[string][]string
+}
+
+func newBatch() *batch {
+	return &batch{
+		ids:       map[string]*types.Identity{},
+		byAddress: map[string]string{},
+		attests:   map[string]*types.Attestation{},
+		profiles:  map[string]bson.M{},
+		blobs:     map[string]*types.Blob{},
+		dumped:    map[string]map[string]uint32{},
+		writes:    map[string][]mongo.WriteModel{},
+		touched:   map[string][]string{},
+	}
+}
+
+// carry returns an empty batch that keeps b's view of the documents the
+// database doesn't have yet. Used when dumping to files, where the database
+// lags behind what has been dumped. b has just been dumped to the file for
+// height; documents last dumped at or below ingested are in the database,
+// so they are dropped and read back when needed. Blobs are dropped once
+// dumped, nothing reads them back.
+func (b *batch) carry(height uint32, ingested uint32) *batch {
+	for _, name := range []string{"id", "attest", "profile"} {
+		for _, id := range b.touched[name] {
+			if b.dumped[name] == nil {
+				b.dumped[name] = map[string]uint32{}
+			}
+			b.dumped[name][id] = height
+		}
+	}
+
+	next := newBatch()
+	for name, heights := range b.dumped {
+		for id, dumpedAt := range heights {
+			if dumpedAt <= ingested {
+				continue
+			}
+			if next.dumped[name] == nil {
+				next.dumped[name] = map[string]uint32{}
+			}
+			next.dumped[name][id] = dumpedAt
+			switch name {
+			case "id":
+				if identity := b.ids[id]; identity != nil {
+					next.cacheIdentity(identity)
+				}
+			case "attest":
+				next.attests[id] = b.attests[id]
+			case "profile":
+				next.profiles[id] = b.profiles[id]
+			}
+		}
+	}
+	return next
+}
+
+// stage queues a write to the document with _id in collection name
+func (b *batch) stage(name string, id string, model mongo.WriteModel) {
+	if _, ok := b.writes[name]; !ok {
+		b.order = append(b.order, name)
+	}
+	b.writes[name] = append(b.writes[name], model)
+	if !slices.Contains(b.touched[name], id) {
+		b.touched[name] = append(b.touched[name], id)
+	}
+}
+
+func (b *batch) empty() bool {
+	return len(b.order) == 0
+}
+
+func (b *batch) cacheIdentity(id *types.Identity) {
+	b.ids[id.IDKey] = id
+	b.byAddress[id.CurrentAddress] = id.IDKey
+}
+
+// identityByAddress returns the identity whose current address is address,
+// or nil when there is none
+func (b *batch) identityByAddress(address string) (*types.Identity, error) {
+	if idKey, ok := b.byAddress[address]; ok {
+		return b.ids[idKey], nil
+	}
+
+	id := &types.Identity{}
+	err := withRetry(func() error {
+		return collection("id").FindOne(ctx, bson.M{"currentAddress": address}).Decode(id)
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, staged := b.ids[id.IDKey]; staged {
+		// the identity moved off address earlier in this batch
+		return nil, nil
+	}
+	b.cacheIdentity(id)
+	return id, nil
+}
+
+// identityClaimedBy returns an identity whose root address is address or
+// that rotated through it, or nil when there is none
+func (b *batch) identityClaimedBy(address string) (*types.Identity, error) {
+	for _, id := range b.ids {
+		if id != nil && claimedBy(id, address) {
+			return id, nil
+		}
+	}
+
+	id := &types.Identity{}
+	err := withRetry(func() error {
+		return collection("id").FindOne(ctx, bson.M{"$or": bson.A{
+			bson.M{"rootAddress": address},
+			bson.M{"addresses.address": address},
+		}}).Decode(id)
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if staged := b.ids[id.IDKey]; staged != nil {
+		// staged rotations may have moved it on, but history only grows
+		return staged, nil
+	}
+	b.cacheIdentity(id)
+	return id, nil
+}
+
+// identity returns the identity with idKey, or nil when there is none
+func (b *batch) identity(idKey string) (*types.Identity, error) {
+	if id, ok := b.ids[idKey]; ok {
+		return id, nil
+	}
+
+	id := &types.Identity{}
+	err := withRetry(func() error {
+		return collection("id").FindOne(ctx, bson.M{"_id": idKey}).Decode(id)
+	})
+	if err == mongo.ErrNoDocuments {
+		b.ids[idKey] = nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	b.cacheIdentity(id)
+	return id, nil
+}
+
+// attestation returns the attestation with urnHash, or nil when there is none
+func (b *batch) attestation(urnHash string) (*types.Attestation, error) {
+	if att, ok := b.attests[urnHash]; ok {
+		return att, nil
+	}
+
+	att := &types.Attestation{}
+	err := withRetry(func() error {
+		return collection("attest").FindOne(ctx, bson.M{"_id": urnHash}).Decode(att)
+	})
+	if err == mongo.ErrNoDocuments {
+		att = nil
+	} else if err != nil {
+		return nil, err
+	}
+	b.attests[urnHash] = att
+	return att, nil
+}
+
+// profile returns the profile fields of idKey, or nil when it has none
+func (b *batch) profile(idKey string) (bson.M, error) {
+	if fields, ok := b.profiles[idKey]; ok {
+		return fields, nil
+	}
+
+	fields := bson.M{}
+	err := withRetry(func() error {
+		return collection("profile").FindOne(ctx, bson.M{"_id": idKey}, options.FindOne().SetProjection(bson.M{"_id": 0})).Decode(&fields)
+	})
+	if err == mongo.ErrNoDocuments {
+		fields = nil
+	} else if err != nil {
+		return nil, err
+	}
+	b.profiles[idKey] = fields
+	return fields, nil
+}
+
+// flush writes the staged block. When height is set the _state height is
+// updated in the same transaction.
+func (b *batch) flush(height uint32) error {
+	if height > 0 {
+		b.stage("_state", "_state", mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": "_state"}).
+			SetUpdate(bson.M{"$set": bson.M{"height": height}}).
+			SetUpsert(true))
+	}
+	if b.empty() {
+		return nil
+	}
+
+	conn := database.GetConnection()
+	return withRetry(func() error {
+		return conn.Atomically(ctx, func(ctx context.Context) error {
+			for _, name := range b.order {
+				if _, err := collection(name).BulkWrite(ctx, b.writes[name], options.BulkWrite().SetOrdered(true)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// written drops the writes of b once they are flushed, keeping its view of
+// the state
+func (b *batch) written() {
+	b.writes, b.order, b.touched = map[string][]mongo.WriteModel{}, nil, map[string][]string{}
+}
+
+func collection(name string) *mongo.Collection {
+	return database.GetConnection().Database("bap").Collection(name)
+}
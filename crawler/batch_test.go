@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCarryDropsIngested(t *testing.T) {
+	first := &types.Identity{IDKey: "first", RootAddress: "1First", CurrentAddress: "1First"}
+	second := &types.Identity{IDKey: "second", RootAddress: "1Second", CurrentAddress: "1Second"}
+	write := mongo.NewUpdateOneModel()
+
+	// dumped to block 100 while the ingester is at 90
+	bt := newBatch()
+	bt.cacheIdentity(first)
+	bt.stage("id", first.IDKey, write)
+	bt.attests[testHash] = &types.Attestation{Id: testHash}
+	bt.stage("attest", testHash, write)
+	bt.attests["read"] = nil
+	bt.profiles[first.IDKey] = map[string]interface{}{"signer": first.CurrentAddress}
+	bt.stage("profile", first.IDKey, write)
+	bt.blobs["blob"] = &types.Blob{Hash: "blob", Data: []byte("media")}
+	bt.stage(config.BlobCollection, "blob", write)
+
+	bt = bt.carry(100, 90)
+	if id, _ := bt.identityByAddress(first.CurrentAddress); id != first {
+		t.Errorf("identity dumped after the ingested height was dropped")
+	}
+	if bt.attests[testHash] == nil || bt.profiles[first.IDKey] == nil {
+		t.Errorf("attestation or profile dumped after the ingested height was dropped")
+	}
+	if _, ok := bt.attests["read"]; ok {
+		t.Errorf("attestation that was only read was carried")
+	}
+	if len(bt.blobs) != 0 {
+		t.Errorf("dumped blobs were carried")
+	}
+	if !bt.empty() {
+		t.Errorf("carried batch has writes")
+	}
+
+	// dumped to block 101 once the ingester reached 100
+	bt.cacheIdentity(second)
+	bt.stage("id", second.IDKey, write)
+	bt = bt.carry(101, 100)
+	if _, ok := bt.ids[first.IDKey]; ok {
+		t.Errorf("ingested identity was carried")
+	}
+	if _, ok := bt.byAddress[first.CurrentAddress]; ok {
+		t.Errorf("address of an ingested identity was carried")
+	}
+	if _, ok := bt.attests[testHash]; ok {
+		t.Errorf("ingested attestation was carried")
+	}
+	if _, ok := bt.profiles[first.IDKey]; ok {
+		t.Errorf("ingested profile was carried")
+	}
+	if bt.ids[second.IDKey] != second || bt.byAddress[second.CurrentAddress] != second.IDKey {
+		t.Errorf("identity dumped after the ingested height was dropped")
+	}
+}
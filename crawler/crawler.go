@@ -2,47 +2,47 @@ package crawler
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
-	"os"
+	"sync"
 	"time"
 
 	"fmt"
 
 	"github.com/BitcoinSchema/go-bap-indexer/config"
-	"github.com/BitcoinSchema/go-bap-indexer/database"
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
 	"github.com/BitcoinSchema/go-bap-indexer/state"
 	"github.com/BitcoinSchema/go-bap-indexer/types"
 	"github.com/b-open-io/go-junglebus"
 	"github.com/b-open-io/go-junglebus/models"
 	"github.com/bitcoin-sv/go-sdk/transaction"
-	"github.com/bitcoinschema/go-aip"
-	"github.com/bitcoinschema/go-bap"
 	"github.com/bitcoinschema/go-bob"
 	"github.com/ttacon/chalk"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // var wgs map[uint32]*sync.WaitGroup
-var cancelChannel chan int
 var eventChannel chan *Event
 
+// cancelCrawl stops the running crawl, see CancelCrawl
+var cancelCrawl context.CancelFunc = func() {}
+
+// ctx is used for database writes. It is never cancelled so that events
+// drained during shutdown are still applied.
 var ctx = context.Background()
 
-func SyncBlocks(height int) (newBlock int) {
+// SyncBlocks crawls from height until parent is cancelled, then returns the
+// last block that was fully applied
+func SyncBlocks(parent context.Context, height int) (newBlock int) {
 	// Setup crawl timer
 	crawlStart := time.Now()
 
-	// Crawl will mutate currentBlock
-	newBlock = Crawl(height)
+	// Crawl blocks until shutdown
+	newBlock = Crawl(parent, height)
 
 	// Crawl complete
 	diff := time.Since(crawlStart).Seconds()
 
-	// TODO: I believe if we get here crawl has actually died
-	fmt.Printf("Junglebus closed after %fs\nBlock height: %d\n", diff, height)
+	fmt.Printf("Junglebus closed after %fs\nBlock height: %d\n", diff, newBlock)
 	return
 }
 
@@ -69,12 +69,18 @@ type Event struct {
 func init() {
 	// TODO: Is this needed?
 	// wgs = make(map[uint32]*sync.WaitGroup)
-	// cancelChannel = make(chan int)
 	eventChannel = make(chan *Event, 1000000) // Buffered channel
+	metrics.ObserveEventChannel(func() int { return len(eventChannel) }, cap(eventChannel))
 }
 
-// Crawl loops over the new bmap transactions since the given block height
-func Crawl(height int) (newHeight int) {
+// Crawl loops over the new bmap transactions since the given block height.
+// It blocks until parent is cancelled (or CancelCrawl is called), then stops
+// the subscription, applies every event already buffered and returns the
+// last fully applied block.
+func Crawl(parent context.Context, height int) (newHeight int) {
+	crawlCtx, cancel := context.WithCancel(parent)
+	defer cancel()
+	cancelCrawl = cancel
 
 	// readyFiles := make(chan string, 1000) // Adjust buffer size as needed
 	// make the first waitgroup for the initial block
@@ -98,6 +104,10 @@ func Crawl(height int) (newHeight int) {
 	if lastBlock > fromBlock {
 		fromBlock = lastBlock
 	}
+	newHeight = int(fromBlock)
+	lastApplied, savedHeight = uint32(lastBlock), uint32(lastBlock)
+	pending, halted = newBatch(), nil
+	pendingOps.reset()
 
 	eventHandler := junglebus.EventHandler{
 		// Mined tx callback
@@ -143,293 +153,157 @@ func Crawl(height int) (newHeight int) {
 
 	fmt.Printf("Initializing from block %d\n", fromBlock)
 
+	status.Lock()
+	status.Running = true
+	status.Connection = "connecting"
+	status.Unlock()
+
 	var subscription *junglebus.Subscription
-	if subscription, err = junglebusClient.Subscribe(ctx, subscriptionID, fromBlock, eventHandler); err != nil {
+	if subscription, err = junglebusClient.Subscribe(crawlCtx, subscriptionID, fromBlock, eventHandler); err != nil {
 		log.Printf("ERROR: failed getting subscription %s", err.Error())
+		setConnection("error")
+		return
 	}
 
-	if err != nil {
-		log.Printf("ERROR: failed getting subscription %s", err.Error())
-		unsubscribeError := subscription.Unsubscribe()
-
-		if err = subscription.Unsubscribe(); unsubscribeError != nil {
-			log.Printf("ERROR: failed unsubscribing %s", err.Error())
-		}
+	// apply events until we are told to stop
+	if applied := eventListener(crawlCtx, subscription); applied > 0 {
+		newHeight = int(applied)
 	}
 
-	// wait indefinitely to make sure we dont stop
-	// before more mempool txs come in
-	go eventListener(subscription)
-
-	// have a channel here listen for the stop signal, decrement the waitgroup
-	// and return the new block height to resubscribe from
-
-	// Print tx line to stdout
-	// if err != nil {
-	// 	fmt.Println(err)
-	// }
-
 	return
 }
 
+// CancelCrawl stops the running crawl. Buffered events are still applied and
+// progress is flushed before Crawl returns.
 func CancelCrawl(newBlockHeight int) {
 	log.Printf("%s[INFO]: Canceling crawl at block %d%s\n", chalk.Yellow, newBlockHeight, chalk.Reset)
-	cancelChannel <- newBlockHeight
+	cancelCrawl()
 }
 
-func processTransactionEvent(rawtx []byte, blockHeight uint32, blockTime uint32) {
-	if len(rawtx) > 0 {
-		// log.Printf("[TX]: %d: %s | Data Length: %d", blockHeight, tx.Id, len(tx.Transaction))
-		t, err := transaction.NewTransactionFromBytes(rawtx)
-		if err != nil {
-			log.Printf("[ERROR]: %v", err)
-			return
-		}
-		var bobTx *bob.Tx
-		if bobTx, err = bob.NewFromTx(t); err != nil {
-			return
-		}
-
-		bobTx.Blk.I = blockHeight
-		bobTx.Blk.T = blockTime
-		ProcessTx(bobTx)
+// processBlockDoneEvent ingests the block file for height and then saves
+// height as the ingested progress
+func processBlockDoneEvent(height uint32) error {
+	filename := blockFile(height)
 
-	}
-}
-
-func processMempoolEvent(rawtx []byte) {
-	t, err := transaction.NewTransactionFromBytes(rawtx)
+	ingested, rejected, err := ingest(filename, height)
 	if err != nil {
-		log.Printf("[ERROR]: %v", err)
-		return
+		return err
 	}
-	var bobTx *bob.Tx
-	if bobTx, err = bob.NewFromTx(t); err != nil {
-		return
+	if err := newBatch().flush(height); err != nil {
+		return err
 	}
 
-	ProcessTx(bobTx)
+	// log ingestions in green using chalk
+	log.Printf("%sIngested %d records from block %d (%d rejected)%s", chalk.Cyan, ingested, height, rejected, chalk.Reset)
+	return nil
 }
 
-func processBlockDoneEvent(height uint32, count uint32) {
+// applyMu serializes staging and flushing between the crawler and
+// reprocessing requests coming from the admin API. The crawler only swaps
+// pending while holding it.
+var applyMu sync.Mutex
+
+// ProcessTx applies every signed BAP op in bobTx and writes them in one
+// batch. Lookups and writes that hit transient database errors are retried
+// with backoff. Ops that are malformed or can't be resolved are skipped and
+// reported in a *TxError so the caller can quarantine them; the rest of the
+// tx is still applied. t is the decoded tx, needed to verify Sigma
+// signatures.
+func ProcessTx(bobTx *bob.Tx, t *transaction.Transaction) error {
+	return processOps(bobTx, t, nil)
+}
 
-	filename := fmt.Sprintf("data/%d.json", height)
+// signedOp is a BAP op with a valid signature. Index is its position
+// among the tx's signed BAP ops.
+type signedOp struct {
+	Index int
+	types.BapAip
+}
 
-	// // check if the file exists at path
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		log.Printf("No block file found for %d ", height)
-		return
-	}
+// validOps returns the BAP ops of bobTx with a valid signature whose index
+// is in only, or all of them when only is nil. It doesn't touch the
+// database, so it can run on any goroutine.
+func validOps(bobTx *bob.Tx, t *transaction.Transaction, only map[int]bool) []signedOp {
+	ops := make([]signedOp, 0)
+	for i, b := range parseBapAip(bobTx) {
+		if only != nil && !only[i] {
+			continue
+		}
 
-	ingest(filename)
-	state.SaveProgress(height)
-	if config.DeleteAfterIngest {
-		err := os.Remove(filename)
-		if err != nil {
-			fmt.Printf("%s%s %s: %v%s\n", chalk.Cyan, "Error deleting file", filename, err, chalk.Reset)
+		if err := verifySignatures(&b, t, true); err != nil {
+			log.Printf("Error validating signatures: %s op %d: %v", bobTx.Tx.Tx.H, i, err)
+			continue
 		}
+		ops = append(ops, signedOp{Index: i, BapAip: b})
 	}
+	return ops
+}
 
-	// log ingestions in green using chalk
-	log.Printf("%sIngested %d txs from block %d%s", chalk.Cyan, count, height, chalk.Reset)
+// processOps applies the BAP ops of bobTx whose index is in only, or all of
+// them when only is nil, and writes them right away
+func processOps(bobTx *bob.Tx, t *transaction.Transaction, only map[int]bool) error {
+	bt := newBatch()
+	opErr := applyOps(bt, bobTx, validOps(bobTx, t, only))
 
+	applyMu.Lock()
+	defer applyMu.Unlock()
+	if err := bt.flush(0); err != nil {
+		return err
+	}
+	return opErr
 }
 
-func ProcessTx(bobTx *bob.Tx) {
-	baps := make([]types.BapAip, 0)
-	for _, out := range bobTx.Out {
-		var bapAip *types.BapAip
-		for index, tape := range out.Tape {
-			if len(tape.Cell) > 0 && tape.Cell[0].S != nil {
-				prefixData := *tape.Cell[0].S
-				switch prefixData {
-				case bap.Prefix:
-					if bapOut, err := bap.NewFromTape(&out.Tape[index]); err != nil {
-						bapAip = nil
-						continue
-					} else {
-						bapAip = &types.BapAip{
-							BAP: bapOut,
-						}
-					}
-				case aip.Prefix:
-					if bapAip != nil {
-						aipOut := aip.NewFromTape(tape)
-						// TODO: Use the correct instance index
-						aipOut.SetDataFromTapes(out.Tape, 0)
-						bapAip.AIP = aipOut
-						baps = append(baps, *bapAip)
-						bapAip = nil
-					}
-				default:
-					if bapAip != nil {
-						bapAip = nil
-					}
-				}
-			}
-		}
+// reprocessOps applies the BAP ops of bobTx whose index is in only on top of
+// the block the crawler is staging, and writes both right away. The ops see
+// what the crawler hasn't written yet, and ops the crawler parked that they
+// resolve are written with them instead of being lost to another batch.
+func reprocessOps(bobTx *bob.Tx, t *transaction.Transaction, only map[int]bool) error {
+	ops := validOps(bobTx, t, only)
+
+	applyMu.Lock()
+	defer applyMu.Unlock()
+	if DumpToFiles {
+		// the staged block goes to a file, and the database lags behind it
+		return errors.New("quarantined txs can't be reprocessed while dumping to files, reprocess them from the ingest process")
+	}
+	opErr := stageOps(pending, bobTx, ops)
+	if err := pending.flush(0); err != nil {
+		return err
 	}
+	pending.written()
+	return opErr
+}
 
-	conn := database.GetConnection()
-	idColl := conn.Database("bap").Collection("id")
-	atColl := conn.Database("bap").Collection("attest")
-	proColl := conn.Database("bap").Collection("profile")
+// applyOps stages ops in bt, in order. Ops that fail are left out of bt and
+// reported in a *TxError. Ops waiting on an identity this tx creates are
+// staged right after it.
+func applyOps(bt *batch, bobTx *bob.Tx, ops []signedOp) error {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+	return stageOps(bt, bobTx, ops)
+}
 
-	for _, b := range baps {
+// stageOps is applyOps for a caller that holds applyMu
+func stageOps(bt *batch, bobTx *bob.Tx, ops []signedOp) error {
+	txErr := &TxError{Txid: bobTx.Tx.Tx.H, Ops: map[int]error{}}
+	for _, op := range ops {
+		metrics.OpsProcessed.WithLabelValues(string(op.BAP.Type)).Inc()
 
-		if valid, err := b.AIP.Validate(); err != nil {
-			log.Printf("Error validating AIP: %s %v", bobTx.Tx.Tx.H, err)
-			continue
-		} else if !valid {
+		mutations, err := plan(bt, bobTx, op)
+		if err != nil {
+			if errors.Is(err, ErrNoIdentity) {
+				metrics.OpsWithoutID.WithLabelValues(string(op.BAP.Type)).Inc()
+			}
+			log.Printf("%s[ERROR]: %s op %d: %v%s", chalk.Red, bobTx.Tx.Tx.H, op.Index, err, chalk.Reset)
+			txErr.Ops[op.Index] = err
 			continue
 		}
+		bt.apply(bobTx, mutations)
+		resolvePending(bt, bobTx, mutations)
+	}
 
-		id := &types.Identity{}
-		if err := idColl.FindOne(
-			ctx,
-			bson.M{"currentAddress": b.AIP.AlgorithmSigningComponent},
-		).Decode(&id); err == mongo.ErrNoDocuments {
-			id = nil
-		} else if err != nil {
-			panic(err)
-		}
-
-		switch b.BAP.Type {
-		case bap.ID:
-			if id == nil {
-				id = &types.Identity{
-					IDKey:          b.BAP.IDKey,
-					FirstSeen:      bobTx.Tx.Blk.I,
-					RootAddress:    b.AIP.AlgorithmSigningComponent,
-					CurrentAddress: b.BAP.Address,
-					Addresses: []types.Address{
-						{
-							Address: b.BAP.Address,
-							Txid:    bobTx.Tx.Tx.H,
-							Block:   bobTx.Tx.Blk.I,
-						},
-					},
-				}
-				if _, err := idColl.InsertOne(ctx, id); err != nil && !mongo.IsDuplicateKeyError(err) {
-					panic(err)
-				}
-			} else if id.CurrentAddress == b.AIP.AlgorithmSigningComponent {
-				if _, err := idColl.UpdateOne(ctx, bson.M{"_id": id.IDKey}, bson.M{
-					"$set": bson.M{"currentAddress": b.BAP.Address},
-					"$addToSet": bson.M{"addresses": types.Address{
-						Address: b.BAP.Address,
-						Txid:    bobTx.Tx.Tx.H,
-						Block:   bobTx.Tx.Blk.I,
-					}},
-				}); err != nil {
-					panic(err)
-				}
-			}
-		case bap.ATTEST:
-			if id == nil {
-				log.Println("ATTEST without ID", bobTx.Tx.Tx.H)
-				continue
-				// panic()
-			}
-			signer := &types.Signer{
-				IDKey:     id.IDKey,
-				Address:   b.AIP.AlgorithmSigningComponent,
-				Txid:      bobTx.Tx.Tx.H,
-				Block:     bobTx.Tx.Blk.I,
-				Timestamp: bobTx.Tx.Blk.T,
-				Revoked:   false,
-			}
-			var att *types.Attestation
-			if err := atColl.FindOne(ctx, bson.M{"_id": b.BAP.URNHash}).Decode(&att); err == mongo.ErrNoDocuments {
-				att = &types.Attestation{
-					Id:      b.BAP.URNHash,
-					Signers: []*types.Signer{signer},
-				}
-				if _, err := atColl.InsertOne(ctx, att); err != nil {
-					panic(err)
-				}
-			} else if err != nil {
-				panic(err)
-			} else {
-				found := false
-				for i, s := range att.Signers {
-					if s.IDKey == signer.IDKey {
-						if s.Sequence < signer.Sequence {
-							log.Println("UPDATING ATTEST signer", bobTx.Tx.Tx.H)
-							if _, err := atColl.UpdateOne(ctx,
-								bson.M{
-									"_id": b.BAP.URNHash,
-								},
-								bson.M{"$set": bson.M{fmt.Sprintf("signers.%d", i): signer}},
-							); err != nil {
-								panic(err)
-							}
-						} else {
-							log.Println("Bad ATTEST signer sequence", bobTx.Tx.Tx.H)
-						}
-						found = true
-						break
-					}
-				}
-				if !found {
-					log.Println("Adding ATTEST signer", bobTx.Tx.Tx.H)
-					if _, err := atColl.UpdateOne(ctx,
-						bson.M{
-							"_id": b.BAP.URNHash,
-						},
-						bson.M{"$push": bson.M{"signers": signer}},
-					); err != nil {
-						panic(err)
-					}
-				}
-			}
-
-		case bap.REVOKE:
-			if id == nil {
-				log.Println("REVOKE without ID", bobTx.Tx.Tx.H)
-				continue
-			}
-			if _, err := idColl.UpdateOne(ctx,
-				bson.M{"_id": b.BAP.URNHash},
-				bson.M{
-					"$pull": bson.M{
-						"signers": bson.M{
-							"idKey":    id.IDKey,
-							"sequence": bson.M{"$lt": b.BAP.Sequence},
-						},
-					},
-				},
-			); err != nil {
-				panic(err)
-			}
-		case bap.ALIAS:
-			if id == nil {
-				// log.Println("ALIAS without ID", bobTx.Tx.Tx.H)
-				l := map[string]interface{}{
-					"txid": bobTx.Tx.Tx.H,
-					"bap":  b.BAP,
-					"aip":  b.AIP,
-				}
-				j, _ := json.MarshalIndent(l, "", "  ")
-				log.Println("ALIAS without ID", bobTx.Tx.Tx.H, string(j))
-				continue
-			}
-			if len(b.BAP.Profile) > 0 && b.BAP.IDKey == id.IDKey {
-				profile := make(map[string]interface{})
-				if err := json.Unmarshal([]byte(b.BAP.Profile), &profile); err != nil {
-					panic(err)
-				} else if _, err := proColl.UpdateOne(ctx, bson.M{"_id": id.IDKey}, bson.M{"$set": bson.M{"data": profile}}, options.Update().SetUpsert(true)); err != nil {
-					panic(err)
-				}
-			} else {
-				l := map[string]interface{}{
-					"txid": bobTx.Tx.Tx.H,
-					"bap":  b.BAP,
-					"aip":  b.AIP,
-				}
-				j, _ := json.MarshalIndent(l, "", "  ")
-				log.Panicln("ALIAS without ID match", string(j))
-			}
-		}
+	if len(txErr.Ops) > 0 {
+		return txErr
 	}
+	return nil
 }
@@ -0,0 +1,29 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-bob"
+)
+
+func TestReprocessRefusedWhileDumping(t *testing.T) {
+	tx, err := transaction.NewTransactionFromHex(readTestdata(t, attestTxid+".hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobTx, err := bob.NewFromTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DumpToFiles = true
+	defer func() { DumpToFiles = false }()
+	staged := pending
+	if err := reprocessOps(bobTx, tx, nil); err == nil {
+		t.Fatal("reprocessed into a batch bound for a block file")
+	}
+	if pending != staged || !pending.empty() || len(pending.attests) != 0 {
+		t.Errorf("refused reprocess touched the crawler's batch")
+	}
+}
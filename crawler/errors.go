@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bitcoinschema/go-bap"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNoIdentity is wrapped by the OpError of ops whose signing address
+// matches no identity
+var ErrNoIdentity = errors.New("no identity for signing address")
+
+// OpError is returned when a BAP op is malformed or can't be resolved against
+// the index (no identity for the signer, invalid profile json, ...). Retrying
+// won't help, so these ops are quarantined.
+type OpError struct {
+	Type   bap.AttestationType
+	Reason string
+	// Err is the cause, if any
+	Err error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Reason)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// ExpiredError is recorded for an op that waited for its signer's identity
+// until config.PendingOpsExpiry blocks had passed
+type ExpiredError struct {
+	ParkedAt  uint32
+	ExpiredAt uint32
+	// Err is the error the op failed with when it was parked
+	Err error
+}
+
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("%v, waited from block %d to %d", e.Err, e.ParkedAt, e.ExpiredAt)
+}
+
+func (e *ExpiredError) Unwrap() error {
+	return e.Err
+}
+
+// TxError collects the ops of a tx that could not be applied. Index is the
+// position of the op among the tx's BAP ops; -1 marks a tx level failure
+// such as a transaction that can't be decoded.
+type TxError struct {
+	Txid string
+	Ops  map[int]error
+}
+
+func (e *TxError) Error() string {
+	reasons := make([]string, 0, len(e.Ops))
+	for _, i := range slices.Sorted(maps.Keys(e.Ops)) {
+		reasons = append(reasons, fmt.Sprintf("op %d: %v", i, e.Ops[i]))
+	}
+	return fmt.Sprintf("tx %s: %s", e.Txid, strings.Join(reasons, "; "))
+}
+
+// isTransient reports whether err is worth retrying: network blips, timeouts
+// and elections on the Mongo side
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *OpError
+	if errors.As(err, &opErr) {
+		return false
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.HasErrorLabel("RetryableWriteError") || cmdErr.HasErrorLabel("TransientTransactionError")
+	}
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		return writeErr.HasErrorLabel("RetryableWriteError") || writeErr.HasErrorLabel("TransientTransactionError")
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTxErrorOrder(t *testing.T) {
+	err := &TxError{Txid: "tx", Ops: map[int]error{}}
+	for _, i := range []int{5, 2, -1, 9, 0, 7, 1} {
+		err.Ops[i] = errors.New("failed")
+	}
+	want := "tx tx: op -1: failed; op 0: failed; op 1: failed; op 2: failed; op 5: failed; op 7: failed; op 9: failed"
+	// map order changes between iterations, so one lucky pass isn't enough
+	for range 20 {
+		if got := err.Error(); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
@@ -1,65 +1,206 @@
 package crawler
 
 import (
+	"context"
 	"log"
 
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
 	"github.com/BitcoinSchema/go-bap-indexer/state"
 	"github.com/b-open-io/go-junglebus"
 	"github.com/ttacon/chalk"
 )
 
-// map of block height to tx count
-var blocksDone = make(chan map[uint32]uint32, 1000)
+// DumpToFiles makes the crawler write the records of each block to
+// config.DataDir instead of MongoDB, for an ingest process to pick up
+var DumpToFiles = false
 
 var txCount uint32
 
-func eventListener(subscription *junglebus.Subscription) {
-	// var crawlHeight uint32
-	// var wg sync.WaitGroup
-	for event := range eventChannel {
-		switch event.Type {
-		case "transaction":
-			txCount++
-			// log.Printf("%sTransaction %s %s\n", chalk.Green, event.Id, chalk.Reset)
-			processTransactionEvent(event.Transaction, event.Height, event.Time)
-
-		case "status":
-			switch event.Status {
-			case "disconnected":
-				txCount = 0
-				log.Printf("%sDisconnected from Junglebus. Reset tx counter.%s\n", chalk.Green, chalk.Reset)
-				continue
-			case "connected":
-				log.Printf("%sConnected to Junglebus%s\n", chalk.Green, chalk.Reset)
-
-				continue
-			case "block-done":
-				// copy the var
-				var count = txCount
-				if count > 0 {
-					log.Printf("%sBlock %d done with %d transactions%s\n", chalk.Green, event.Height, count, chalk.Reset)
-					state.SaveProgress(event.Height)
-					// blocksDone <- map[uint32]uint32{event.Height: count}
+// lastApplied is the last block whose every tx has been applied
+var lastApplied uint32
+
+// savedHeight is the last height written to _state
+var savedHeight uint32
+
+// pending stages the writes of the block being received
+var pending = newBatch()
+
+// stopAt makes the crawl stop once this block is applied, 0 crawls on
+var stopAt uint32
+
+// halted is set when a block could not be written. Later events are ignored
+// so progress never moves past it, and the crawl is cancelled.
+var halted error
+
+// eventListener applies events until ctx is cancelled. It then stops the
+// subscription, applies whatever is still buffered and flushes progress for
+// the last fully applied block, which it returns.
+//
+// Txs are prepared in parallel but events are committed one at a time in the
+// order JungleBus sent them.
+func eventListener(ctx context.Context, subscription *junglebus.Subscription) uint32 {
+	p := newPipeline(processWorkers(), config.PipelineDepth, commitEvent)
+	for {
+		select {
+		case event := <-eventChannel:
+			p.submit(event)
+		case <-ctx.Done():
+			log.Printf("%sStopping Junglebus subscription%s\n", chalk.Yellow, chalk.Reset)
+			if err := subscription.Unsubscribe(); err != nil {
+				log.Printf("ERROR: failed unsubscribing %s", err.Error())
+			}
+
+			drained := 0
+		drain:
+			for {
+				select {
+				case event := <-eventChannel:
+					p.submit(event)
+					drained++
+				default:
+					break drain
+				}
+			}
+			p.close()
+
+			// txs after the last block-done belong to a partial block, so
+			// their staged writes are dropped and they are replayed
+			if halted == nil {
+				if err := commitBlock(newBatch(), lastApplied); err != nil {
+					log.Printf("%s[ERROR]: saving progress: %v%s", chalk.Red, err, chalk.Reset)
 				}
-				txCount = 0
-				continue
 			}
-		case "mempool":
-			processMempoolEvent(event.Transaction)
-		case "error":
-			log.Printf("%sERROR: %s%s\n", chalk.Green, event.Error.Error(), chalk.Reset)
+			setPending(newBatch())
+
+			// ops from applied blocks won't be seen again, the rest are
+			// replayed with their partial block
+			var waiting []*pendingOp
+			for _, w := range pendingOps.reset() {
+				if halted == nil && w.tx.height > 0 && w.tx.height <= lastApplied {
+					waiting = append(waiting, w)
+				}
+			}
+			quarantineWaiting(waiting, lastApplied)
+
+			log.Printf("%sApplied %d buffered events, progress saved at block %d%s\n", chalk.Yellow, drained, lastApplied, chalk.Reset)
+			return lastApplied
 		}
 	}
 }
 
-func ProcessDone() {
-	for heightMap := range blocksDone {
-		// loop over single entry map
-		for height, txCount := range heightMap {
-			if txCount > 0 {
-				processBlockDoneEvent(height, txCount)
+// commitEvent runs on the pipeline's commit goroutine, one event at a time
+func commitEvent(j *job) {
+	if halted != nil || (stopAt > 0 && lastApplied >= stopAt) {
+		return
+	}
+
+	event := j.event
+	switch event.Type {
+	case "transaction":
+		txCount++
+		metrics.TxsProcessed.Inc()
+		// log.Printf("%sTransaction %s %s\n", chalk.Green, event.Id, chalk.Reset)
+		if j.tx != nil {
+			j.tx.apply(pending)
+		}
+
+	case "status":
+		if event.Status != "block-done" {
+			setConnection(event.Status)
+		}
+		switch event.Status {
+		case "disconnected":
+			txCount = 0
+			log.Printf("%sDisconnected from Junglebus. Reset tx counter.%s\n", chalk.Green, chalk.Reset)
+		case "connected":
+			log.Printf("%sConnected to Junglebus%s\n", chalk.Green, chalk.Reset)
+		case "block-done":
+			// every tx of the block has been staged by now, since events
+			// are committed in order
+			height := max(lastApplied, event.Height)
+
+			// copy the var
+			var count = txCount
+			if count > 0 {
+				log.Printf("%sBlock %d done with %d transactions%s\n", chalk.Green, event.Height, count, chalk.Reset)
+				if err := commitBlock(pending, height); err != nil {
+					log.Printf("%s[ERROR]: writing block %d: %v, stopping crawl%s", chalk.Red, event.Height, err, chalk.Reset)
+					halted = err
+					cancelCrawl()
+					return
+				}
+				next := newBatch()
+				if DumpToFiles {
+					ingested, err := state.ReadProgress()
+					if err != nil {
+						// keep everything rather than read back stale documents
+						log.Printf("%s[ERROR]: reading ingest progress: %v%s", chalk.Red, err, chalk.Reset)
+					}
+					next = pending.carry(height, ingested)
+				}
+				setPending(next)
 			}
-			break
+			lastApplied = height
+			expirePending(height)
+			if stopAt > 0 && lastApplied >= stopAt {
+				log.Printf("%sReached block %d, stopping crawl%s", chalk.Green, stopAt, chalk.Reset)
+				cancelCrawl()
+			}
+			setLastBlock(event.Height)
+			metrics.SetIndexedHeight(event.Height)
+			txCount = 0
+		}
+	case "mempool":
+		if j.tx != nil {
+			// mempool txs have no block-done, write them right away
+			bt := newBatch()
+			j.tx.apply(bt)
+			if err := commitBlock(bt, 0); err != nil {
+				log.Printf("%s[ERROR]: writing mempool tx %s: %v%s", chalk.Red, event.Id, err, chalk.Reset)
+			}
+		}
+	case "error":
+		log.Printf("%sERROR: %s%s\n", chalk.Green, event.Error.Error(), chalk.Reset)
+	}
+}
+
+// setPending swaps the batch the crawler stages into
+func setPending(bt *batch) {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+	pending = bt
+}
+
+// commitBlock writes bt together with the _state height. Progress only ever
+// moves forward, so height is left out when it is not past savedHeight.
+//
+// With DumpToFiles bt goes to the block file for height instead, and _state
+// is left to the ingest process.
+func commitBlock(bt *batch, height uint32) error {
+	if DumpToFiles {
+		if height == 0 {
+			// mempool txs have no block file
+			return nil
 		}
+		if err := bt.dump(height); err != nil {
+			return err
+		}
+		savedHeight = max(savedHeight, height)
+		return nil
+	}
+
+	if height <= savedHeight {
+		height = 0
+	}
+
+	applyMu.Lock()
+	defer applyMu.Unlock()
+	if err := bt.flush(height); err != nil {
+		return err
+	}
+	if height > 0 {
+		savedHeight = height
 	}
+	return nil
 }
@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
+	"github.com/bitcoinschema/go-bob"
+	"github.com/ttacon/chalk"
+)
+
+// pendingOp is an op waiting for the identity of its signer. since is the
+// block it started waiting at.
+type pendingOp struct {
+	op    signedOp
+	tx    *preparedTx
+	since uint32
+}
+
+// pendingBuffer holds ops whose signer had no identity when they were
+// applied, keyed by signing address. Txs in a block aren't always in
+// dependency order, so an ATTEST, REVOKE or ALIAS can show up before the ID
+// it needs.
+type pendingBuffer struct {
+	sync.Mutex
+	byAddress map[string][]*pendingOp
+	size      int
+}
+
+var pendingOps = newPendingBuffer()
+
+func newPendingBuffer() *pendingBuffer {
+	return &pendingBuffer{byAddress: map[string][]*pendingOp{}}
+}
+
+// park takes the ops of p that failed for lack of an identity out of err
+// and holds them until the identity shows up. It returns the rest of err,
+// nil when every failed op was parked. Ops that don't fit in the buffer are
+// left in err.
+func (pb *pendingBuffer) park(p *preparedTx, err error) error {
+	var txErr *TxError
+	if !errors.As(err, &txErr) {
+		return err
+	}
+	ops := make(map[int]signedOp, len(p.ops))
+	for _, op := range p.ops {
+		ops[op.Index] = op
+	}
+	since := p.height
+	if since == 0 {
+		since = lastApplied
+	}
+
+	pb.Lock()
+	defer pb.Unlock()
+	for i, opErr := range txErr.Ops {
+		op, ok := ops[i]
+		if !ok || !errors.Is(opErr, ErrNoIdentity) {
+			continue
+		}
+		if pb.size >= config.PendingOpsLimit {
+			metrics.PendingOpsResolved.WithLabelValues("overflow").Inc()
+			continue
+		}
+		pb.add(&pendingOp{op: op, tx: p, since: since})
+		delete(txErr.Ops, i)
+		log.Printf("%s[PENDING]: %s op %d waits for an identity for %s%s", chalk.Yellow, p.txid, i, op.Signature.Address, chalk.Reset)
+	}
+	metrics.PendingOps.Set(float64(pb.size))
+
+	if len(txErr.Ops) == 0 {
+		return nil
+	}
+	return txErr
+}
+
+// add holds w, replacing the same op of the same tx if it is already
+// waiting (a mempool tx that has since been mined). The caller holds pb.
+func (pb *pendingBuffer) add(w *pendingOp) {
+	address := w.op.Signature.Address
+	for i, other := range pb.byAddress[address] {
+		if other.tx.txid == w.tx.txid && other.op.Index == w.op.Index {
+			pb.byAddress[address][i] = w
+			return
+		}
+	}
+	pb.byAddress[address] = append(pb.byAddress[address], w)
+	pb.size++
+}
+
+// take removes and returns the ops waiting on any of addresses
+func (pb *pendingBuffer) take(addresses ...string) (ops []*pendingOp) {
+	pb.Lock()
+	defer pb.Unlock()
+	for _, address := range addresses {
+		ops = append(ops, pb.byAddress[address]...)
+		pb.size -= len(pb.byAddress[address])
+		delete(pb.byAddress, address)
+	}
+	metrics.PendingOps.Set(float64(pb.size))
+	return
+}
+
+// expire removes and returns the ops that have waited config.PendingOpsExpiry
+// blocks by height
+func (pb *pendingBuffer) expire(height uint32) (ops []*pendingOp) {
+	expiry := uint32(config.Int("PENDING_OPS_EXPIRY", config.PendingOpsExpiry))
+
+	pb.Lock()
+	defer pb.Unlock()
+	for address, waiting := range pb.byAddress {
+		kept := waiting[:0]
+		for _, w := range waiting {
+			if w.since+expiry <= height {
+				ops = append(ops, w)
+			} else {
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) == 0 {
+			delete(pb.byAddress, address)
+		} else {
+			pb.byAddress[address] = kept
+		}
+	}
+	pb.size -= len(ops)
+	metrics.PendingOps.Set(float64(pb.size))
+	return
+}
+
+// reset empties the buffer and returns what was in it
+func (pb *pendingBuffer) reset() (ops []*pendingOp) {
+	pb.Lock()
+	defer pb.Unlock()
+	for _, waiting := range pb.byAddress {
+		ops = append(ops, waiting...)
+	}
+	pb.byAddress, pb.size = map[string][]*pendingOp{}, 0
+	metrics.PendingOps.Set(0)
+	return
+}
+
+// resolvePending applies the ops waiting on identities created or rotated
+// by mutations of bobTx, right after them in bt. They are staged at bobTx's
+// block, where they took effect, so a rewind below it undoes them along with
+// the identity. The caller holds applyMu.
+func resolvePending(bt *batch, bobTx *bob.Tx, mutations []Mutation) {
+	for _, m := range mutations {
+		if m.Action != ActionCreateIdentity && m.Action != ActionRotateAddress {
+			continue
+		}
+		id := bt.ids[m.ID]
+		if id == nil {
+			continue
+		}
+		for _, w := range pendingOps.take(id.RootAddress, id.CurrentAddress) {
+			resolved := *w.tx.bobTx
+			resolved.Blk = bobTx.Blk
+			mutations, err := plan(bt, &resolved, w.op)
+			if errors.Is(err, ErrNoIdentity) {
+				// still signed by an address without an identity
+				pendingOps.Lock()
+				pendingOps.add(w)
+				pendingOps.Unlock()
+				continue
+			} else if err != nil {
+				metrics.PendingOpsResolved.WithLabelValues("failed").Inc()
+				quarantine(w.tx.txid, w.tx.rawtx, w.tx.height, w.tx.time, &TxError{Txid: w.tx.txid, Ops: map[int]error{w.op.Index: err}})
+				continue
+			}
+
+			metrics.PendingOpsResolved.WithLabelValues("applied").Inc()
+			log.Printf("%s[PENDING]: %s op %d applied after identity %s%s", chalk.Green, w.tx.txid, w.op.Index, id.IDKey, chalk.Reset)
+			bt.apply(&resolved, mutations)
+			resolvePending(bt, &resolved, mutations)
+		}
+	}
+}
+
+// expirePending quarantines the ops that have waited too long by height,
+// recording how long they waited
+func expirePending(height uint32) {
+	quarantineWaiting(pendingOps.expire(height), height)
+}
+
+// quarantineWaiting quarantines ops taken out of the buffer at height, one
+// record per tx
+func quarantineWaiting(ops []*pendingOp, height uint32) {
+	byTx := map[*preparedTx]*TxError{}
+	for _, w := range ops {
+		txErr, ok := byTx[w.tx]
+		if !ok {
+			txErr = &TxError{Txid: w.tx.txid, Ops: map[int]error{}}
+			byTx[w.tx] = txErr
+		}
+		txErr.Ops[w.op.Index] = &ExpiredError{
+			ParkedAt:  w.since,
+			ExpiredAt: height,
+			Err:       &OpError{Type: w.op.BAP.Type, Reason: ErrNoIdentity.Error() + " " + w.op.Signature.Address, Err: ErrNoIdentity},
+		}
+		metrics.PendingOpsResolved.WithLabelValues("expired").Inc()
+	}
+	for p, txErr := range byTx {
+		quarantine(p.txid, p.rawtx, p.height, p.time, txErr)
+	}
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bitcoinschema/go-bap"
+)
+
+// testPending is a tx at block whose ops are an ATTEST of testHash signed
+// by address and an op that failed for another reason. The error is what
+// applying it returns when address has no identity.
+func testPending(block uint32, address string) (*preparedTx, error) {
+	bobTx := testTx(block)
+	attest := signedBy(address, &bap.Bap{Type: bap.ATTEST, URNHash: testHash, Sequence: 1})
+	other := signedBy(address, &bap.Bap{Type: bap.ALIAS, IDKey: testIDKey})
+	other.Index = 1
+	p := &preparedTx{txid: bobTx.Tx.Tx.H, height: block, bobTx: bobTx, ops: []signedOp{attest, other}}
+	return p, &TxError{Txid: p.txid, Ops: map[int]error{
+		0: &OpError{Type: bap.ATTEST, Reason: ErrNoIdentity.Error() + " " + address, Err: ErrNoIdentity},
+		1: &OpError{Type: bap.ALIAS, Reason: "empty profile"},
+	}}
+}
+
+func TestPendingPark(t *testing.T) {
+	pb := newPendingBuffer()
+	p, err := testPending(600000, testAddress)
+
+	rest := pb.park(p, err)
+	var txErr *TxError
+	if !errors.As(rest, &txErr) || len(txErr.Ops) != 1 || txErr.Ops[1] == nil {
+		t.Fatalf("park returned %v, want only the op that failed for another reason", rest)
+	}
+	if pb.size != 1 || len(pb.byAddress[testAddress]) != 1 || pb.byAddress[testAddress][0].since != 600000 {
+		t.Fatalf("buffer %+v, want the ATTEST waiting since 600000", pb.byAddress)
+	}
+
+	// the same tx seen again once mined replaces the op waiting
+	mined, err := testPending(600000, testAddress)
+	pb.park(mined, err)
+	if pb.size != 1 || pb.byAddress[testAddress][0].tx != mined {
+		t.Errorf("size %d after parking the op again, want 1 holding the newer tx", pb.size)
+	}
+
+	plain := errors.New("not a tx error")
+	if got := pb.park(p, plain); got != plain {
+		t.Errorf("park returned %v for an error without ops, want it unchanged", got)
+	}
+	if got := pb.take("1BoatSLRHtKNngkdXEeobR76b53LETtpyT", testAddress); len(got) != 1 || pb.size != 0 || len(pb.byAddress) != 0 {
+		t.Errorf("take returned %d ops and left %d, want 1 and none", len(got), pb.size)
+	}
+}
+
+func TestPendingExpire(t *testing.T) {
+	t.Setenv("PENDING_OPS_EXPIRY", "6")
+	pb := newPendingBuffer()
+	for _, block := range []uint32{600000, 600002} {
+		p, err := testPending(block, testAddress)
+		pb.park(p, err)
+	}
+
+	tests := []struct {
+		height  uint32
+		expired int
+		left    int
+	}{
+		{600005, 0, 2},
+		{600006, 1, 1},
+		{600007, 0, 1},
+		{600008, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := pb.expire(tt.height); len(got) != tt.expired || pb.size != tt.left {
+			t.Errorf("expire(%d) returned %d and left %d, want %d and %d", tt.height, len(got), pb.size, tt.expired, tt.left)
+		}
+	}
+	if len(pb.byAddress) != 0 {
+		t.Errorf("addresses left with nothing waiting: %v", pb.byAddress)
+	}
+}
+
+func TestPendingReset(t *testing.T) {
+	pb := newPendingBuffer()
+	for _, address := range []string{testAddress, "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"} {
+		p, err := testPending(600000, address)
+		pb.park(p, err)
+	}
+	if got := pb.reset(); len(got) != 2 || pb.size != 0 || len(pb.byAddress) != 0 {
+		t.Errorf("reset returned %d ops and left %d, want 2 and none", len(got), pb.size)
+	}
+}
+
+func TestResolvePending(t *testing.T) {
+	const rotatedTo = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+	saved := pendingOps
+	pendingOps = newPendingBuffer()
+	t.Cleanup(func() { pendingOps = saved })
+
+	// an ATTEST signed by an address the identity only rotates to later
+	p, err := testPending(600000, rotatedTo)
+	pendingOps.park(p, err)
+
+	bt := testBatch()
+	rotation := testTx(600003)
+	if err := stageOps(bt, rotation, []signedOp{signedBy(testAddress, &bap.Bap{Type: bap.ID, IDKey: testIDKey, Address: rotatedTo})}); err != nil {
+		t.Fatal(err)
+	}
+	if pendingOps.size != 0 {
+		t.Fatalf("%d ops still waiting after the rotation", pendingOps.size)
+	}
+
+	att := bt.attests[testHash]
+	if att == nil || len(att.Signers) != 1 {
+		t.Fatalf("attestation %+v, want the resolved ATTEST", att)
+	}
+	if s := att.Signers[0]; s.IDKey != testIDKey || s.Address != rotatedTo || s.Txid != p.txid || s.Block != 600003 || s.Timestamp != rotation.Tx.Blk.T {
+		t.Errorf("signer %+v, want the ATTEST's tx at the rotation's block", s)
+	}
+	if p.bobTx.Tx.Blk.I != 600000 {
+		t.Errorf("the parked tx was moved to block %d", p.bobTx.Tx.Blk.I)
+	}
+}
@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-bob"
+)
+
+// preparedTx is a tx that has been decoded, parsed and had its signatures
+// checked, ready to be applied
+type preparedTx struct {
+	txid   string
+	rawtx  []byte
+	height uint32
+	time   uint32
+	bobTx  *bob.Tx
+	ops    []signedOp
+	// err is set when the tx could not be decoded
+	err error
+}
+
+// prepareTx does the CPU bound part of processing a tx. It doesn't touch
+// the database so txs can be prepared concurrently.
+func prepareTx(rawtx []byte, txid string, height uint32, blockTime uint32) *preparedTx {
+	p := &preparedTx{txid: txid, rawtx: rawtx, height: height, time: blockTime}
+
+	t, err := transaction.NewTransactionFromBytes(rawtx)
+	if err != nil {
+		p.err = fmt.Errorf("decoding tx: %w", err)
+		return p
+	}
+	if p.bobTx, err = bob.NewFromTx(t); err != nil {
+		p.err = fmt.Errorf("parsing bob tx: %w", err)
+		return p
+	}
+	p.bobTx.Blk.I = height
+	p.bobTx.Blk.T = blockTime
+	p.ops = validOps(p.bobTx, t, nil)
+	return p
+}
+
+// apply stages the tx in bt, quarantining it if it failed to decode or some
+// of its ops could not be applied. Ops whose signer has no identity yet wait
+// in pendingOps instead.
+func (p *preparedTx) apply(bt *batch) {
+	err := p.err
+	if err == nil && len(p.ops) > 0 {
+		err = pendingOps.park(p, applyOps(bt, p.bobTx, p.ops))
+	}
+	if err != nil {
+		quarantine(p.txid, p.rawtx, p.height, p.time, err)
+	}
+}
+
+// job is an event moving through the pipeline. ready is closed once it can
+// be committed.
+type job struct {
+	event *Event
+	tx    *preparedTx
+	ready chan struct{}
+}
+
+// pipeline prepares txs on a pool of workers and hands every event to commit
+// in the order it was submitted, so state changes keep chain order
+type pipeline struct {
+	work    chan *job
+	ordered chan *job
+	workers sync.WaitGroup
+	done    chan struct{}
+}
+
+func newPipeline(workers int, depth int, commit func(*job)) *pipeline {
+	p := &pipeline{
+		work:    make(chan *job, depth),
+		ordered: make(chan *job, depth),
+		done:    make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for j := range p.work {
+				j.tx = prepareTx(j.event.Transaction, j.event.Id, j.event.Height, j.event.Time)
+				close(j.ready)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.done)
+		for j := range p.ordered {
+			<-j.ready
+			commit(j)
+		}
+	}()
+
+	return p
+}
+
+// submit queues event behind everything submitted before it
+func (p *pipeline) submit(event *Event) {
+	j := &job{event: event, ready: make(chan struct{})}
+	if (event.Type == "transaction" || event.Type == "mempool") && len(event.Transaction) > 0 {
+		p.work <- j
+	} else {
+		close(j.ready)
+	}
+	p.ordered <- j
+}
+
+// close waits for every submitted event to be committed
+func (p *pipeline) close() {
+	close(p.work)
+	close(p.ordered)
+	<-p.done
+	p.workers.Wait()
+}
+
+// processWorkers is config.ProcessWorkers, or one per CPU when unset
+func processWorkers() int {
+	if config.ProcessWorkers > 0 {
+		return config.ProcessWorkers
+	}
+	return runtime.NumCPU()
+}
@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPipelineCommitsInOrder(t *testing.T) {
+	committed := make(chan string, 10)
+	// no workers, the test decides when each tx is ready
+	p := newPipeline(0, 10, func(j *job) { committed <- j.event.Id })
+
+	for _, id := range []string{"a", "b", "c"} {
+		p.submit(&Event{Type: "transaction", Id: id, Transaction: []byte{1}})
+	}
+	// ready as soon as it is submitted
+	p.submit(&Event{Type: "block-done", Id: "block"})
+
+	jobs := []*job{<-p.work, <-p.work, <-p.work}
+	close(jobs[2].ready)
+	close(jobs[1].ready)
+	select {
+	case id := <-committed:
+		t.Fatalf("%s committed before a was ready", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(jobs[0].ready)
+	for _, want := range []string{"a", "b", "c", "block"} {
+		select {
+		case id := <-committed:
+			if id != want {
+				t.Fatalf("committed %s, want %s", id, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s was never committed", want)
+		}
+	}
+	p.close()
+}
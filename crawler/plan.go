@@ -0,0 +1,497 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
+	"github.com/BitcoinSchema/go-bap-indexer/profile"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/bitcoin-sv/go-sdk/script"
+	"github.com/bitcoinschema/go-bap"
+	"github.com/bitcoinschema/go-bob"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Mutation actions
+const (
+	ActionCreateIdentity    = "create-identity"
+	ActionRotateAddress     = "rotate-address"
+	ActionCreateAttestation = "create-attestation"
+	ActionAddSigner         = "add-signer"
+	ActionUpdateSigner      = "update-signer"
+	ActionRemoveSigners     = "remove-signers"
+	ActionSetProfile        = "set-profile"
+	ActionStoreBlob         = "store-blob"
+	ActionRecordConflict    = "record-conflict"
+	ActionDeactivate        = "deactivate-identity"
+	ActionSkip              = "skip"
+)
+
+// Mutation is a change indexing intends to make for an op, or a decision not
+// to make one
+type Mutation struct {
+	// Op is the index of the op among the tx's BAP ops
+	Op         int    `json:"op"`
+	Action     string `json:"action"`
+	Reason     string `json:"reason"`
+	Collection string `json:"collection,omitempty"`
+	ID         string `json:"id,omitempty"`
+
+	// write is nil for skips
+	write *mongo.UpdateOneModel
+}
+
+// plan works out the mutations for op without writing anything. Lookups see
+// bt's staged state before the database, and bt's view of the state is
+// updated so later ops in the batch see the planned changes.
+func plan(bt *batch, bobTx *bob.Tx, op signedOp) ([]Mutation, error) {
+	b := op.BapAip
+	// before anything else, so oversized ops are quarantined rather than
+	// held waiting for an identity
+	if err := oversized(b); err != nil {
+		return nil, err
+	}
+	id, err := bt.identityByAddress(b.Signature.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	mutation := func(action string, reason string, collection string, docID string, write *mongo.UpdateOneModel) Mutation {
+		return Mutation{Op: op.Index, Action: action, Reason: reason, Collection: collection, ID: docID, write: write}
+	}
+	noIdentity := func() error {
+		return &OpError{Type: b.BAP.Type, Reason: ErrNoIdentity.Error() + " " + b.Signature.Address, Err: ErrNoIdentity}
+	}
+
+	conflict := func(target *types.Identity, kind string, other string) Mutation {
+		c := types.Conflict{Type: kind, IDKey: other, Address: b.Signature.Address, Txid: bobTx.Tx.Tx.H, Block: bobTx.Tx.Blk.I}
+		if !slices.Contains(target.Conflicts, c) {
+			target.Conflicts = append(target.Conflicts, c)
+		}
+		update := bson.M{"$addToSet": bson.M{"conflicts": c}}
+		transition(target, update, bobTx, b, types.StatusDisputed, kind+" by "+c.Address)
+		return mutation(ActionRecordConflict, fmt.Sprintf("%s: %s signed an ID for %s", kind, c.Address, b.BAP.IDKey), "id", target.IDKey,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": target.IDKey}).
+				SetUpdate(update))
+	}
+	deactivated := func(id *types.Identity) []Mutation {
+		return []Mutation{mutation(ActionSkip, fmt.Sprintf("identity %s is deactivated", id.IDKey), "id", id.IDKey, nil)}
+	}
+
+	// a deactivated identity can still be claimed by another idKey, which is
+	// recorded as a conflict below, but signs nothing for itself
+	if id != nil && id.Status == types.StatusDeactivated && (b.BAP.Type != bap.ID || id.IDKey == b.BAP.IDKey) {
+		return deactivated(id), nil
+	}
+
+	switch b.BAP.Type {
+	case bap.ID:
+		// the current address of one identity claiming another idKey
+		var other *types.Identity
+		if id != nil && id.IDKey != b.BAP.IDKey {
+			other, id = id, nil
+		}
+
+		if id == nil {
+			if existing, err := bt.identity(b.BAP.IDKey); err != nil {
+				return nil, err
+			} else if existing != nil && claimedBy(existing, b.Signature.Address) {
+				return []Mutation{mutation(ActionSkip, "identity already exists under address "+existing.CurrentAddress, "id", existing.IDKey, nil)}, nil
+			} else if existing != nil {
+				return []Mutation{conflict(existing, types.ConflictDuplicateClaim, existing.IDKey)}, nil
+			}
+			if other == nil {
+				if other, err = bt.identityClaimedBy(b.Signature.Address); err != nil {
+					return nil, err
+				}
+			}
+
+			id = &types.Identity{
+				IDKey:          b.BAP.IDKey,
+				FirstSeen:      bobTx.Tx.Blk.I,
+				RootAddress:    b.Signature.Address,
+				CurrentAddress: b.BAP.Address,
+				Addresses: []types.Address{
+					{
+						Address: b.BAP.Address,
+						Txid:    bobTx.Tx.Tx.H,
+						Block:   bobTx.Tx.Blk.I,
+						Scheme:  b.Signature.Scheme,
+					},
+				},
+			}
+			transition(id, nil, bobTx, b, types.StatusActive, "created by "+id.RootAddress)
+			var conflicts []Mutation
+			if other != nil {
+				// recorded on both, the new identity gets it on insert
+				conflicts = append(conflicts, conflict(other, types.ConflictSharedRoot, id.IDKey))
+				id.Conflicts = []types.Conflict{{Type: types.ConflictSharedRoot, IDKey: other.IDKey, Address: b.Signature.Address, Txid: bobTx.Tx.Tx.H, Block: bobTx.Tx.Blk.I}}
+				transition(id, nil, bobTx, b, types.StatusDisputed, types.ConflictSharedRoot+" by "+b.Signature.Address)
+			}
+			bt.cacheIdentity(id)
+			return append([]Mutation{mutation(ActionCreateIdentity, "new identity with root address "+id.RootAddress, "id", id.IDKey,
+				mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"_id": id.IDKey}).
+					SetUpdate(bson.M{"$setOnInsert": id}).
+					SetUpsert(true))}, conflicts...), nil
+		} else if id.CurrentAddress == b.Signature.Address {
+			address := types.Address{
+				Address: b.BAP.Address,
+				Txid:    bobTx.Tx.Tx.H,
+				Block:   bobTx.Tx.Blk.I,
+				Scheme:  b.Signature.Scheme,
+			}
+			from := id.CurrentAddress
+			delete(bt.byAddress, id.CurrentAddress)
+			id.CurrentAddress = b.BAP.Address
+			if !slices.Contains(id.Addresses, address) {
+				id.Addresses = append(id.Addresses, address)
+			}
+			bt.cacheIdentity(id)
+
+			update := bson.M{
+				"$set":      bson.M{"currentAddress": b.BAP.Address},
+				"$addToSet": bson.M{"addresses": address},
+			}
+			action, reason := ActionRotateAddress, fmt.Sprintf("rotate from %s to %s", from, b.BAP.Address)
+			if unspendable(b.BAP.Address) {
+				// nobody holds the key, so the identity is retired
+				action, reason = ActionDeactivate, fmt.Sprintf("rotate from %s to unspendable address %s", from, b.BAP.Address)
+				transition(id, update, bobTx, b, types.StatusDeactivated, "rotated to unspendable address "+b.BAP.Address)
+			} else {
+				transition(id, update, bobTx, b, types.StatusRotated, "rotated to "+b.BAP.Address)
+			}
+			return []Mutation{mutation(action, reason, "id", id.IDKey,
+				mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"_id": id.IDKey}).
+					SetUpdate(update))}, nil
+		}
+		return []Mutation{mutation(ActionSkip, "signed by an address that is not current", "id", id.IDKey, nil)}, nil
+
+	case bap.ATTEST:
+		if id == nil {
+			return nil, noIdentity()
+		}
+		signer := &types.Signer{
+			IDKey:       id.IDKey,
+			Address:     b.Signature.Address,
+			Sequence:    b.BAP.Sequence,
+			Txid:        bobTx.Tx.Tx.H,
+			Block:       bobTx.Tx.Blk.I,
+			Timestamp:   bobTx.Tx.Blk.T,
+			Revoked:     false,
+			Scheme:      b.Signature.Scheme,
+			Vout:        b.Signature.Vout,
+			SigInstance: b.Signature.Instance,
+			Signature:   b.Signature.Value,
+			Message:     b.Signature.Message,
+		}
+		att, err := bt.attestation(b.BAP.URNHash)
+		if err != nil {
+			return nil, err
+		}
+		if att == nil {
+			att = &types.Attestation{
+				Id:      b.BAP.URNHash,
+				Signers: []*types.Signer{signer},
+			}
+			bt.attests[att.Id] = att
+			// staged as a copy, later ops in the batch change att.Signers
+			return []Mutation{mutation(ActionCreateAttestation, "first signer "+id.IDKey, "attest", att.Id,
+				mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"_id": att.Id}).
+					SetUpdate(bson.M{"$setOnInsert": bson.M{"signers": slices.Clone(att.Signers)}}).
+					SetUpsert(true))}, nil
+		}
+
+		for i, s := range att.Signers {
+			if s.IDKey == signer.IDKey {
+				if s.Sequence >= signer.Sequence {
+					return []Mutation{mutation(ActionSkip, fmt.Sprintf("bad sequence, signer %s is at %d, got %d", id.IDKey, s.Sequence, signer.Sequence), "attest", att.Id, nil)}, nil
+				}
+				att.Signers[i] = signer
+				// kept so a rewind below this block can restore it
+				replaced := types.ReplacedSigner{Signer: s, ReplacedAt: signer.Block}
+				att.Replaced = append(att.Replaced, replaced)
+				return []Mutation{mutation(ActionUpdateSigner, fmt.Sprintf("signer %s sequence %d replaces %d", id.IDKey, signer.Sequence, s.Sequence), "attest", att.Id,
+					mongo.NewUpdateOneModel().
+						SetFilter(bson.M{"_id": att.Id}).
+						SetUpdate(bson.M{
+							"$set":      bson.M{fmt.Sprintf("signers.%d", i): signer},
+							"$addToSet": bson.M{"replaced": replaced},
+						}))}, nil
+			}
+		}
+		att.Signers = append(att.Signers, signer)
+		return []Mutation{mutation(ActionAddSigner, "new signer "+id.IDKey, "attest", att.Id,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": att.Id}).
+				SetUpdate(bson.M{"$addToSet": bson.M{"signers": signer}}))}, nil
+
+	case bap.REVOKE:
+		if id == nil {
+			return nil, noIdentity()
+		}
+		if b.BAP.URNHash == id.IDKey {
+			// revoking its own idKey is how a compromised identity retires
+			update := bson.M{}
+			transition(id, update, bobTx, b, types.StatusDeactivated, "revoked by "+b.Signature.Address)
+			return []Mutation{mutation(ActionDeactivate, fmt.Sprintf("identity %s revoked by %s", id.IDKey, b.Signature.Address), "id", id.IDKey,
+				mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"_id": id.IDKey}).
+					SetUpdate(update))}, nil
+		}
+		att, err := bt.attestation(b.BAP.URNHash)
+		if err != nil {
+			return nil, err
+		}
+		if att == nil {
+			return []Mutation{mutation(ActionSkip, "attestation is not indexed", "attest", b.BAP.URNHash, nil)}, nil
+		}
+		revocation := types.Revocation{
+			IDKey:     id.IDKey,
+			Address:   b.Signature.Address,
+			Txid:      bobTx.Tx.Tx.H,
+			Block:     bobTx.Tx.Blk.I,
+			Timestamp: bobTx.Tx.Blk.T,
+			Sequence:  b.BAP.Sequence,
+		}
+		for _, s := range att.Signers {
+			if s.IDKey == id.IDKey && s.Sequence < b.BAP.Sequence {
+				revocation.Removed = append(revocation.Removed, s)
+			}
+		}
+		// a new slice, deleting in place would zero the tail of one already staged
+		att.Signers = slices.DeleteFunc(slices.Clone(att.Signers), func(s *types.Signer) bool {
+			return s.IDKey == id.IDKey && s.Sequence < b.BAP.Sequence
+		})
+		update := bson.M{
+			"$pull": bson.M{
+				"signers": bson.M{
+					"idKey":    id.IDKey,
+					"sequence": bson.M{"$lt": b.BAP.Sequence},
+				},
+			},
+		}
+		// a replayed REVOKE finds its signers gone, the first record of it
+		// keeps what it removed
+		if !slices.ContainsFunc(att.Revocations, func(r types.Revocation) bool {
+			return r.Txid == revocation.Txid && r.IDKey == revocation.IDKey && r.Sequence == revocation.Sequence
+		}) {
+			att.Revocations = append(slices.Clone(att.Revocations), revocation)
+			// kept so an address's REVOKEs can be listed and rewound
+			update["$addToSet"] = bson.M{"revocations": revocation}
+		}
+		return []Mutation{mutation(ActionRemoveSigners, fmt.Sprintf("remove signer %s below sequence %d", id.IDKey, b.BAP.Sequence), "attest", att.Id,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": att.Id}).
+				SetUpdate(update))}, nil
+
+	case bap.ALIAS:
+		id, rotated, err := aliasIdentity(bt, b, id)
+		if err != nil {
+			return nil, err
+		}
+		if id.Status == types.StatusDeactivated {
+			return deactivated(id), nil
+		}
+		if len(b.BAP.Profile) == 0 {
+			return nil, &OpError{Type: bap.ALIAS, Reason: "empty profile"}
+		}
+		prev, err := bt.profile(id.IDKey)
+		if err != nil {
+			return nil, err
+		}
+		if rotated != nil {
+			if rotated.Txid != bobTx.Tx.Tx.H && rotated.Block != bobTx.Tx.Blk.I {
+				return []Mutation{mutation(ActionSkip, fmt.Sprintf("signed by %s, rotated out at block %d", b.Signature.Address, rotated.Block), "profile", id.IDKey, nil)}, nil
+			}
+			if prev["signer"] == id.CurrentAddress {
+				return []Mutation{mutation(ActionSkip, "profile already set by current address "+id.CurrentAddress, "profile", id.IDKey, nil)}, nil
+			}
+		}
+		data := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(b.BAP.Profile), &data); err != nil {
+			return nil, &OpError{Type: bap.ALIAS, Reason: "invalid profile json: " + err.Error(), Err: err}
+		}
+		blobs := profile.ExtractMedia(data, config.Int("PROFILE_INLINE_MEDIA_MAX_BYTES", config.ProfileInlineMediaMaxBytes))
+		normalized, warnings := profile.Normalize(data)
+		if len(warnings) > 0 && config.Bool("PROFILE_STRICT", config.ProfileStrict) {
+			return nil, &OpError{Type: bap.ALIAS, Reason: "profile doesn't fit schema.org " + normalized.Type + ": " + strings.Join(warnings, "; ")}
+		}
+
+		mutations := make([]Mutation, 0, len(blobs)+1)
+		for _, blob := range blobs {
+			blob.Block, blob.Txid = bobTx.Tx.Blk.I, bobTx.Tx.Tx.H
+			if _, ok := bt.blobs[blob.Hash]; !ok {
+				bt.blobs[blob.Hash] = blob
+			}
+			// blobs are content addressed, the first ALIAS to publish one keeps it
+			mutations = append(mutations, mutation(ActionStoreBlob, fmt.Sprintf("%d byte %s moved out of the profile", blob.Size, blob.ContentType), config.BlobCollection, blob.Hash,
+				mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"_id": blob.Hash}).
+					SetUpdate(bson.M{"$setOnInsert": blob}).
+					SetUpsert(true)))
+		}
+		// block and txId let rewind find profiles set after a height. data is
+		// the profile as published except for the media ExtractMedia moved out.
+		fields := bson.M{"data": data, "normalized": normalized, "warnings": warnings, "block": bobTx.Tx.Blk.I, "txId": bobTx.Tx.Tx.H, "signer": b.Signature.Address}
+		// the profiles it replaces are kept so a rewind can put them back
+		if history := profileHistory(prev); prev != nil && prev["txId"] != bobTx.Tx.Tx.H {
+			replaced := bson.M{}
+			for k, v := range prev {
+				if k != "history" {
+					replaced[k] = v
+				}
+			}
+			fields["history"] = append(slices.Clone(history), replaced)
+		} else if len(history) > 0 {
+			fields["history"] = history
+		}
+		bt.profiles[id.IDKey] = fields
+		return append(mutations, mutation(ActionSetProfile, "profile set by "+id.IDKey, "profile", id.IDKey,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": id.IDKey}).
+				SetUpdate(bson.M{"$set": fields}).
+				SetUpsert(true))), nil
+	}
+
+	return []Mutation{mutation(ActionSkip, fmt.Sprintf("unknown op type %q", b.BAP.Type), "", "", nil)}, nil
+}
+
+// claimedBy reports whether address is the root address of id or one it
+// rotated to
+func claimedBy(id *types.Identity, address string) bool {
+	return id.RootAddress == address || slices.ContainsFunc(id.Addresses, func(a types.Address) bool {
+		return a.Address == address
+	})
+}
+
+// statusRank orders the lifecycle states. An identity only moves to a state
+// of the same or higher rank.
+var statusRank = map[string]int{
+	types.StatusActive:      0,
+	types.StatusRotated:     1,
+	types.StatusDisputed:    2,
+	types.StatusDeactivated: 3,
+}
+
+// transition moves id to status because of bobTx and adds the change to
+// update, if any. It does nothing when id is already in a higher state.
+func transition(id *types.Identity, update bson.M, bobTx *bob.Tx, b types.BapAip, status string, reason string) {
+	current := id.Status
+	if current == "" {
+		current = types.StatusActive
+	}
+	if statusRank[status] < statusRank[current] {
+		return
+	}
+
+	change := types.StatusChange{Status: status, Reason: reason, Op: string(b.BAP.Type), Signer: b.Signature.Address, Txid: bobTx.Tx.Tx.H, Block: bobTx.Tx.Blk.I, Timestamp: bobTx.Tx.Blk.T}
+	id.Status = status
+	if !slices.Contains(id.StatusHistory, change) {
+		id.StatusHistory = append(id.StatusHistory, change)
+	}
+	if update == nil {
+		return
+	}
+	for op, fields := range map[string]bson.M{"$set": {"status": status}, "$addToSet": {"statusHistory": change}} {
+		existing, ok := update[op].(bson.M)
+		if !ok {
+			existing = bson.M{}
+			update[op] = existing
+		}
+		for k, v := range fields {
+			existing[k] = v
+		}
+	}
+}
+
+// unspendable reports whether nobody can hold the key for address: it does
+// not parse, or it is the all-zero burn hash
+func unspendable(address string) bool {
+	a, err := script.NewAddressFromString(address)
+	if err != nil {
+		return true
+	}
+	for _, c := range a.PublicKeyHash {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// aliasIdentity resolves the identity an ALIAS op is for. id is the
+// identity whose current address signed it, if any. Otherwise the signing
+// address is looked up in the rotation history of the ALIAS's identity key,
+// and rotated is the address entry that replaced it.
+func aliasIdentity(bt *batch, b types.BapAip, id *types.Identity) (_ *types.Identity, rotated *types.Address, err error) {
+	if id != nil {
+		if id.IDKey != b.BAP.IDKey {
+			return nil, nil, &OpError{Type: bap.ALIAS, Reason: fmt.Sprintf("ALIAS for %s signed by identity %s", b.BAP.IDKey, id.IDKey)}
+		}
+		return id, nil, nil
+	}
+
+	if id, err = bt.identity(b.BAP.IDKey); err != nil {
+		return nil, nil, err
+	} else if id == nil {
+		return nil, nil, &OpError{Type: bap.ALIAS, Reason: ErrNoIdentity.Error() + " " + b.BAP.IDKey, Err: ErrNoIdentity}
+	}
+	if id.CurrentAddress == b.Signature.Address {
+		return id, nil, nil
+	}
+
+	// the root address signs the first address, each address the next. An
+	// address can come round again, the last rotation away from it counts.
+	signer := id.RootAddress
+	for i := range id.Addresses {
+		if signer == b.Signature.Address {
+			rotated = &id.Addresses[i]
+		}
+		signer = id.Addresses[i].Address
+	}
+	if rotated != nil {
+		return id, rotated, nil
+	}
+	return nil, nil, &OpError{Type: bap.ALIAS, Reason: fmt.Sprintf("ALIAS for %s signed by %s, which is not one of its addresses", b.BAP.IDKey, b.Signature.Address)}
+}
+
+// oversized returns an OpError for an op whose payload is over the size caps
+func oversized(b types.BapAip) error {
+	switch b.BAP.Type {
+	case bap.ATTEST, bap.REVOKE:
+		if len(b.BAP.URNHash) > config.AttestationHashMaxLength {
+			return &OpError{Type: b.BAP.Type, Reason: fmt.Sprintf("attestation hash is %d characters, over the limit of %d", len(b.BAP.URNHash), config.AttestationHashMaxLength)}
+		}
+	case bap.ALIAS:
+		if limit := config.PositiveInt("PROFILE_MAX_BYTES", config.ProfileMaxBytes); len(b.BAP.Profile) > limit {
+			return &OpError{Type: bap.ALIAS, Reason: fmt.Sprintf("profile is %d bytes, over the limit of %d", len(b.BAP.Profile), limit)}
+		}
+	}
+	return nil
+}
+
+// apply stages the writes of mutations planned against b
+func (b *batch) apply(bobTx *bob.Tx, mutations []Mutation) {
+	for _, m := range mutations {
+		switch m.Action {
+		case ActionAddSigner, ActionUpdateSigner, ActionRecordConflict, ActionDeactivate, ActionSkip:
+			log.Printf("%s %s: %s", m.Action, bobTx.Tx.Tx.H, m.Reason)
+		}
+		if m.Action == ActionRecordConflict {
+			metrics.IdentityConflicts.Inc()
+		}
+		if m.write != nil {
+			b.stage(m.Collection, m.ID, m.write)
+		}
+	}
+}
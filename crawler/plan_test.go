@@ -0,0 +1,447 @@
+package crawler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/bitcoinschema/go-bap"
+	"github.com/bitcoinschema/go-bob"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	testIDKey   = "3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+	testAddress = "134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"
+	testHash    = "b17c8e606afcf0d8dca65bdf8f33d275239438116557980203c82b0fae259838"
+)
+
+// testBatch is a batch that already knows the test identity and that the
+// test attestation doesn't exist, so planning never reads the database
+func testBatch() *batch {
+	bt := newBatch()
+	bt.cacheIdentity(&types.Identity{
+		IDKey:          testIDKey,
+		RootAddress:    testAddress,
+		CurrentAddress: testAddress,
+		Addresses:      []types.Address{{Address: testAddress, Block: 590000}},
+	})
+	bt.attests[testHash] = nil
+	return bt
+}
+
+// testTx is a tx at block with a txid derived from it
+func testTx(block uint32) *bob.Tx {
+	tx := &bob.Tx{}
+	tx.Tx.Tx.H = fmt.Sprintf("%064x", block)
+	tx.Tx.Blk.I = block
+	tx.Tx.Blk.T = 1565040000 + block
+	return tx
+}
+
+// testAttestOp is an ATTEST or REVOKE of testHash signed by testAddress
+func testAttestOp(kind bap.AttestationType, sequence uint64) signedOp {
+	sig := &types.Signature{Scheme: types.SchemeAIP, Address: testAddress, Valid: true}
+	return signedOp{BapAip: types.BapAip{
+		BAP:        &bap.Bap{Type: kind, URNHash: testHash, Sequence: sequence},
+		Signatures: []*types.Signature{sig},
+		Signature:  sig,
+	}}
+}
+
+// stagedSigners returns the signers a create-attestation mutation inserts
+func stagedSigners(t *testing.T, m Mutation) []*types.Signer {
+	t.Helper()
+	if m.write == nil {
+		t.Fatalf("%s has no write", m.Action)
+	}
+	update, ok := m.write.Update.(bson.M)
+	if !ok {
+		t.Fatalf("%s update is %T", m.Action, m.write.Update)
+	}
+	signers, _ := update["$setOnInsert"].(bson.M)["signers"].([]*types.Signer)
+	return signers
+}
+
+func TestPlanAttestThenRevokeKeepsStagedInsert(t *testing.T) {
+	bt := testBatch()
+
+	created, err := plan(bt, testTx(600000), testAttestOp(bap.ATTEST, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].Action != ActionCreateAttestation {
+		t.Fatalf("got %+v, want a create", created)
+	}
+
+	revoked, err := plan(bt, testTx(600001), testAttestOp(bap.REVOKE, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 1 || revoked[0].Action != ActionRemoveSigners {
+		t.Fatalf("got %+v, want a remove", revoked)
+	}
+	if n := len(bt.attests[testHash].Signers); n != 0 {
+		t.Errorf("batch view has %d signers after the revoke, want 0", n)
+	}
+
+	// the insert is flushed before the $pull, so it must still hold the signer
+	signers := stagedSigners(t, created[0])
+	if len(signers) != 1 || signers[0] == nil || signers[0].IDKey != testIDKey {
+		t.Errorf("staged insert is %+v, want the first signer", signers)
+	}
+}
+
+func TestPlanAttestSequence(t *testing.T) {
+	bt := testBatch()
+
+	steps := []struct {
+		kind     bap.AttestationType
+		sequence uint64
+		action   string
+		// signers is the sequence of each signer in the batch view after
+		signers []uint64
+	}{
+		{bap.ATTEST, 1, ActionCreateAttestation, []uint64{1}},
+		{bap.ATTEST, 2, ActionUpdateSigner, []uint64{2}},
+		{bap.ATTEST, 2, ActionSkip, []uint64{2}},
+		{bap.REVOKE, 3, ActionRemoveSigners, []uint64{}},
+	}
+	for i, step := range steps {
+		mutations, err := plan(bt, testTx(600000+uint32(i)), testAttestOp(step.kind, step.sequence))
+		if err != nil {
+			t.Fatalf("%s seq %d: %v", step.kind, step.sequence, err)
+		}
+		if len(mutations) != 1 || mutations[0].Action != step.action {
+			t.Fatalf("%s seq %d: got %+v, want %s", step.kind, step.sequence, mutations, step.action)
+		}
+		var got []uint64
+		for _, s := range bt.attests[testHash].Signers {
+			got = append(got, s.Sequence)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(step.signers) {
+			t.Errorf("%s seq %d: signer sequences %v, want %v", step.kind, step.sequence, got, step.signers)
+		}
+	}
+
+	att := bt.attests[testHash]
+	if len(att.Revocations) != 1 || att.Revocations[0].Sequence != 3 || att.Revocations[0].Address != testAddress {
+		t.Errorf("revocations %+v, want the seq 3 REVOKE", att.Revocations)
+	}
+}
+
+func TestRewindRestoresReplacedSigner(t *testing.T) {
+	bt := testBatch()
+	for i, op := range []signedOp{
+		testAttestOp(bap.ATTEST, 1),
+		testAttestOp(bap.ATTEST, 2),
+		testAttestOp(bap.ATTEST, 3),
+	} {
+		if _, err := plan(bt, testTx(600000+uint32(10*i)), op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	att := bt.attests[testHash]
+	if len(att.Replaced) != 2 {
+		t.Fatalf("replaced %+v, want seq 1 and 2", att.Replaced)
+	}
+
+	tests := []struct {
+		height   uint32
+		signers  []uint64
+		replaced int
+		restored int
+	}{
+		{600025, []uint64{3}, 2, 0},
+		{600015, []uint64{2}, 1, 1},
+		{600005, []uint64{1}, 0, 1},
+		{599999, []uint64{}, 0, 0},
+	}
+	for _, tt := range tests {
+		rewound := *att
+		restored := restoreSigners(&rewound, tt.height)
+		var got []uint64
+		for _, s := range rewound.Signers {
+			got = append(got, s.Sequence)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.signers) || len(rewound.Replaced) != tt.replaced || restored != tt.restored {
+			t.Errorf("rewind to %d: signers %v, %d replaced, %d restored, want %v, %d, %d", tt.height, got, len(rewound.Replaced), restored, tt.signers, tt.replaced, tt.restored)
+		}
+		if rewound.Signers == nil {
+			t.Errorf("rewind to %d: signers is nil, the empty attestation cleanup needs an array", tt.height)
+		}
+	}
+	if len(att.Signers) != 1 || att.Signers[0].Sequence != 3 {
+		t.Errorf("restoreSigners changed the signers it was given: %+v", att.Signers)
+	}
+}
+
+func TestRewindRestoresRevokedSigner(t *testing.T) {
+	bt := testBatch()
+	for _, step := range []struct {
+		block uint32
+		op    signedOp
+	}{
+		{600000, testAttestOp(bap.ATTEST, 1)},
+		{600010, testAttestOp(bap.REVOKE, 2)},
+		// replayed, the signer is already gone
+		{600010, testAttestOp(bap.REVOKE, 2)},
+		{600020, testAttestOp(bap.ATTEST, 3)},
+	} {
+		if _, err := plan(bt, testTx(step.block), step.op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	att := bt.attests[testHash]
+	if len(att.Revocations) != 1 || len(att.Revocations[0].Removed) != 1 || att.Revocations[0].Removed[0].Sequence != 1 {
+		t.Fatalf("revocations %+v, want one holding the seq 1 signer", att.Revocations)
+	}
+
+	tests := []struct {
+		height      uint32
+		signers     []uint64
+		revocations int
+		restored    int
+	}{
+		{600025, []uint64{3}, 1, 0},
+		{600015, []uint64{}, 1, 0},
+		{600005, []uint64{1}, 0, 1},
+		{599999, []uint64{}, 0, 0},
+	}
+	for _, tt := range tests {
+		rewound := *att
+		restored := restoreSigners(&rewound, tt.height)
+		got := []uint64{}
+		for _, s := range rewound.Signers {
+			got = append(got, s.Sequence)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.signers) || len(rewound.Revocations) != tt.revocations || restored != tt.restored {
+			t.Errorf("rewind to %d: signers %v, %d revocations, %d restored, want %v, %d, %d", tt.height, got, len(rewound.Revocations), restored, tt.signers, tt.revocations, tt.restored)
+		}
+	}
+}
+
+// signedBy is op signed by address
+func signedBy(address string, op *bap.Bap) signedOp {
+	sig := &types.Signature{Scheme: types.SchemeAIP, Address: address, Valid: true}
+	return signedOp{BapAip: types.BapAip{
+		BAP:        op,
+		Signatures: []*types.Signature{sig},
+		Signature:  sig,
+	}}
+}
+
+// testAliasOp is an ALIAS of testIDKey signed by address
+func testAliasOp(address string, name string) signedOp {
+	return signedBy(address, &bap.Bap{Type: bap.ALIAS, IDKey: testIDKey, Profile: fmt.Sprintf(`{"@type":"Person","name":%q}`, name)})
+}
+
+func TestRewindRestoresPreviousProfile(t *testing.T) {
+	bt := testBatch()
+	bt.profiles[testIDKey] = nil
+	for _, step := range []struct {
+		block uint32
+		name  string
+	}{
+		{600000, "first"},
+		{600010, "second"},
+		// replayed, it must not become its own history
+		{600010, "second"},
+		{600020, "third"},
+	} {
+		mutations, err := plan(bt, testTx(step.block), testAliasOp(testAddress, step.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mutations) != 1 || mutations[0].Action != ActionSetProfile {
+			t.Fatalf("ALIAS %s: got %+v, want a set profile", step.name, mutations)
+		}
+	}
+
+	// read back as Rewind finds it
+	raw, err := bson.Marshal(bt.profiles[testIDKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := bson.M{}
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(profileHistory(stored)); n != 2 {
+		t.Fatalf("history has %d profiles, want 2", n)
+	}
+
+	tests := []struct {
+		height  uint32
+		name    string
+		history int
+	}{
+		{600015, "second", 1},
+		{600005, "first", 0},
+		{599999, "", 0},
+	}
+	for _, tt := range tests {
+		restored := rewindProfile(stored, tt.height)
+		if tt.name == "" {
+			if restored != nil {
+				t.Errorf("rewind to %d: got %v, want no profile", tt.height, restored)
+			}
+			continue
+		}
+		if restored == nil {
+			t.Fatalf("rewind to %d: got no profile, want %s", tt.height, tt.name)
+		}
+		data, _ := restored["data"].(bson.M)
+		if data["name"] != tt.name || len(profileHistory(restored)) != tt.history {
+			t.Errorf("rewind to %d: got %v with %d in history, want %s with %d", tt.height, data["name"], len(profileHistory(restored)), tt.name, tt.history)
+		}
+	}
+}
+
+func TestPlanAliasFromRotatedAddress(t *testing.T) {
+	// testAddress is also the first address of the test identity, the
+	// rotation away from it at 600010 is the one that counts
+	const rotatedTo = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+	rotation := testTx(600010)
+	// another tx in the rotation's block
+	sameBlock := testTx(600010)
+	sameBlock.Tx.Tx.H = fmt.Sprintf("%064x", 1)
+
+	type step struct {
+		signer string
+		tx     *bob.Tx
+		action string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		// signer of the profile after the steps
+		signer string
+	}{
+		{"same tx as the rotation", []step{{testAddress, rotation, ActionSetProfile}}, testAddress},
+		{"same block as the rotation", []step{{testAddress, sameBlock, ActionSetProfile}}, testAddress},
+		{"block after the rotation", []step{{testAddress, testTx(600011), ActionSkip}}, ""},
+		{"current address first", []step{
+			{rotatedTo, sameBlock, ActionSetProfile},
+			{testAddress, rotation, ActionSkip},
+		}, rotatedTo},
+		{"current address last", []step{
+			{testAddress, rotation, ActionSetProfile},
+			{rotatedTo, sameBlock, ActionSetProfile},
+		}, rotatedTo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt := testBatch()
+			bt.profiles[testIDKey] = nil
+			mutations, err := plan(bt, rotation, signedBy(testAddress, &bap.Bap{Type: bap.ID, IDKey: testIDKey, Address: rotatedTo}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mutations) != 1 || mutations[0].Action != ActionRotateAddress {
+				t.Fatalf("got %+v, want a rotation", mutations)
+			}
+			// no identity has the old address as current, without asking the database
+			bt.byAddress[testAddress] = ""
+
+			for i, s := range tt.steps {
+				mutations, err := plan(bt, s.tx, testAliasOp(s.signer, fmt.Sprint(i)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(mutations) != 1 || mutations[0].Action != s.action {
+					t.Fatalf("ALIAS %d by %s: got %+v, want %s", i, s.signer, mutations, s.action)
+				}
+			}
+			if signer, _ := bt.profiles[testIDKey]["signer"].(string); signer != tt.signer {
+				t.Errorf("profile set by %q, want %q", signer, tt.signer)
+			}
+		})
+	}
+}
+
+func TestPlanIDConflicts(t *testing.T) {
+	const (
+		otherAddress = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+		otherIDKey   = "2bgSBeh8YxVR7u4qV5eyBjuKbYXJ"
+		thirdIDKey   = "4cRTBfhq6Fn5GVrKNasP1UaH7oAw"
+	)
+	id := func(idKey string, address string) *bap.Bap {
+		return &bap.Bap{Type: bap.ID, IDKey: idKey, Address: address}
+	}
+
+	t.Run("same idKey from another root address", func(t *testing.T) {
+		bt := testBatch()
+		// otherAddress is nobody's current address, without asking the database
+		bt.byAddress[otherAddress] = ""
+		mutations, err := plan(bt, testTx(600000), signedBy(otherAddress, id(testIDKey, otherAddress)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mutations) != 1 || mutations[0].Action != ActionRecordConflict || mutations[0].ID != testIDKey {
+			t.Fatalf("got %+v, want a conflict on %s", mutations, testIDKey)
+		}
+		existing := bt.ids[testIDKey]
+		if len(existing.Conflicts) != 1 || existing.Conflicts[0].Type != types.ConflictDuplicateClaim || existing.Conflicts[0].Address != otherAddress {
+			t.Errorf("conflicts %+v, want the duplicate claim by %s", existing.Conflicts, otherAddress)
+		}
+		if existing.Status != types.StatusDisputed {
+			t.Errorf("status %q, want disputed", existing.Status)
+		}
+	})
+
+	tests := []struct {
+		name string
+		// rotate moves the test identity off its root address first
+		rotate bool
+	}{
+		{"root address is current", false},
+		{"root address rotated out", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt := testBatch()
+			bt.ids[otherIDKey], bt.ids[thirdIDKey] = nil, nil
+			if tt.rotate {
+				if _, err := plan(bt, testTx(599000), signedBy(testAddress, id(testIDKey, otherAddress))); err != nil {
+					t.Fatal(err)
+				}
+				bt.byAddress[testAddress] = ""
+			}
+
+			for i, idKey := range []string{otherIDKey, thirdIDKey} {
+				mutations, err := plan(bt, testTx(600000+uint32(i)), signedBy(testAddress, id(idKey, fmt.Sprintf("1Address%d", i))))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(mutations) != 2 || mutations[0].Action != ActionCreateIdentity || mutations[1].Action != ActionRecordConflict || mutations[1].ID != testIDKey {
+					t.Fatalf("%s: got %+v, want a create and a conflict on %s", idKey, mutations, testIDKey)
+				}
+				created := bt.ids[idKey]
+				if len(created.Conflicts) != 1 || created.Conflicts[0].Type != types.ConflictSharedRoot || created.Conflicts[0].IDKey != testIDKey {
+					t.Errorf("%s: conflicts %+v, want the shared root with %s", idKey, created.Conflicts, testIDKey)
+				}
+				// the new identity gets its conflict on insert
+				if inserted := mutations[0].write.Update.(bson.M)["$setOnInsert"].(*types.Identity); len(inserted.Conflicts) != 1 {
+					t.Errorf("%s: inserted with conflicts %+v", idKey, inserted.Conflicts)
+				}
+				if created.Status != types.StatusDisputed {
+					t.Errorf("%s: status %q, want disputed", idKey, created.Status)
+				}
+			}
+
+			var others []string
+			for _, c := range bt.ids[testIDKey].Conflicts {
+				if c.Type == types.ConflictSharedRoot {
+					others = append(others, c.IDKey)
+				}
+			}
+			if fmt.Sprint(others) != fmt.Sprint([]string{otherIDKey, thirdIDKey}) {
+				t.Errorf("%s has shared root conflicts with %v, want both new idKeys", testIDKey, others)
+			}
+			if bt.ids[testIDKey].Status != types.StatusDisputed {
+				t.Errorf("%s: status %q, want disputed", testIDKey, bt.ids[testIDKey].Status)
+			}
+		})
+	}
+}
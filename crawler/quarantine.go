@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/database"
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-bob"
+	"github.com/jpillora/backoff"
+	"github.com/ttacon/chalk"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// withRetry runs fn until it succeeds, fails with a non transient error or
+// config.TransientRetries attempts have been made
+func withRetry(fn func() error) (err error) {
+	b := &backoff.Backoff{
+		Min:    config.RetryMinDelay,
+		Max:    config.RetryMaxDelay,
+		Factor: 2,
+		Jitter: true,
+	}
+	for attempt := 1; ; attempt++ {
+		if err = fn(); !isTransient(err) || attempt >= config.TransientRetries {
+			return err
+		}
+		d := b.Duration()
+		log.Printf("%s[RETRY %d/%d]: %v, retrying in %s%s", chalk.Yellow, attempt, config.TransientRetries, err, d, chalk.Reset)
+		metrics.TransientRetries.Inc()
+		time.Sleep(d)
+	}
+}
+
+// quarantinedOps flattens err into the ops to record. Anything other than a
+// *TxError is a tx level failure.
+func quarantinedOps(err error) []types.QuarantinedOp {
+	var txErr *TxError
+	if !errors.As(err, &txErr) {
+		return []types.QuarantinedOp{{Index: -1, Reason: err.Error()}}
+	}
+
+	ops := make([]types.QuarantinedOp, 0, len(txErr.Ops))
+	for i, opErr := range txErr.Ops {
+		op := types.QuarantinedOp{Index: i, Reason: opErr.Error()}
+		var oe *OpError
+		if errors.As(opErr, &oe) {
+			op.Type = string(oe.Type)
+			op.Reason = oe.Reason
+		}
+		var expired *ExpiredError
+		if errors.As(opErr, &expired) {
+			op.ParkedAt = expired.ParkedAt
+			op.ExpiredAt = expired.ExpiredAt
+			op.Reason = fmt.Sprintf("%s, waited from block %d to %d", op.Reason, expired.ParkedAt, expired.ExpiredAt)
+		}
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Index < ops[j].Index })
+	return ops
+}
+
+// quarantine records the failed ops of a tx in config.QuarantineCollection,
+// replacing the failures of any previous attempt. Txs over
+// config.QuarantineMaxRawTx are recorded without their bytes.
+func quarantine(txid string, rawtx []byte, height uint32, timestamp uint32, err error) {
+	ops := quarantinedOps(err)
+	log.Printf("%s[QUARANTINE]: %s at block %d: %v%s", chalk.Magenta, txid, height, err, chalk.Reset)
+
+	raw := ""
+	if len(rawtx) <= config.QuarantineMaxRawTx {
+		raw = hex.EncodeToString(rawtx)
+	}
+
+	coll := database.GetConnection().Database("bap").Collection(config.QuarantineCollection)
+	if err := withRetry(func() error {
+		_, err := coll.UpdateOne(ctx,
+			bson.M{"_id": txid},
+			bson.M{
+				"$set": bson.M{
+					"block":         height,
+					"timestamp":     timestamp,
+					"rawTx":         raw,
+					"ops":           ops,
+					"quarantinedAt": time.Now(),
+				},
+				"$inc": bson.M{"attempts": 1},
+			},
+			options.Update().SetUpsert(true),
+		)
+		return err
+	}); err != nil {
+		log.Printf("%s[ERROR]: failed to quarantine %s: %v%s", chalk.Red, txid, err, chalk.Reset)
+		return
+	}
+	metrics.Quarantined.Add(float64(len(ops)))
+}
+
+// Reprocess applies the quarantined ops of txid again. The tx leaves
+// quarantine when every op applies; otherwise its record is updated with the
+// remaining failures, which are returned.
+func Reprocess(txid string) error {
+	coll := database.GetConnection().Database("bap").Collection(config.QuarantineCollection)
+
+	var q types.Quarantine
+	if err := coll.FindOne(ctx, bson.M{"_id": txid}).Decode(&q); err != nil {
+		return err
+	}
+
+	if q.RawTx == "" {
+		return fmt.Errorf("quarantined tx %s was too large to keep, reindex block %d instead", txid, q.Block)
+	}
+	rawtx, err := hex.DecodeString(q.RawTx)
+	if err != nil {
+		return fmt.Errorf("decoding quarantined tx: %w", err)
+	}
+
+	if err = reapply(rawtx, &q); err != nil {
+		quarantine(txid, rawtx, q.Block, q.Timestamp, err)
+		return err
+	}
+
+	_, err = coll.DeleteOne(ctx, bson.M{"_id": txid})
+	return err
+}
+
+func reapply(rawtx []byte, q *types.Quarantine) error {
+	t, err := transaction.NewTransactionFromBytes(rawtx)
+	if err != nil {
+		return fmt.Errorf("decoding tx: %w", err)
+	}
+	bobTx, err := bob.NewFromTx(t)
+	if err != nil {
+		return fmt.Errorf("parsing bob tx: %w", err)
+	}
+	bobTx.Blk.I = q.Block
+	bobTx.Blk.T = q.Timestamp
+
+	// only retry the ops that failed, unless the whole tx did
+	var only map[int]bool
+	for _, op := range q.Ops {
+		if op.Index < 0 {
+			only = nil
+			break
+		}
+		if only == nil {
+			only = map[int]bool{}
+		}
+		only[op.Index] = true
+	}
+	return reprocessOps(bobTx, t, only)
+}
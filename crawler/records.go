@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/persist"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Block files are NDJSON with one record per line: the final state of a
+// document written by the block, plus the collection it belongs to, e.g.
+//
+//	{"collection":"id","_id":"<idKey>","currentAddress":"1...",...}
+//
+// Lines are MongoDB relaxed extended JSON so numbers keep their types. A
+// file is ready to ingest once the dumper makes it read-only.
+
+// blockFile is the path of the block file for height
+func blockFile(height uint32) string {
+	return filepath.Join(config.DataDir, fmt.Sprintf("%d.json", height))
+}
+
+// readyBlockFiles returns the heights of the ready block files in dir,
+// lowest first
+func readyBlockFiles(dir string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	heights := make([]uint32, 0)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		height, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || info.Mode().Perm()&0222 != 0 {
+			// still being written
+			continue
+		}
+		heights = append(heights, uint32(height))
+	}
+	slices.Sort(heights)
+	return heights, nil
+}
+
+// records returns the final state of every document b wrote
+func (b *batch) records() ([]bson.M, error) {
+	records := make([]bson.M, 0)
+	for _, name := range b.order {
+		for _, id := range b.touched[name] {
+			var doc interface{}
+			switch name {
+			case "id":
+				if identity := b.ids[id]; identity != nil {
+					doc = identity
+				}
+			case "attest":
+				if att := b.attests[id]; att != nil {
+					doc = att
+				}
+			case "profile":
+				profile := bson.M{"_id": id}
+				for k, v := range b.profiles[id] {
+					profile[k] = v
+				}
+				doc = profile
+			case config.BlobCollection:
+				if blob := b.blobs[id]; blob != nil {
+					doc = blob
+				}
+			}
+			if doc == nil {
+				continue
+			}
+
+			raw, err := bson.Marshal(doc)
+			if err != nil {
+				return nil, err
+			}
+			record := bson.M{}
+			if err := bson.Unmarshal(raw, &record); err != nil {
+				return nil, err
+			}
+			record["collection"] = name
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// dump writes the records of b to the block file for height and marks it
+// ready
+func (b *batch) dump(height uint32) error {
+	records, err := b.records()
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	path := blockFile(height)
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0222 == 0 {
+		// dumped by a previous run and not ingested yet
+		return nil
+	}
+	// drop a partial file left by an interrupted run
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, record := range records {
+		line, err := bson.MarshalExtJSON(record, false, false)
+		if err != nil {
+			return err
+		}
+		if err := persist.SaveLine(path, json.RawMessage(line)); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(path, 0444)
+}
+
+// recordSchemas check a record against its target collection before it is
+// ingested
+var recordSchemas = map[string]func(raw bson.Raw) error{
+	"id": func(raw bson.Raw) error {
+		var id types.Identity
+		if err := bson.Unmarshal(raw, &id); err != nil {
+			return err
+		}
+		if id.IDKey == "" || id.RootAddress == "" || id.CurrentAddress == "" {
+			return fmt.Errorf("identity needs _id, rootAddress and currentAddress")
+		}
+		for _, a := range id.Addresses {
+			if a.Address == "" || a.Txid == "" {
+				return fmt.Errorf("identity address needs address and txId")
+			}
+		}
+		return nil
+	},
+	"attest": func(raw bson.Raw) error {
+		var att types.Attestation
+		if err := bson.Unmarshal(raw, &att); err != nil {
+			return err
+		}
+		if att.Id == "" {
+			return fmt.Errorf("attestation needs _id")
+		}
+		for _, s := range att.Signers {
+			if s == nil || s.IDKey == "" || s.Txid == "" {
+				return fmt.Errorf("attestation signer needs idKey and txId")
+			}
+		}
+		return nil
+	},
+	"profile": func(raw bson.Raw) error {
+		var profile struct {
+			IDKey string `bson:"_id"`
+			Data  bson.M `bson:"data"`
+		}
+		if err := bson.Unmarshal(raw, &profile); err != nil {
+			return err
+		}
+		if profile.IDKey == "" || profile.Data == nil {
+			return fmt.Errorf("profile needs _id and data")
+		}
+		return nil
+	},
+	config.BlobCollection: func(raw bson.Raw) error {
+		var blob types.Blob
+		if err := bson.Unmarshal(raw, &blob); err != nil {
+			return err
+		}
+		if blob.Hash == "" || len(blob.Data) != blob.Size {
+			return fmt.Errorf("blob needs _id and data of its size")
+		}
+		return nil
+	},
+}
+
+// parseRecord decodes a block file line and checks it against the schema of
+// its collection
+func parseRecord(line []byte) (collection string, doc bson.M, err error) {
+	if err = bson.UnmarshalExtJSON(line, false, &doc); err != nil {
+		return
+	}
+	collection, _ = doc["collection"].(string)
+	validate, ok := recordSchemas[collection]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown collection %q", doc["collection"])
+	}
+	delete(doc, "collection")
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return "", nil, err
+	}
+	if err = validate(raw); err != nil {
+		return "", nil, err
+	}
+	return
+}
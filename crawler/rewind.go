@@ -0,0 +1,321 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/state"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/ttacon/chalk"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RewindResult counts what Rewind removed
+type RewindResult struct {
+	Height               uint32 `json:"height"`
+	IdentitiesDeleted    int64  `json:"identitiesDeleted"`
+	IdentitiesRolledBack int64  `json:"identitiesRolledBack"`
+	ConflictsRolledBack  int64  `json:"conflictsRolledBack"`
+	StatusesRolledBack   int64  `json:"statusesRolledBack"`
+	AttestationsUpdated  int64  `json:"attestationsUpdated"`
+	SignersRestored      int64  `json:"signersRestored"`
+	AttestationsDeleted  int64  `json:"attestationsDeleted"`
+	ProfilesRestored     int64  `json:"profilesRestored"`
+	ProfilesDeleted      int64  `json:"profilesDeleted"`
+	BlobsDeleted         int64  `json:"blobsDeleted"`
+	QuarantineDeleted    int64  `json:"quarantineDeleted"`
+}
+
+// Rewind removes every effect of blocks above height and sets _state to
+// height, so crawling resumes from there. It is idempotent; if interrupted,
+// run it again. The crawler must not be running.
+//
+// Signers an ATTEST or REVOKE above height replaced or removed are restored
+// from the attestation, and profiles an ALIAS above height replaced from the
+// profile's history.
+func Rewind(ctx context.Context, height uint32) (*RewindResult, error) {
+	res := &RewindResult{Height: height}
+	after := bson.M{"$gt": height}
+
+	// signers replaced or revoked after height come back, before the pull
+	// below drops their replacements
+	atColl := collection("attest")
+	var replaced []types.Attestation
+	cursor, err := atColl.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"replaced.replacedAt": after},
+		bson.M{"revocations.block": after},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &replaced); err != nil {
+		return nil, err
+	}
+	for _, att := range replaced {
+		res.SignersRestored += int64(restoreSigners(&att, height))
+		set, unset := bson.M{"signers": att.Signers}, bson.M{}
+		if len(att.Replaced) > 0 {
+			set["replaced"] = att.Replaced
+		} else {
+			unset["replaced"] = ""
+		}
+		if len(att.Revocations) > 0 {
+			set["revocations"] = att.Revocations
+		} else {
+			unset["revocations"] = ""
+		}
+		update := bson.M{"$set": set}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		if _, err := atColl.UpdateOne(ctx, bson.M{"_id": att.Id}, update); err != nil {
+			return nil, fmt.Errorf("restoring replaced signers: %w", err)
+		}
+	}
+
+	// attestations lose the signers added after height
+	updated, err := atColl.UpdateMany(ctx,
+		bson.M{"signers.block": after},
+		bson.M{"$pull": bson.M{"signers": bson.M{"block": after}}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("rewinding attestations: %w", err)
+	}
+	res.AttestationsUpdated = updated.ModifiedCount
+	// attestations left with no signers go, unless they keep revocations
+	deleted, err := atColl.DeleteMany(ctx, bson.M{
+		"signers":       bson.M{"$size": 0},
+		"revocations.0": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("deleting empty attestations: %w", err)
+	}
+	res.AttestationsDeleted = deleted.DeletedCount
+
+	// identities created after height go, the rest lose later rotations
+	idColl := collection("id")
+	if deleted, err = idColl.DeleteMany(ctx, bson.M{"firstSeen": after}); err != nil {
+		return nil, fmt.Errorf("deleting identities: %w", err)
+	}
+	res.IdentitiesDeleted = deleted.DeletedCount
+
+	var rotated []struct {
+		IDKey string `bson:"_id"`
+	}
+	cursor, err = idColl.Find(ctx, bson.M{"addresses.block": after})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &rotated); err != nil {
+		return nil, err
+	}
+	if len(rotated) > 0 {
+		idKeys := make([]string, 0, len(rotated))
+		for _, r := range rotated {
+			idKeys = append(idKeys, r.IDKey)
+		}
+		if _, err := idColl.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": idKeys}},
+			bson.M{"$pull": bson.M{"addresses": bson.M{"block": after}}},
+		); err != nil {
+			return nil, fmt.Errorf("rewinding identity addresses: %w", err)
+		}
+		// addresses are appended in chain order, so the last one left is current
+		if _, err := idColl.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": idKeys}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{
+				"currentAddress": bson.M{"$arrayElemAt": bson.A{"$addresses.address", -1}},
+			}}}},
+		); err != nil {
+			return nil, fmt.Errorf("restoring current addresses: %w", err)
+		}
+		res.IdentitiesRolledBack = int64(len(idKeys))
+	}
+
+	// conflicts claimed after height
+	if updated, err = idColl.UpdateMany(ctx,
+		bson.M{"conflicts.block": after},
+		bson.M{"$pull": bson.M{"conflicts": bson.M{"block": after}}},
+	); err != nil {
+		return nil, fmt.Errorf("rewinding identity conflicts: %w", err)
+	}
+	res.ConflictsRolledBack = updated.ModifiedCount
+
+	// status transitions after height, the last one left is the status
+	if updated, err = idColl.UpdateMany(ctx,
+		bson.M{"statusHistory.block": after},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"statusHistory": bson.M{"$filter": bson.M{
+					"input": "$statusHistory",
+					"cond":  bson.M{"$lte": bson.A{"$$this.block", height}},
+				}},
+			}}},
+			{{Key: "$set", Value: bson.M{
+				"status": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$statusHistory.status", -1}}, types.StatusActive}},
+			}}},
+		},
+	); err != nil {
+		return nil, fmt.Errorf("rewinding identity statuses: %w", err)
+	}
+	res.StatusesRolledBack = updated.ModifiedCount
+
+	// profiles set after height go back to the one before, or go when there
+	// was none
+	proColl := collection("profile")
+	var profiles []bson.M
+	cursor, err = proColl.Find(ctx, bson.M{"block": after})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, err
+	}
+	for _, fields := range profiles {
+		filter := bson.M{"_id": fields["_id"]}
+		if restored := rewindProfile(fields, height); restored != nil {
+			if _, err := proColl.ReplaceOne(ctx, filter, restored); err != nil {
+				return nil, fmt.Errorf("restoring profile: %w", err)
+			}
+			res.ProfilesRestored++
+			continue
+		}
+		if _, err := proColl.DeleteOne(ctx, filter); err != nil {
+			return nil, fmt.Errorf("deleting profile: %w", err)
+		}
+		res.ProfilesDeleted++
+	}
+
+	// blobs keep the block of the first ALIAS to publish them, so the blobs
+	// of the profiles left were published at or below height
+	if deleted, err = collection(config.BlobCollection).DeleteMany(ctx, bson.M{"block": after}); err != nil {
+		return nil, fmt.Errorf("deleting blobs: %w", err)
+	}
+	res.BlobsDeleted = deleted.DeletedCount
+
+	if deleted, err = collection(config.QuarantineCollection).DeleteMany(ctx, bson.M{"block": after}); err != nil {
+		return nil, fmt.Errorf("deleting quarantine: %w", err)
+	}
+	res.QuarantineDeleted = deleted.DeletedCount
+
+	if err := newBatch().flush(height); err != nil {
+		return nil, fmt.Errorf("saving progress: %w", err)
+	}
+	return res, nil
+}
+
+// restoreSigners rolls att's signers back to height: signers added after
+// height go and the ones they replaced, or that REVOKEs after height removed,
+// come back. It returns how many came back.
+func restoreSigners(att *types.Attestation, height uint32) (restored int) {
+	signers := slices.DeleteFunc(append([]*types.Signer{}, att.Signers...), func(s *types.Signer) bool {
+		return s.Block > height
+	})
+	var kept []types.ReplacedSigner
+	for _, r := range att.Replaced {
+		switch {
+		case r.ReplacedAt <= height:
+			kept = append(kept, r)
+		case r.Signer.Block <= height:
+			// the signature att had at height
+			signers = append(signers, r.Signer)
+			restored++
+		}
+	}
+	var revocations []types.Revocation
+	for _, r := range att.Revocations {
+		if r.Block <= height {
+			revocations = append(revocations, r)
+			continue
+		}
+		for _, s := range r.Removed {
+			if s.Block <= height {
+				signers = append(signers, s)
+				restored++
+			}
+		}
+	}
+	att.Signers, att.Replaced, att.Revocations = signers, kept, revocations
+	return restored
+}
+
+// rewindProfile returns the profile fields at height from the history kept
+// in fields, set by an ALIAS above height, or nil when there was no profile
+// at height
+func rewindProfile(fields bson.M, height uint32) bson.M {
+	history := profileHistory(fields)
+	// history is in chain order
+	for i := len(history) - 1; i >= 0; i-- {
+		if profileBlock(history[i]) > height {
+			continue
+		}
+		restored := bson.M{}
+		for k, v := range history[i] {
+			restored[k] = v
+		}
+		if i > 0 {
+			restored["history"] = slices.Clone(history[:i])
+		}
+		return restored
+	}
+	return nil
+}
+
+// profileHistory returns the profiles fields replaced, oldest first
+func profileHistory(fields bson.M) []bson.M {
+	switch history := fields["history"].(type) {
+	case []bson.M:
+		return history
+	case bson.A:
+		// as read back from the database
+		entries := make([]bson.M, 0, len(history))
+		for _, entry := range history {
+			if entry, ok := entry.(bson.M); ok {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+	return nil
+}
+
+// profileBlock returns the block of the ALIAS that set fields
+func profileBlock(fields bson.M) uint32 {
+	switch block := fields["block"].(type) {
+	case uint32:
+		return block
+	case int64:
+		return uint32(block)
+	case int32:
+		return uint32(block)
+	}
+	return 0
+}
+
+// Reindex rewinds to the block before from and crawls again up to and
+// including to, or until parent is cancelled when to is 0
+func Reindex(parent context.Context, from uint32, to uint32) (*RewindResult, error) {
+	if from == 0 || (to > 0 && to < from) {
+		return nil, fmt.Errorf("invalid range %d-%d", from, to)
+	}
+	if current, err := state.ReadProgress(); err != nil {
+		return nil, err
+	} else if from > current+1 {
+		return nil, fmt.Errorf("block %d is past the indexed height %d", from, current)
+	}
+
+	res, err := Rewind(parent, from-1)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%sRewound to block %d, reindexing from %d%s", chalk.Yellow, from-1, from, chalk.Reset)
+
+	stopAt = to
+	defer func() { stopAt = 0 }()
+	SyncBlocks(parent, int(from-1))
+	return res, nil
+}
@@ -0,0 +1,263 @@
+package crawler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	bsm "github.com/bitcoin-sv/go-sdk/compat/bsm"
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-aip"
+	"github.com/bitcoinschema/go-bap"
+	"github.com/bitcoinschema/go-bob"
+	"github.com/bitcoinschema/go-bpu"
+	"github.com/bitcoinschema/go-sigma"
+)
+
+// ErrUnsigned is returned for a BAP op without a valid signature
+var ErrUnsigned = errors.New("no valid signature")
+
+// parseBapAip returns the BAP ops of bobTx that are covered by at least one
+// AIP or Sigma signature in the same output. Sigma signatures and AIP
+// signatures without field indexes cover every tape before them; AIP
+// signatures with field indexes cover the BAP tapes whose fields are all
+// signed.
+func parseBapAip(bobTx *bob.Tx) []types.BapAip {
+	baps := make([]types.BapAip, 0)
+	for vout, out := range bobTx.Out {
+		var ops []types.BapAip
+		var opTapes []int
+		sigmaInstance := 0
+		for index, tape := range out.Tape {
+			if len(tape.Cell) == 0 || tape.Cell[0].S == nil {
+				continue
+			}
+
+			var sig *types.Signature
+			switch *tape.Cell[0].S {
+			case bap.Prefix:
+				if bapOut, err := bap.NewFromTape(&out.Tape[index]); err == nil {
+					ops = append(ops, types.BapAip{BAP: bapOut, Vout: vout})
+					opTapes = append(opTapes, index)
+				}
+				continue
+			case aip.Prefix:
+				sig = newAipSignature(out.Tape, vout, index)
+			case sigma.Prefix:
+				sig = newSigmaSignature(tape, vout, sigmaInstance)
+				sigmaInstance++
+			default:
+				continue
+			}
+
+			for i, t := range opTapes {
+				if covers(out.Tape, sig, t, index) {
+					ops[i].Signatures = append(ops[i].Signatures, sig)
+				}
+			}
+		}
+		for _, op := range ops {
+			if len(op.Signatures) > 0 {
+				baps = append(baps, op)
+			}
+		}
+	}
+	return baps
+}
+
+// newAipSignature parses the AIP tape at index and sets the data it signs
+func newAipSignature(tapes []bpu.Tape, vout, index int) *types.Signature {
+	a := aip.NewFromTape(tapes[index])
+
+	// field indexes follow the signature, FromTape pads them with zeros
+	a.Indices = nil
+	for _, cell := range tapes[index].Cell[min(4, len(tapes[index].Cell)):] {
+		if cell.S == nil {
+			continue
+		}
+		if i, err := strconv.Atoi(*cell.S); err == nil {
+			a.Indices = append(a.Indices, i)
+		}
+	}
+
+	sig := &types.Signature{
+		Scheme:   types.SchemeAIP,
+		Vout:     vout,
+		Instance: aipInstance(tapes, index),
+		Address:  a.AlgorithmSigningComponent,
+		Fields:   a.Indices,
+		AIP:      a,
+	}
+	if len(a.Indices) == 0 {
+		a.SetDataFromTapes(tapes, sig.Instance)
+	} else {
+		fields := outputFields(tapes)
+		a.Data = []string{fields[0]}
+		for _, i := range a.Indices {
+			if i > 0 && i < len(fields) {
+				a.Data = append(a.Data, fields[i])
+			}
+		}
+	}
+	return sig
+}
+
+// newSigmaSignature parses a Sigma tape
+func newSigmaSignature(tape bpu.Tape, vout, instance int) *types.Signature {
+	s := sigma.NewSigFromTape(tape, vout)
+	sig := &types.Signature{
+		Scheme:   types.SchemeSigma,
+		Vout:     vout,
+		Instance: instance,
+		Address:  s.Address,
+		Sigma:    s,
+	}
+	if len(tape.Cell) >= 5 {
+		vin := s.Vin
+		sig.Vin = &vin
+	}
+	return sig
+}
+
+// aipInstance counts the AIP prefixes before the tape at index, the way
+// SetDataFromTapes finds its instance
+func aipInstance(tapes []bpu.Tape, index int) (instance int) {
+	for _, tape := range tapes[:index] {
+		for _, cell := range tape.Cell {
+			if cell.S != nil && *cell.S == aip.Prefix {
+				instance++
+			}
+		}
+	}
+	return
+}
+
+// opReturnPos is the script position of the OP_RETURN starting the data
+func opReturnPos(tapes []bpu.Tape) uint8 {
+	if len(tapes) > 0 {
+		for _, cell := range tapes[0].Cell {
+			if cell.Op != nil && *cell.Op == 0x6a {
+				return cell.II
+			}
+		}
+	}
+	return 0
+}
+
+// outputFields returns the output's pushes by AIP field index: 0 is
+// OP_RETURN and the pipes between protocols count as fields
+func outputFields(tapes []bpu.Tape) []string {
+	start := opReturnPos(tapes)
+	fields := []string{"j"}
+	for _, tape := range tapes {
+		for _, cell := range tape.Cell {
+			if cell.II <= start {
+				continue
+			}
+			pos := int(cell.II - start)
+			for len(fields) < pos {
+				fields = append(fields, "|")
+			}
+			value := ""
+			if cell.S != nil {
+				value = *cell.S
+			}
+			fields = append(fields, value)
+		}
+	}
+	return fields
+}
+
+// covers reports whether sig, found at tape sigTape, signs the BAP tape at
+// bapTape
+func covers(tapes []bpu.Tape, sig *types.Signature, bapTape, sigTape int) bool {
+	if len(sig.Fields) == 0 {
+		return bapTape < sigTape
+	}
+	start := opReturnPos(tapes)
+	for _, cell := range tapes[bapTape].Cell {
+		if !slices.Contains(sig.Fields, int(cell.II)-int(start)) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifySignatures validates every signature covering b and attributes the
+// op to the first valid one, the nearest after it. Sigma signatures are
+// checked against t and fail when it is nil. It returns ErrUnsigned when
+// none verifies.
+func verifySignatures(b *types.BapAip, t *transaction.Transaction, record bool) error {
+	b.Signature = nil
+	for _, sig := range b.Signatures {
+		sig.Value, sig.Message = nil, nil
+		var valid bool
+		var err error
+		switch sig.Scheme {
+		case types.SchemeAIP:
+			if valid, err = sig.AIP.Validate(); valid {
+				sig.Value, _ = base64.StdEncoding.DecodeString(sig.AIP.Signature)
+				sig.Message = []byte(strings.Join(sig.AIP.Data, ""))
+			}
+		case types.SchemeSigma:
+			valid, err = verifySigma(sig, t)
+		}
+
+		failures := metrics.AIPFailures
+		if sig.Scheme == types.SchemeSigma {
+			failures = metrics.SigmaFailures
+		}
+		sig.Valid, sig.Error = err == nil && valid, ""
+		if err != nil {
+			sig.Error = err.Error()
+			if record {
+				failures.WithLabelValues("error").Inc()
+			}
+		} else if !valid {
+			sig.Error = "invalid " + sig.Scheme + " signature"
+			if record {
+				failures.WithLabelValues("invalid").Inc()
+			}
+		}
+		if sig.Valid && b.Signature == nil {
+			b.Signature = sig
+		}
+	}
+	if b.Signature == nil {
+		return ErrUnsigned
+	}
+	return nil
+}
+
+// verifySigma checks a Sigma signature over its output's data and the
+// outpoint of the input it is bound to, -1 meaning the input at the same
+// index as the output
+func verifySigma(sig *types.Signature, t *transaction.Transaction) (bool, error) {
+	if t == nil {
+		return false, errors.New("the raw tx is needed to verify a Sigma signature")
+	}
+	if sig.Vin == nil || len(sig.Sigma.Signature) == 0 {
+		return false, errors.New("malformed Sigma signature")
+	}
+	vin := *sig.Vin
+	if vin == -1 {
+		vin = sig.Vout
+	}
+	if vin < 0 || vin >= len(t.Inputs) {
+		return false, fmt.Errorf("Sigma signature bound to missing input %d", vin)
+	}
+
+	s := sigma.NewSigma(*t, sig.Vout, sig.Instance, vin)
+	s.SetHashes()
+	message := s.GetMessageHash()
+	if err := bsm.VerifyMessage(sig.Address, sig.Sigma.Signature, message); err != nil {
+		return false, nil
+	}
+	sig.Value, sig.Message = sig.Sigma.Signature, message
+	return true, nil
+}
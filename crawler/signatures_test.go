@@ -0,0 +1,378 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	bsm "github.com/bitcoin-sv/go-sdk/compat/bsm"
+	ec "github.com/bitcoin-sv/go-sdk/primitives/ec"
+	"github.com/bitcoin-sv/go-sdk/script"
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-bap"
+	"github.com/bitcoinschema/go-bob"
+	"github.com/bitcoinschema/go-sigma"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Mainnet ATTESTs signed with AIP by 134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da,
+// as raw hex and as BOB
+const (
+	attestTxid    = "98a5f6ef18eaea188bdfdc048f89a48af82627a15a76fd53584975f28ab3cc39"
+	attestBobTxid = "26b754e6fdf04121b8d91160a0b252a22ae30204fc552605b7f6d3f08419f29e"
+	attestSigner  = "134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"
+	attestHash    = "6386afa223e54d4f955e44a1ef4ae5b18bbb8689dff078627a7cb842fad4f7c6"
+	attestBobHash = "16ca90ce3c6347132adba40aa0d5faa3b2bf2015678ffc63db1511b676885e25"
+)
+
+func readTestdata(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// attestPushes returns the OP_RETURN pushes of attestTxid: the BAP tape, a
+// pipe and the AIP tape, which signs fields 0 to 5
+func attestPushes(t *testing.T) (*transaction.Transaction, [][]byte) {
+	t.Helper()
+	tx, err := transaction.NewTransactionFromHex(readTestdata(t, attestTxid+".hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := tx.Outputs[0].LockingScript.Chunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pushes [][]byte
+	for _, chunk := range chunks[1:] {
+		pushes = append(pushes, chunk.Data)
+	}
+	if len(pushes) != 9 || string(pushes[4]) != "|" {
+		t.Fatalf("unexpected output %s", tx.Outputs[0].LockingScript.ToASM())
+	}
+	return tx, pushes
+}
+
+// withPushes returns tx with its first output replaced by OP_RETURN pushes
+func withPushes(t *testing.T, tx *transaction.Transaction, pushes [][]byte) *bob.Tx {
+	t.Helper()
+	s := &script.Script{}
+	if err := s.AppendOpcodes(script.OpRETURN); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPushDataArray(pushes); err != nil {
+		t.Fatal(err)
+	}
+	tx = tx.ShallowClone()
+	tx.Outputs[0] = &transaction.TransactionOutput{LockingScript: s}
+	bobTx, err := bob.NewFromTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bobTx
+}
+
+// texts returns values as pushes
+func texts(values ...string) [][]byte {
+	var pushes [][]byte
+	for _, v := range values {
+		pushes = append(pushes, []byte(v))
+	}
+	return pushes
+}
+
+func TestOutputFields(t *testing.T) {
+	tx, pushes := attestPushes(t)
+	bobTx := withPushes(t, tx, pushes)
+
+	fields := outputFields(bobTx.Out[0].Tape)
+	want := []string{"j", bap.Prefix, string(bap.ATTEST), attestHash, "0", "|", "15PciHG22SNLQJXMoSUaWVi7WSqc7hCfva", "BITCOIN_ECDSA", attestSigner}
+	if len(fields) != 10 || !slices.Equal(fields[:9], want) {
+		t.Errorf("fields %q, want %q and the signature", fields, want)
+	}
+}
+
+// wantOp is a BAP op expected to be found signed, with the fields its
+// signature covers and whether it verifies
+type wantOp struct {
+	hash   string
+	fields []int
+	valid  bool
+}
+
+// checkSignatureValue checks that a valid sig carries a signature of its
+// message by its address, which signers and credentials are given, and that
+// an invalid one carries none
+func checkSignatureValue(t *testing.T, sig *types.Signature) {
+	t.Helper()
+	if !sig.Valid {
+		if sig.Value != nil || sig.Message != nil {
+			t.Errorf("invalid signature carries value %x over %x", sig.Value, sig.Message)
+		}
+		return
+	}
+	if err := bsm.VerifyMessage(sig.Address, sig.Value, sig.Message); err != nil {
+		t.Errorf("value %x over %x: %v", sig.Value, sig.Message, err)
+	}
+}
+
+func TestAipSignatures(t *testing.T) {
+	tx, pushes := attestPushes(t)
+	bap1, aipTape := pushes[:4], pushes[5:]
+	pipe := texts("|")
+	other := texts(bap.Prefix, string(bap.ATTEST), attestBobHash, "0")
+	concat := func(parts ...[][]byte) [][]byte { return slices.Concat(parts...) }
+
+	tests := []struct {
+		name string
+		tx   func(t *testing.T) *bob.Tx
+		ops  []wantOp
+	}{
+		{
+			name: "valid raw tx",
+			tx:   func(t *testing.T) *bob.Tx { return withPushes(t, tx, pushes) },
+			ops:  []wantOp{{attestHash, nil, true}},
+		},
+		{
+			name: "valid bob tx",
+			tx: func(t *testing.T) *bob.Tx {
+				bobTx, err := bob.NewFromString(readTestdata(t, attestBobTxid+".json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return bobTx
+			},
+			ops: []wantOp{{attestBobHash, nil, true}},
+		},
+		{
+			// the indexes name the fields the signature already signed, so it
+			// still verifies, and leave out the tape after it
+			name: "partial index",
+			tx: func(t *testing.T) *bob.Tx {
+				return withPushes(t, tx, concat(pushes, texts("1", "2", "3", "4", "5"), pipe, texts("B", "unsigned", "text/plain")))
+			},
+			ops: []wantOp{{attestHash, []int{1, 2, 3, 4, 5}, true}},
+		},
+		{
+			name: "index missing a BAP field",
+			tx: func(t *testing.T) *bob.Tx {
+				return withPushes(t, tx, concat(pushes, texts("1", "2", "3")))
+			},
+		},
+		{
+			name: "index over different data",
+			tx: func(t *testing.T) *bob.Tx {
+				return withPushes(t, tx, concat(pushes, texts("1", "2", "3", "4")))
+			},
+			ops: []wantOp{{attestHash, []int{1, 2, 3, 4}, false}},
+		},
+		{
+			// without indexes the signature covers both BAP tapes before it,
+			// but signed only the first
+			name: "multi BAP tape, unindexed",
+			tx: func(t *testing.T) *bob.Tx {
+				return withPushes(t, tx, concat(bap1, pipe, other, pipe, aipTape))
+			},
+			ops: []wantOp{
+				{attestHash, nil, false},
+				{attestBobHash, nil, false},
+			},
+		},
+		{
+			name: "multi BAP tape, indexed",
+			tx: func(t *testing.T) *bob.Tx {
+				return withPushes(t, tx, concat(bap1, pipe, other, pipe, aipTape, texts("1", "2", "3", "4", "5")))
+			},
+			ops: []wantOp{{attestHash, []int{1, 2, 3, 4, 5}, true}},
+		},
+		{
+			name: "BAP tape after the signature",
+			tx: func(t *testing.T) *bob.Tx {
+				return withPushes(t, tx, concat(pushes, pipe, other))
+			},
+			ops: []wantOp{{attestHash, nil, true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := parseBapAip(tt.tx(t))
+			if len(ops) != len(tt.ops) {
+				t.Fatalf("got %d signed ops, want %d", len(ops), len(tt.ops))
+			}
+			for i, want := range tt.ops {
+				op := ops[i]
+				if op.BAP.URNHash != want.hash {
+					t.Errorf("op %d is %s, want %s", i, op.BAP.URNHash, want.hash)
+				}
+				if len(op.Signatures) != 1 {
+					t.Fatalf("op %d has %d signatures, want 1", i, len(op.Signatures))
+				}
+				sig := op.Signatures[0]
+				if sig.Scheme != types.SchemeAIP || sig.Address != attestSigner || !slices.Equal(sig.Fields, want.fields) {
+					t.Errorf("op %d signature %+v, want AIP by %s over %v", i, sig, attestSigner, want.fields)
+				}
+
+				err := verifySignatures(&op, nil, false)
+				if want.valid && (err != nil || op.Signature != sig) {
+					t.Errorf("op %d: %v, want it attributed to the signature", i, err)
+				} else if !want.valid && (err != ErrUnsigned || sig.Valid || sig.Error == "") {
+					t.Errorf("op %d: %v, signature %+v, want it rejected", i, err, sig)
+				}
+				checkSignatureValue(t, sig)
+			}
+		})
+	}
+}
+
+// sigmaTx returns attestTxid with its first output replaced by the BAP tape
+// of the ATTEST, signed with Sigma by a fixed key and bound to input 0.
+// There is no Sigma signed BAP op among the mainnet vectors, so the
+// signature is made here.
+func sigmaTx(t *testing.T) (*transaction.Transaction, string) {
+	t.Helper()
+	tx, pushes := attestPushes(t)
+	s := &script.Script{}
+	if err := s.AppendOpcodes(script.OpRETURN); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPushDataArray(pushes[:4]); err != nil {
+		t.Fatal(err)
+	}
+	tx = tx.ShallowClone()
+	tx.Outputs[0] = &transaction.TransactionOutput{LockingScript: s}
+
+	seed := sha256.Sum256([]byte("go-bap-indexer sigma test key"))
+	key, _ := ec.PrivateKeyFromBytes(seed[:])
+	signed := sigma.NewSigma(*tx, 0, 0, 0).Sign(key)
+	if signed == nil {
+		t.Fatal("signing failed")
+	}
+	return signed.SignedTx, signed.Address
+}
+
+// replacePush returns a copy of the first output of tx with the push equal
+// to from replaced by to
+func replacePush(t *testing.T, tx *transaction.Transaction, from, to string) *transaction.Transaction {
+	t.Helper()
+	chunks, err := tx.Outputs[0].LockingScript.Chunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &script.Script{}
+	if err := s.AppendOpcodes(script.OpRETURN); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range chunks[1:] {
+		data := chunk.Data
+		if string(data) == from {
+			data = []byte(to)
+		}
+		if err := s.AppendPushData(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx = tx.ShallowClone()
+	tx.Outputs[0] = &transaction.TransactionOutput{LockingScript: s}
+	return tx
+}
+
+func TestSigmaSignatures(t *testing.T) {
+	signed, address := sigmaTx(t)
+
+	tests := []struct {
+		name string
+		tx   func(t *testing.T) *transaction.Transaction
+		// raw is false when verifying without the raw tx
+		raw    bool
+		reason string
+	}{
+		{
+			name: "valid",
+			tx:   func(t *testing.T) *transaction.Transaction { return signed },
+			raw:  true,
+		},
+		{
+			name:   "signed data changed",
+			tx:     func(t *testing.T) *transaction.Transaction { return replacePush(t, signed, attestHash, attestBobHash) },
+			raw:    true,
+			reason: "invalid",
+		},
+		{
+			// replaying the output in another tx spends a different outpoint
+			name: "bound input changed",
+			tx: func(t *testing.T) *transaction.Transaction {
+				tx := signed.ShallowClone()
+				tx.Inputs[0].SourceTxOutIndex++
+				return tx
+			},
+			raw:    true,
+			reason: "invalid",
+		},
+		{
+			name: "bound to a missing input",
+			tx: func(t *testing.T) *transaction.Transaction {
+				// the vin is the last push, after the signed data
+				chunks, _ := signed.Outputs[0].LockingScript.Chunks()
+				vin := string(chunks[len(chunks)-1].Data)
+				return replacePush(t, signed, vin, "7")
+			},
+			raw:    true,
+			reason: "error",
+		},
+		{
+			name:   "no raw tx",
+			tx:     func(t *testing.T) *transaction.Transaction { return signed },
+			reason: "error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.tx(t)
+			bobTx, err := bob.NewFromTx(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops := parseBapAip(bobTx)
+			if len(ops) != 1 || len(ops[0].Signatures) != 1 {
+				t.Fatalf("got %+v, want one op with one signature", ops)
+			}
+			op := ops[0]
+			sig := op.Signatures[0]
+			if sig.Scheme != types.SchemeSigma || sig.Address != address || sig.Vin == nil {
+				t.Fatalf("signature %+v, want Sigma by %s", sig, address)
+			}
+
+			if !tt.raw {
+				tx = nil
+			}
+			aipBefore := testutil.ToFloat64(metrics.AIPFailures.WithLabelValues(tt.reason))
+			sigmaBefore := testutil.ToFloat64(metrics.SigmaFailures.WithLabelValues(tt.reason))
+			err = verifySignatures(&op, tx, true)
+			if tt.reason == "" {
+				if err != nil || op.Signature != sig {
+					t.Errorf("%v, signature %+v, want it attributed to the signature", err, sig)
+				}
+				checkSignatureValue(t, sig)
+				return
+			}
+			if err != ErrUnsigned || sig.Valid || sig.Error == "" {
+				t.Errorf("%v, signature %+v, want it rejected", err, sig)
+			}
+			checkSignatureValue(t, sig)
+			if got := testutil.ToFloat64(metrics.SigmaFailures.WithLabelValues(tt.reason)) - sigmaBefore; got != 1 {
+				t.Errorf("counted %v Sigma %s failures, want 1", got, tt.reason)
+			}
+			if got := testutil.ToFloat64(metrics.AIPFailures.WithLabelValues(tt.reason)) - aipBefore; got != 0 {
+				t.Errorf("counted %v AIP %s failures, want 0", got, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-bob"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrInvalidTx is returned by SimulateRawTx for bytes that aren't a tx
+var ErrInvalidTx = errors.New("invalid transaction")
+
+// Simulation is what indexing a tx would do, worked out without writing
+// anything
+type Simulation struct {
+	Txid      string         `json:"txId"`
+	Block     uint32         `json:"block"`
+	Ops       []SimulatedOp  `json:"ops"`
+	Mutations []Mutation     `json:"mutations"`
+	Writes    []PlannedWrite `json:"writes"`
+}
+
+// SimulatedOp is a BAP op found in a tx
+type SimulatedOp struct {
+	Index    int    `json:"index"`
+	Type     string `json:"type"`
+	IDKey    string `json:"idKey,omitempty"`
+	Address  string `json:"address,omitempty"`
+	URNHash  string `json:"urnHash,omitempty"`
+	Sequence uint64 `json:"sequence"`
+	// Signer and Scheme are the signing address and signature scheme the op
+	// is attributed to
+	Signer string `json:"signer,omitempty"`
+	Scheme string `json:"scheme,omitempty"`
+	// Signatures are the AIP and Sigma signatures covering the op
+	Signatures []*types.Signature `json:"signatures"`
+	// Valid is false when no signature verifies
+	Valid bool `json:"valid"`
+	// Error explains why the op would be skipped or quarantined
+	Error string `json:"error,omitempty"`
+}
+
+// PlannedWrite is a database write a mutation would stage
+type PlannedWrite struct {
+	// Op and Action tie the write to its mutation
+	Op         int             `json:"op"`
+	Action     string          `json:"action"`
+	Collection string          `json:"collection"`
+	Filter     json.RawMessage `json:"filter" swaggertype:"object"`
+	Update     json.RawMessage `json:"update" swaggertype:"object"`
+	Upsert     bool            `json:"upsert,omitempty"`
+}
+
+// Simulate plans bobTx the way ProcessTx would. Lookups read the database;
+// nothing is written and no metrics are recorded.
+func Simulate(bobTx *bob.Tx, t *transaction.Transaction) (*Simulation, error) {
+	sim := &Simulation{
+		Txid:      bobTx.Tx.Tx.H,
+		Block:     bobTx.Tx.Blk.I,
+		Ops:       []SimulatedOp{},
+		Mutations: []Mutation{},
+		Writes:    []PlannedWrite{},
+	}
+
+	bt := newBatch()
+	for i, b := range parseBapAip(bobTx) {
+		op := SimulatedOp{
+			Index:    i,
+			Type:     string(b.BAP.Type),
+			IDKey:    b.BAP.IDKey,
+			Address:  b.BAP.Address,
+			URNHash:  b.BAP.URNHash,
+			Sequence: b.BAP.Sequence,
+		}
+
+		err := verifySignatures(&b, t, false)
+		op.Signatures = b.Signatures
+		if err != nil {
+			op.Error = err.Error()
+		} else {
+			op.Valid = true
+			op.Signer = b.Signature.Address
+			op.Scheme = b.Signature.Scheme
+			mutations, err := plan(bt, bobTx, signedOp{Index: i, BapAip: b})
+			if err != nil {
+				op.Error = err.Error()
+			}
+			for _, m := range mutations {
+				sim.Mutations = append(sim.Mutations, m)
+				if m.write == nil {
+					continue
+				}
+				w, err := plannedWrite(m)
+				if err != nil {
+					return nil, err
+				}
+				sim.Writes = append(sim.Writes, *w)
+			}
+		}
+		sim.Ops = append(sim.Ops, op)
+	}
+	return sim, nil
+}
+
+func plannedWrite(m Mutation) (*PlannedWrite, error) {
+	filter, err := bson.MarshalExtJSON(m.write.Filter, false, false)
+	if err != nil {
+		return nil, err
+	}
+	update, err := bson.MarshalExtJSON(m.write.Update, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return &PlannedWrite{
+		Op:         m.Op,
+		Action:     m.Action,
+		Collection: m.Collection,
+		Filter:     filter,
+		Update:     update,
+		Upsert:     m.write.Upsert != nil && *m.write.Upsert,
+	}, nil
+}
+
+// SimulateRawTx decodes rawtx as mined at height and blockTime and simulates
+// it
+func SimulateRawTx(rawtx []byte, height uint32, blockTime uint32) (*Simulation, error) {
+	t, err := transaction.NewTransactionFromBytes(rawtx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding tx: %v", ErrInvalidTx, err)
+	}
+	bobTx, err := bob.NewFromTx(t)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parsing bob tx: %v", ErrInvalidTx, err)
+	}
+	bobTx.Blk.I = height
+	bobTx.Blk.T = blockTime
+	return Simulate(bobTx, t)
+}
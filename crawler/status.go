@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of the crawler's connection and progress
+type Status struct {
+	// Running is true once Crawl has been called in this process
+	Running bool `json:"running"`
+	// Connection is the last JungleBus connection state seen by the event
+	// listener (connecting, connected, subscribing, subscribed, disconnected...)
+	Connection string `json:"connection"`
+	// LastBlock is the last block the listener finished
+	LastBlock uint32 `json:"lastBlock"`
+	// LastBlockAt is when LastBlock finished processing
+	LastBlockAt time.Time `json:"lastBlockAt"`
+}
+
+// Subscribed reports whether the crawler is receiving blocks from JungleBus
+func (s Status) Subscribed() bool {
+	return s.Running && s.Connection == "subscribed"
+}
+
+var status struct {
+	sync.RWMutex
+	Status
+}
+
+// CurrentStatus returns a snapshot of the crawler status
+func CurrentStatus() Status {
+	status.RLock()
+	defer status.RUnlock()
+	return status.Status
+}
+
+func setConnection(state string) {
+	status.Lock()
+	status.Connection = state
+	status.Unlock()
+}
+
+func setLastBlock(height uint32) {
+	status.Lock()
+	status.LastBlock = height
+	status.LastBlockAt = time.Now()
+	status.Unlock()
+}
@@ -1,9 +1,14 @@
 package crawler
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"time"
 
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/state"
 	"github.com/fsnotify/fsnotify"
 	"github.com/ttacon/chalk"
 )
@@ -27,8 +32,56 @@ import (
 // 	}
 // }
 
-// WatchFiles for changes in the data directory
-func WatchFiles(readyFiles chan string) {
+// IngestFiles ingests the block files written by a dumping crawler until ctx
+// is cancelled. The file being ingested at that point is finished first.
+func IngestFiles(ctx context.Context) {
+	readyFiles := make(chan string, 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Worker(readyFiles)
+	}()
+
+	WatchFiles(ctx, readyFiles)
+	close(readyFiles)
+	<-done
+}
+
+// WaitForIngest blocks until every ready block file has been ingested. The
+// dumper resolves lookups against MongoDB for blocks it didn't dump itself,
+// so it must not start ahead of the ingester.
+func WaitForIngest(ctx context.Context) error {
+	for {
+		progress, err := state.ReadProgress()
+		if err != nil {
+			return err
+		}
+		heights, err := readyBlockFiles(config.DataDir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		waiting := 0
+		for _, height := range heights {
+			if height > progress {
+				waiting++
+			}
+		}
+		if waiting == 0 {
+			return nil
+		}
+
+		log.Printf("%sWaiting for %d block files to be ingested%s", chalk.Yellow, waiting, chalk.Reset)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(config.DumpWaitInterval):
+		}
+	}
+}
+
+// WatchFiles for changes in the data directory until ctx is cancelled
+func WatchFiles(ctx context.Context, readyFiles chan string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		fmt.Printf("%s%s%s%s\n", chalk.Red, "Error: ", err, chalk.Reset)
@@ -36,10 +89,10 @@ func WatchFiles(readyFiles chan string) {
 	}
 	defer watcher.Close()
 
-	// Check if "data" directory exists
-	if _, err := os.Stat("data"); os.IsNotExist(err) {
+	// Check if the data directory exists
+	if _, err := os.Stat(config.DataDir); os.IsNotExist(err) {
 		// Create the directory if it doesn't exist
-		err := os.Mkdir("data", 0755)
+		err := os.Mkdir(config.DataDir, 0755)
 		if err != nil {
 			fmt.Printf("%s%s%s%s\n", chalk.Red, "Error creating data directory:", err, chalk.Reset)
 			return
@@ -49,7 +102,7 @@ func WatchFiles(readyFiles chan string) {
 	// Start watching the data directory
 	fmt.Println(chalk.Red, "Watching data folder...", chalk.Reset)
 
-	err = watcher.Add("data")
+	err = watcher.Add(config.DataDir)
 	if err != nil {
 		fmt.Printf("%s%s%s%s\n", chalk.Red, "Error: ", err, chalk.Reset)
 		return
@@ -57,6 +110,8 @@ func WatchFiles(readyFiles chan string) {
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case event := <-watcher.Events:
 			// Check if the file is ready for processing
 			if event.Op&fsnotify.Chmod == fsnotify.Chmod {
@@ -2,43 +2,91 @@ package crawler
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/BitcoinSchema/go-bap-indexer/config"
 	"github.com/BitcoinSchema/go-bap-indexer/database"
+	"github.com/BitcoinSchema/go-bap-indexer/persist"
+	"github.com/BitcoinSchema/go-bap-indexer/state"
 	"github.com/ttacon/chalk"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 var CONCURRENT_INSERTS = 32
 
-// Worker for processing files
+// Worker ingests ready block files in height order. Files at or below the
+// ingested height are leftovers from a crash and are removed. A file that
+// fails to ingest stops the worker from moving past it until a later rescan
+// succeeds, so _state never skips a block.
 func Worker(readyFiles chan string) {
-	for filename := range readyFiles {
-		// Process the file
-		ingest(filename)
-
-		// After successful import, delete the file
-		if config.DeleteAfterIngest {
-			err := os.Remove(filename)
-			if err != nil {
-				fmt.Printf("%s%s %s: %v%s\n", chalk.Cyan, "Error deleting file", filename, err, chalk.Reset)
+	ingestReady()
+
+	rescan := time.NewTicker(config.IngestRescan)
+	defer rescan.Stop()
+	for {
+		select {
+		case _, ok := <-readyFiles:
+			if !ok {
+				return
 			}
+		case <-rescan.C:
 		}
+		ingestReady()
 	}
 }
 
-// ingest JSONLD file and ingest each line as a mongo document
-func ingest(filepath string) {
+// ingestReady ingests every ready block file above the ingested height,
+// lowest first
+func ingestReady() {
+	progress, err := state.ReadProgress()
+	if err != nil {
+		log.Printf("%s[ERROR]: reading progress: %v%s", chalk.Red, err, chalk.Reset)
+		return
+	}
+
+	heights, err := readyBlockFiles(config.DataDir)
+	if err != nil {
+		log.Printf("%s[ERROR]: listing block files: %v%s", chalk.Red, err, chalk.Reset)
+		return
+	}
+
+	for _, height := range heights {
+		if height > progress {
+			if err := processBlockDoneEvent(height); err != nil {
+				log.Printf("%s[ERROR]: ingesting block %d: %v%s", chalk.Red, height, err, chalk.Reset)
+				return
+			}
+			progress = height
+		}
+		removeBlockFile(height)
+	}
+}
+
+func removeBlockFile(height uint32) {
+	if !config.DeleteAfterIngest {
+		return
+	}
+	filename := blockFile(height)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("%s%s %s: %v%s\n", chalk.Cyan, "Error deleting file", filename, err, chalk.Reset)
+	}
+}
+
+// ingest a block file, upserting each valid line into its collection. Lines
+// that fail validation are copied to RejectedDir. Lines for the same document
+// are written in file order; different documents are written with
+// CONCURRENT_INSERTS parallelism.
+func ingest(filepath string, height uint32) (ingested int, rejected int, err error) {
 	// Open the file
 	file, err := os.Open(filepath)
 	if err != nil {
-		log.Panicf("%s%s %s: %v%s\n", chalk.Cyan, "Error opening file", filepath, err, chalk.Reset)
-		return
+		return 0, 0, err
 	}
 	defer file.Close()
 
@@ -48,55 +96,82 @@ func ingest(filepath string) {
 	scanner.Buffer(buf, 10*1024*1024) // set the buffer to 10MB
 
 	var wg sync.WaitGroup
-	limiter := make(chan struct{}, CONCURRENT_INSERTS)
+	var errOnce sync.Once
+	var saveErr error
+	shards := make([]chan *record, CONCURRENT_INSERTS)
+	for i := range shards {
+		shards[i] = make(chan *record, 100)
+		wg.Add(1)
+		go func(records chan *record) {
+			defer wg.Done()
+			for r := range records {
+				if err := withRetry(func() error { return saveToMongo(r) }); err != nil {
+					errOnce.Do(func() { saveErr = err })
+				}
+			}
+		}(shards[i])
+	}
+
 	for scanner.Scan() {
-		// 1 - read each string line from the file path
-		line := scanner.Text()
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
 
-		// 2 - unmarshal into bmap
-		var bsonData bson.M
-		byteLine := []byte(line)
-		err := json.Unmarshal(byteLine, &bsonData)
+		collection, doc, err := parseRecord(line)
 		if err != nil {
-			log.Panicf("%s[Error]: %s%s\n", chalk.Cyan, err, chalk.Reset)
+			rejected++
+			rejectLine(height, line, err)
 			continue
 		}
 
-		limiter <- struct{}{}
-		wg.Add(1)
-		go func(bsonData *bson.M) {
-			defer func() {
-				<-limiter
-				wg.Done()
-			}()
-			// 3 - insert into mongo
-			err = saveToMongo(bsonData)
-			if err != nil {
-				log.Panicf("%s[Error]: %s%s\n", chalk.Cyan, err, chalk.Reset)
-			}
-		}(&bsonData)
+		// the same document always lands on the same shard
+		h := fnv.New32a()
+		fmt.Fprintf(h, "%s/%v", collection, doc["_id"])
+		shards[h.Sum32()%uint32(len(shards))] <- &record{collection: collection, doc: doc}
+		ingested++
+	}
+	for _, records := range shards {
+		close(records)
 	}
-
 	wg.Wait()
 
 	// Check for errors in the scanner
 	if err := scanner.Err(); err != nil {
-		fmt.Printf("%sError reading file %s: %v%s\n", chalk.Cyan, filepath, err, chalk.Reset)
-		return
+		return ingested, rejected, fmt.Errorf("reading %s: %w", filepath, err)
 	}
+	return ingested, rejected, saveErr
+}
+
+// record is a validated block file line
+type record struct {
+	collection string
+	doc        bson.M
 }
 
-func saveToMongo(bsonData *bson.M) (err error) {
-	if bsonData == nil {
-		return fmt.Errorf("bsonData is nil")
+func rejectLine(height uint32, line []byte, reason error) {
+	log.Printf("%s[REJECTED]: block %d: %v%s", chalk.Magenta, height, reason, chalk.Reset)
+	rejectedFile := filepath.Join(config.RejectedDir, fmt.Sprintf("%d.json", height))
+	if err := persist.SaveLine(rejectedFile, map[string]interface{}{
+		"error": reason.Error(),
+		"line":  string(line),
+	}); err != nil {
+		log.Printf("%s[ERROR]: saving rejected line: %v%s", chalk.Red, err, chalk.Reset)
 	}
+}
+
+func saveToMongo(r *record) (err error) {
 	conn := database.GetConnection()
-	collectionName := (*bsonData)["collection"].(string)
-	delete(*bsonData, "collection")
 
-	filter := bson.M{"_id": (*bsonData)["_id"]}
+	filter := bson.M{"_id": r.doc["_id"]}
+	data := bson.M{}
+	for k, v := range r.doc {
+		if k != "_id" {
+			data[k] = v
+		}
+	}
 
-	_, err = conn.UpsertOne(collectionName, filter, *bsonData)
+	_, err = conn.UpsertOne(r.collection, filter, data)
 
 	return
 }
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
 	"github.com/bitcoinschema/go-bmap"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 const databaseName = "bap"
@@ -18,6 +21,9 @@ const databaseName = "bap"
 // Connection is a mongo client
 type Connection struct {
 	*mongo.Client
+
+	txnOnce sync.Once
+	txn     bool
 }
 
 var globalClient *Connection
@@ -38,7 +44,7 @@ func Connect() error {
 		bmapMongoURL = bmapMongoURL + "/"
 	}
 
-	clientOptions := options.Client().ApplyURI(bmapMongoURL).SetMaxPoolSize(100)
+	clientOptions := options.Client().ApplyURI(bmapMongoURL).SetMaxPoolSize(100).SetMonitor(metrics.MongoMonitor())
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		fmt.Println("Failed", err)
@@ -51,11 +57,21 @@ func Connect() error {
 	// 	}
 	// }()
 
-	globalClient = &Connection{client}
+	globalClient = &Connection{Client: client}
 
 	return nil
 }
 
+// Disconnect closes the global client, if one was opened
+func Disconnect(ctx context.Context) error {
+	if globalClient == nil {
+		return nil
+	}
+	err := globalClient.Client.Disconnect(ctx)
+	globalClient = nil
+	return err
+}
+
 func GetConnection() *Connection {
 	if globalClient == nil {
 		err := Connect()
@@ -66,16 +82,83 @@ func GetConnection() *Connection {
 	return globalClient
 }
 
+// Ping checks that the database is reachable
+func (c *Connection) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return c.Client.Ping(ctx, readpref.Primary())
+}
+
+// SupportsTransactions reports whether the server is a replica set member or
+// a mongos. Standalone servers reject multi-document transactions.
+func (c *Connection) SupportsTransactions(ctx context.Context) bool {
+	c.txnOnce.Do(func() {
+		var hello struct {
+			SetName string `bson:"setName"`
+			Msg     string `bson:"msg"`
+		}
+		if err := c.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+			log.Printf("[ERROR]: hello failed, writing without transactions: %v", err)
+			return
+		}
+		c.txn = hello.SetName != "" || hello.Msg == "isdbgrid"
+	})
+	return c.txn
+}
+
+// Atomically runs fn in a transaction when the server supports them, and
+// directly otherwise. fn must only use the ctx it is given.
+func (c *Connection) Atomically(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !c.SupportsTransactions(ctx) {
+		return fn(ctx)
+	}
+
+	session, err := c.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// indexes are the secondary indexes address lookups rely on, by collection
+var indexes = map[string][]string{
+	"attest":  {"signers.signingAddress", "replaced.signer.signingAddress", "revocations.address", "revocations.removed.signingAddress"},
+	"id":      {"rootAddress", "addresses.address", "conflicts.address"},
+	"profile": {"signer"},
+}
+
+// EnsureIndexes creates the indexes in indexes. Indexes that already exist
+// are left alone.
+func (c *Connection) EnsureIndexes(ctx context.Context) error {
+	for name, keys := range indexes {
+		models := make([]mongo.IndexModel, 0, len(keys))
+		for _, key := range keys {
+			models = append(models, mongo.IndexModel{Keys: bson.D{{Key: key, Value: 1}}})
+		}
+		if _, err := c.Database(databaseName).Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("creating %s indexes: %w", name, err)
+		}
+	}
+	return nil
+}
+
 func (c *Connection) ClearState() error {
 	collection := c.Database(databaseName).Collection("c")
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	return collection.Drop(ctx)
 }
 
 // GetDocs gets a number of documents for a given collection
 func (c *Connection) GetDocs(collectionName string, limit int64, skip int64, filter bson.M) ([]bmap.Tx, error) {
 	collection := c.Database(databaseName).Collection(collectionName)
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	cur, err := collection.Find(ctx, filter, &options.FindOptions{
 		Skip:  &skip,
 		Limit: &limit,
@@ -104,13 +187,14 @@ func (c *Connection) GetDocs(collectionName string, limit int64, skip int64, fil
 // GetStateDocs gets a number of documents for a given state collection
 func (c *Connection) GetStateDocs(collectionName string, limit int64, skip int64, filter bson.M) ([]bson.M, error) {
 	collection := c.Database(databaseName).Collection(collectionName)
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	cur, err := collection.Find(ctx, filter, &options.FindOptions{
 		Skip:  &skip,
 		Limit: &limit,
 	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer cur.Close(context.Background())
 	var txs []bson.M
@@ -134,7 +218,8 @@ func (c *Connection) GetStateDocs(collectionName string, limit int64, skip int64
 func (c *Connection) InsertOne(collectionName string, data bson.M) (interface{}, error) {
 
 	collection := c.Database(databaseName).Collection(collectionName)
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	res, err := collection.InsertOne(ctx, data)
 	if err != nil {
 		return 0, err
@@ -148,7 +233,8 @@ func (c *Connection) InsertOne(collectionName string, data bson.M) (interface{},
 func (c *Connection) Update(collectionName string, filter interface{}, update bson.M) (interface{}, error) {
 
 	collection := c.Database(databaseName).Collection(collectionName)
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	res, err := collection.UpdateMany(ctx, filter, update)
 	if err != nil {
 		return 0, err
@@ -162,7 +248,8 @@ func (c *Connection) Update(collectionName string, filter interface{}, update bs
 func (c *Connection) UpsertOne(collectionName string, filter interface{}, data bson.M) (interface{}, error) {
 
 	collection := c.Database(databaseName).Collection(collectionName)
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	opts := options.Update().SetUpsert(true)
 
 	update := bson.M{"$set": data}
@@ -179,7 +266,8 @@ func (c *Connection) UpsertOne(collectionName string, filter interface{}, data b
 func (c *Connection) Upsert(collectionName string, filter interface{}, update bson.M) (interface{}, error) {
 
 	collection := c.Database(databaseName).Collection(collectionName)
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	opts := options.Update().SetUpsert(true)
 
 	res, err := collection.UpdateOne(ctx, filter, update, opts)
@@ -193,7 +281,8 @@ func (c *Connection) Upsert(collectionName string, filter interface{}, update bs
 // CountCollectionDocs returns the number of records in a given colletion
 func (c *Connection) CountCollectionDocs(collectionName string, filter bson.M) (int64, error) {
 	collection := c.Database(databaseName).Collection(collectionName)
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 	count, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
 		return 0, err
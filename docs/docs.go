@@ -47,9 +47,273 @@ const docTemplate = `{
                 }
             }
         },
+        "/address/{address}": {
+            "get": {
+                "description": "Starts from a Bitcoin address: the identities it belongs or belonged to, the block ranges during which\nit was their current address, whether it is an active signing key now, and every BAP op it signed\n(ID, ATTEST, REVOKE and ALIAS). ATTESTs include signatures a later ATTEST replaced or a REVOKE removed.\nOnly the latest ALIAS of an identity is kept, so ALIAS ops a later profile replaced are not listed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "identity"
+                ],
+                "summary": "Get address activity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bitcoin address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Identities and ops of the address",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/server.AddressResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "No BAP activity for the address",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/quarantine": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Lists transactions with ops that could not be applied, most recent first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List quarantined transactions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Number of records to skip (default: 0)",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of records to return (default: 20, max: 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Quarantined transactions",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/types.Quarantine"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/quarantine/{txid}/reprocess": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Applies the failed ops of a quarantined transaction again. It leaves quarantine when they all apply.\nThe ops are applied on top of the block the crawler is staging, which is written together with them.\nNot available while dumping to files.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reprocess a quarantined transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transaction ID",
+                        "name": "txid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transaction applied and removed from quarantine",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Transaction not in quarantine",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "422": {
+                        "description": "Ops still failing, quarantine record updated",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/simulate": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Parses a raw transaction and plans what indexing it would do: each BAP op with its AIP validity, the mutations with reasons (created identity, rotated address, added signer, skipped: bad sequence, ...) and the database writes. Lookups read the index; nothing is written.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Simulate indexing a transaction",
+                "parameters": [
+                    {
+                        "description": "Transaction to simulate",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.SimulateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Planned mutations",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/crawler.Simulation"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or transaction",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
         "/attestation/get": {
             "post": {
-                "description": "Retrieves an attestation using its unique hash identifier",
+                "description": "Retrieves an attestation using its unique hash identifier. Each signer is marked with whether its\nidentity is valid as of the chain tip, signatures from deactivated identities are kept but not valid.",
                 "consumes": [
                     "application/json"
                 ],
@@ -83,7 +347,7 @@ const docTemplate = `{
                                     "type": "object",
                                     "properties": {
                                         "result": {
-                                            "$ref": "#/definitions/types.Attestation"
+                                            "$ref": "#/definitions/server.AttestationResponse"
                                         }
                                     }
                                 }
@@ -95,77 +359,1129 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/server.Response"
                         }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
                     }
                 }
             }
         },
-        "/person/{field}/{bapId}": {
-            "get": {
-                "description": "Get a specific field from a person's profile",
+        "/attestation/vc/verify": {
+            "post": {
+                "description": "Checks a credential from /v1/attestation/{hash}/vc against the index: the attestation and the issuer's\nsignature must be indexed as described, the proof value must verify against the signed message, the\nissuer must be valid now, and the signing address must have been the issuer's address when it signed.\nEach check is reported.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "application/json",
-                    "application/octet-stream"
+                    "application/json"
                 ],
                 "tags": [
-                    "person"
+                    "attestation"
                 ],
-                "summary": "Get person field",
+                "summary": "Verify an attestation credential",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Field name",
-                        "name": "field",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "BAP ID",
-                        "name": "bapId",
-                        "in": "path",
-                        "required": true
+                        "description": "Verifiable credential",
+                        "name": "credential",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/vc.Credential"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Whether the credential is valid, and the checks made",
                         "schema": {
-                            "$ref": "#/definitions/server.Response"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/vc.Verification"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "$ref": "#/definitions/server.Response"
-                        }
-                    },
-                    "404": {
-                        "description": "Not Found",
+                        "description": "Invalid credential",
                         "schema": {
                             "$ref": "#/definitions/server.Response"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "Server error",
                         "schema": {
                             "$ref": "#/definitions/server.Response"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "server.Response": {
-            "description": "Standard API response wrapper",
-            "type": "object",
-            "properties": {
-                "message": {
-                    "description": "Optional error message",
-                    "type": "string",
+        },
+        "/attestation/{hash}/vc": {
+            "get": {
+                "description": "Renders each signature of an attestation that hasn't been revoked as a W3C Verifiable Credential\n(JSON-LD). The issuer is the signer's did:bap:id identifier, the subject is the identity that signed\nthe attestation first, and the proof points at the on-chain signature by txid, output and instance and\ncarries its value and the message it signs.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "attestation"
+                ],
+                "summary": "Get attestation as verifiable credentials",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Attestation hash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "One credential per signer",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/vc.Credential"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Attestation not found",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/blob/{hash}": {
+            "get": {
+                "description": "Serves media moved out of a profile because it was too large to keep inline. Profiles reference it\nas blob://\u003csha256\u003e. Like image fields, it can be resized and converted, and only png, jpeg, gif and\nwebp images are served.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "profile"
+                ],
+                "summary": "Get profile blob",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "sha256 of the blob",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resize to this width in pixels",
+                        "name": "w",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resize to this height in pixels (with w, crops a thumbnail)",
+                        "name": "h",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "webp",
+                            "png",
+                            "jpeg"
+                        ],
+                        "type": "string",
+                        "description": "Output format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The image"
+                    },
+                    "304": {
+                        "description": "Not modified"
+                    },
+                    "400": {
+                        "description": "Invalid hash",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Blob not found",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "415": {
+                        "description": "Not a safe image type",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "422": {
+                        "description": "Image can't be transformed",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/identity/{idKey}/conflicts": {
+            "get": {
+                "description": "Lists the competing claims recorded on an identity: ID ops for its idKey signed by another root address\n(duplicate-claim), and other idKeys created by one of its addresses (shared-root)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "identity"
+                ],
+                "summary": "Get identity conflicts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Identity key",
+                        "name": "idKey",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Conflicts, empty when there are none",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/types.Conflict"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Identity not found",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/identity/{idKey}/trust": {
+            "get": {
+                "description": "Scores an identity over the attestation graph, starting from a set of trusted root identities.\nAn edge runs from each identity that co-signed an attestation to the identity that signed it first.\npageRank is the identity's personalized PageRank from the roots, pathScore is decay to the power of the\nnumber of attestations on the shortest path from a root, and path is that path.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "identity"
+                ],
+                "summary": "Get identity trust scores",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Identity key",
+                        "name": "idKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated idKeys of the trusted roots",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "PageRank damping, between 0 and 1 (default: 0.85)",
+                        "name": "damping",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Path score kept per hop, between 0 and 1 (default: 0.5)",
+                        "name": "decay",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Trust scores",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/server.TrustResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Missing roots or invalid parameters",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Identity not found",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/person/{field}/{bapId}": {
+            "get": {
+                "description": "Get a specific field from a person's profile. Image fields (image, logo, banner) are served as media,\nevery other field is returned as JSON, or as plain text when the client accepts text/plain.\nNested fields can be addressed with dots, e.g. homeLocation.name. Only png, jpeg, gif and webp images\nare served, whatever type the source declares.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/plain",
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "person"
+                ],
+                "summary": "Get person field",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Field name or dotted path",
+                        "name": "field",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "BAP ID, or the root address or an address of the identity",
+                        "name": "bapId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resize to this width in pixels",
+                        "name": "w",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resize to this height in pixels (with w, crops a thumbnail)",
+                        "name": "h",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "webp",
+                            "png",
+                            "jpeg"
+                        ],
+                        "type": "string",
+                        "description": "Output format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/policy/evaluate": {
+            "post": {
+                "description": "Checks a subject identity against a declarative policy: for each rule, how many signatures of the\nsubject's attestation of an attribute count, given trusted issuers, signature age and issuer validity.\nThe subject itself has to be valid unless the policy allows otherwise. Send JSON, or YAML with a\nyaml Content-Type. Claims give the attestation hash, or the attribute value and secret to derive it.",
+                "consumes": [
+                    "application/json",
+                    "application/yaml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "policy"
+                ],
+                "summary": "Evaluate an attestation policy",
+                "parameters": [
+                    {
+                        "description": "Subject, policy and claims",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.PolicyEvaluateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Pass or fail with the evidence for each rule",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/policy.Result"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or policy",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Subject identity not found",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/status": {
+            "get": {
+                "description": "Returns the indexed height, chain tip, lag, JungleBus connection state, last processed block and collection counts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "status"
+                ],
+                "summary": "Get indexer status",
+                "responses": {
+                    "200": {
+                        "description": "Indexer status",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/server.Response"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "result": {
+                                            "$ref": "#/definitions/server.StatusResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Server error",
+                        "schema": {
+                            "$ref": "#/definitions/server.Response"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "crawler.Mutation": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "collection": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "op": {
+                    "description": "Op is the index of the op among the tx's BAP ops",
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "crawler.PlannedWrite": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "collection": {
+                    "type": "string"
+                },
+                "filter": {
+                    "type": "object"
+                },
+                "op": {
+                    "description": "Op and Action tie the write to its mutation",
+                    "type": "integer"
+                },
+                "update": {
+                    "type": "object"
+                },
+                "upsert": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "crawler.SimulatedOp": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error explains why the op would be skipped or quarantined",
+                    "type": "string"
+                },
+                "idKey": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "scheme": {
+                    "type": "string"
+                },
+                "sequence": {
+                    "type": "integer"
+                },
+                "signatures": {
+                    "description": "Signatures are the AIP and Sigma signatures covering the op",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.Signature"
+                    }
+                },
+                "signer": {
+                    "description": "Signer and Scheme are the signing address and signature scheme the op\nis attributed to",
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "urnHash": {
+                    "type": "string"
+                },
+                "valid": {
+                    "description": "Valid is false when no signature verifies",
+                    "type": "boolean"
+                }
+            }
+        },
+        "crawler.Simulation": {
+            "type": "object",
+            "properties": {
+                "block": {
+                    "type": "integer"
+                },
+                "mutations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/crawler.Mutation"
+                    }
+                },
+                "ops": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/crawler.SimulatedOp"
+                    }
+                },
+                "txId": {
+                    "type": "string"
+                },
+                "writes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/crawler.PlannedWrite"
+                    }
+                }
+            }
+        },
+        "crawler.Status": {
+            "type": "object",
+            "properties": {
+                "connection": {
+                    "description": "Connection is the last JungleBus connection state seen by the event\nlistener (connecting, connected, subscribing, subscribed, disconnected...)",
+                    "type": "string"
+                },
+                "lastBlock": {
+                    "description": "LastBlock is the last block the listener finished",
+                    "type": "integer"
+                },
+                "lastBlockAt": {
+                    "description": "LastBlockAt is when LastBlock finished processing",
+                    "type": "string"
+                },
+                "running": {
+                    "description": "Running is true once Crawl has been called in this process",
+                    "type": "boolean"
+                }
+            }
+        },
+        "policy.Claim": {
+            "type": "object",
+            "properties": {
+                "hash": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "e2c6fb4063cc04af58935737eaffc938011dff546d47b7fbb18ed346f8c93d5c"
+                },
+                "value": {
+                    "type": "string",
+                    "example": "John Doe"
+                }
+            }
+        },
+        "policy.Evidence": {
+            "type": "object",
+            "properties": {
+                "block": {
+                    "type": "integer"
+                },
+                "counted": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "idKey": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string",
+                    "format": "base64"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "not a trusted issuer"
+                },
+                "revoked": {
+                    "description": "Revoked is always false, a REVOKE removes the signer instead, see\nAttestation.Revocations",
+                    "type": "boolean"
+                },
+                "scheme": {
+                    "description": "Scheme, Vout and SigInstance locate the signature that covered the op",
+                    "type": "string"
+                },
+                "sequence": {
+                    "type": "integer"
+                },
+                "sigInstance": {
+                    "type": "integer"
+                },
+                "signature": {
+                    "description": "Signature is the signature's value and Message the message it signs:\nthe signed fields for AIP, the input and data hash for Sigma",
+                    "type": "string",
+                    "format": "base64"
+                },
+                "signingAddress": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "integer"
+                },
+                "txId": {
+                    "type": "string"
+                },
+                "vout": {
+                    "type": "integer"
+                }
+            }
+        },
+        "policy.Policy": {
+            "type": "object",
+            "properties": {
+                "allowInvalidSubject": {
+                    "description": "AllowInvalidSubject passes a subject that is deactivated, or disputed\nwhere disputed identities aren't valid",
+                    "type": "boolean"
+                },
+                "match": {
+                    "description": "Match is \"all\" (default) or \"any\" of the rules",
+                    "type": "string",
+                    "example": "all"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "verified-name"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/policy.Rule"
+                    }
+                }
+            }
+        },
+        "policy.Result": {
+            "type": "object",
+            "properties": {
+                "pass": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "policy": {
+                    "type": "string",
+                    "example": "verified-name"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/policy.RuleResult"
+                    }
+                },
+                "subject": {
+                    "type": "string",
+                    "example": "3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+                },
+                "subjectReason": {
+                    "type": "string",
+                    "example": "identity is deactivated"
+                },
+                "subjectValid": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "policy.Rule": {
+            "type": "object",
+            "properties": {
+                "allowInvalidIssuers": {
+                    "description": "AllowInvalidIssuers counts signatures of issuers that are no longer\nvalid",
+                    "type": "boolean"
+                },
+                "attribute": {
+                    "type": "string",
+                    "example": "name"
+                },
+                "issuers": {
+                    "description": "Issuers lists the idKeys whose signatures count, any when empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "maxAge": {
+                    "description": "MaxAge drops signatures older than this (\"720h\", \"30d\", \"1y\")",
+                    "type": "string",
+                    "example": "1y"
+                },
+                "minSigners": {
+                    "description": "MinSigners is how many signatures have to count, 1 when unset",
+                    "type": "integer",
+                    "example": 2
+                },
+                "newestWithin": {
+                    "description": "NewestWithin fails the rule unless a counted signature is this recent",
+                    "type": "string",
+                    "example": "1y"
+                }
+            }
+        },
+        "policy.RuleResult": {
+            "type": "object",
+            "properties": {
+                "attribute": {
+                    "type": "string",
+                    "example": "name"
+                },
+                "counted": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "evidence": {
+                    "description": "Evidence lists every signature of the attestation and whether it\ncounted",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/policy.Evidence"
+                    }
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "pass": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "2 of 2 required signatures count"
+                },
+                "required": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "server.AddressIdentity": {
+            "description": "An identity the address is or was used by, and when it was the current address",
+            "type": "object",
+            "properties": {
+                "current": {
+                    "description": "Whether the address is the identity's current address",
+                    "type": "boolean",
+                    "example": true
+                },
+                "idKey": {
+                    "type": "string",
+                    "example": "714a3c856435781fb48ca16a4cf0ba9bc1ef16dd7abbc060d3e18e7e900eec9f"
+                },
+                "ranges": {
+                    "description": "Block ranges during which the address was the identity's current address",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.BlockRange"
+                    }
+                },
+                "root": {
+                    "description": "Whether the address signed the identity's first ID op",
+                    "type": "boolean",
+                    "example": false
+                },
+                "status": {
+                    "type": "string",
+                    "example": "active"
+                }
+            }
+        },
+        "server.AddressOp": {
+            "description": "A BAP op signed by the address",
+            "type": "object",
+            "properties": {
+                "address": {
+                    "description": "Address is the address an ID op moved the identity to",
+                    "type": "string",
+                    "example": "134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"
+                },
+                "block": {
+                    "type": "integer",
+                    "example": 590230
+                },
+                "hash": {
+                    "description": "Hash is the attestation hash of ATTEST and REVOKE ops",
+                    "type": "string",
+                    "example": "b17c8e606afcf0d8dca65bdf8f33d275239438116557980203c82b0fae259838"
+                },
+                "idKey": {
+                    "description": "IDKey is the identity the op was for",
+                    "type": "string",
+                    "example": "714a3c856435781fb48ca16a4cf0ba9bc1ef16dd7abbc060d3e18e7e900eec9f"
+                },
+                "note": {
+                    "description": "Note says how the op was indexed, e.g. that it was recorded as a conflict",
+                    "type": "string",
+                    "example": "duplicate-claim"
+                },
+                "sequence": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "txId": {
+                    "type": "string",
+                    "example": "1fd626dc8286d449d4c2cf3b5b70d169728f5ffefd5c3a3205d4970e21fbf187"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "ATTEST"
+                }
+            }
+        },
+        "server.AddressResponse": {
+            "description": "Identities an address belongs or belonged to, and the BAP ops it signed",
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "Whether the address is the current address of an identity that isn't deactivated",
+                    "type": "boolean",
+                    "example": true
+                },
+                "address": {
+                    "type": "string",
+                    "example": "134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"
+                },
+                "identities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.AddressIdentity"
+                    }
+                },
+                "ops": {
+                    "description": "Ops signed by the address, oldest first, unconfirmed last",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.AddressOp"
+                    }
+                }
+            }
+        },
+        "server.AttestationResponse": {
+            "description": "Attestation whose signers carry the validity of their identity as of the chain tip",
+            "type": "object",
+            "properties": {
+                "attribute": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "nonce": {
+                    "type": "string"
+                },
+                "revocations": {
+                    "description": "Revocations are the REVOKE ops that removed signers",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.Revocation"
+                    }
+                },
+                "signers": {
+                    "description": "Signers of the attestation. Signatures are kept when an identity is\ndeactivated, so check valid before counting one.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.AttestationSigner"
+                    }
+                },
+                "urn": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.AttestationSigner": {
+            "description": "Attestation signer and the validity of its identity as of the chain tip",
+            "type": "object",
+            "properties": {
+                "block": {
+                    "type": "integer"
+                },
+                "idKey": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string",
+                    "format": "base64"
+                },
+                "reason": {
+                    "description": "Why the identity is not valid",
+                    "type": "string",
+                    "example": "identity is deactivated"
+                },
+                "revoked": {
+                    "description": "Revoked is always false, a REVOKE removes the signer instead, see\nAttestation.Revocations",
+                    "type": "boolean"
+                },
+                "scheme": {
+                    "description": "Scheme, Vout and SigInstance locate the signature that covered the op",
+                    "type": "string"
+                },
+                "sequence": {
+                    "type": "integer"
+                },
+                "sigInstance": {
+                    "type": "integer"
+                },
+                "signature": {
+                    "description": "Signature is the signature's value and Message the message it signs:\nthe signed fields for AIP, the input and data hash for Sigma",
+                    "type": "string",
+                    "format": "base64"
+                },
+                "signingAddress": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "integer"
+                },
+                "txId": {
+                    "type": "string"
+                },
+                "valid": {
+                    "description": "Whether the signer's identity is valid",
+                    "type": "boolean",
+                    "example": true
+                },
+                "vout": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.BlockRange": {
+            "description": "Span of blocks, to is unset while still open",
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "integer",
+                    "example": 590194
+                },
+                "to": {
+                    "type": "integer",
+                    "example": 600000
+                }
+            }
+        },
+        "server.PolicyEvaluateRequest": {
+            "description": "Subject, policy and the subject's attestation claims, as JSON or YAML",
+            "type": "object",
+            "properties": {
+                "claims": {
+                    "description": "Subject's attestation of each attribute the rules name, by attribute",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/policy.Claim"
+                    }
+                },
+                "policy": {
+                    "description": "Policy to evaluate",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/policy.Policy"
+                        }
+                    ]
+                },
+                "subject": {
+                    "description": "idKey of the identity the policy is checked for",
+                    "type": "string",
+                    "example": "3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+                }
+            }
+        },
+        "server.Response": {
+            "description": "Standard API response wrapper",
+            "type": "object",
+            "properties": {
+                "message": {
+                    "description": "Optional error message",
+                    "type": "string",
                     "example": "Operation completed successfully"
                 },
                 "result": {
@@ -178,29 +1494,235 @@ const docTemplate = `{
                 }
             }
         },
-        "types.Attestation": {
+        "server.SimulateRequest": {
+            "description": "Request format for simulating a transaction",
             "type": "object",
             "properties": {
-                "attribute": {
+                "block": {
+                    "description": "Block height to simulate the tx at (optional)",
+                    "type": "integer",
+                    "example": 761173
+                },
+                "rawTx": {
+                    "description": "Raw transaction, hex encoded",
+                    "type": "string",
+                    "example": "0100000001..."
+                },
+                "timestamp": {
+                    "description": "Block time to simulate the tx at (optional)",
+                    "type": "integer",
+                    "example": 1665592880
+                }
+            }
+        },
+        "server.StatusResponse": {
+            "description": "Sync status of the indexer",
+            "type": "object",
+            "properties": {
+                "chainTip": {
+                    "description": "Chain tip as last reported by JungleBus",
+                    "type": "integer",
+                    "example": 875002
+                },
+                "collections": {
+                    "description": "Document counts per collection",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "crawler": {
+                    "description": "Crawler connection state and last processed block",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/crawler.Status"
+                        }
+                    ]
+                },
+                "indexedHeight": {
+                    "description": "Height stored in the _state collection",
+                    "type": "integer",
+                    "example": 875000
+                },
+                "lag": {
+                    "description": "Blocks between the chain tip and the indexed height",
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "server.TrustResponse": {
+            "description": "Trust scores of an identity over the attestation graph",
+            "type": "object",
+            "properties": {
+                "from": {
+                    "description": "Trusted roots the scores start from",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "idKey": {
+                    "description": "Identity scored",
+                    "type": "string",
+                    "example": "3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+                },
+                "pageRank": {
+                    "description": "Personalized PageRank from the roots, scores of all identities add up to 1",
+                    "type": "number",
+                    "example": 0.042
+                },
+                "path": {
+                    "description": "Shortest chain of attestations from a root",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/trust.Edge"
+                    }
+                },
+                "pathScore": {
+                    "description": "decay to the power of the length of path, 1 for a root, 0 when unreachable",
+                    "type": "number",
+                    "example": 0.25
+                }
+            }
+        },
+        "trust.Edge": {
+            "type": "object",
+            "properties": {
+                "from": {
                     "type": "string"
                 },
                 "hash": {
                     "type": "string"
                 },
-                "nonce": {
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.Conflict": {
+            "type": "object",
+            "properties": {
+                "address": {
                     "type": "string"
                 },
-                "signers": {
+                "block": {
+                    "type": "integer"
+                },
+                "idKey": {
+                    "type": "string"
+                },
+                "txId": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.Quarantine": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "block": {
+                    "type": "integer"
+                },
+                "ops": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/types.Signer"
+                        "$ref": "#/definitions/types.QuarantinedOp"
                     }
                 },
-                "urn": {
+                "quarantinedAt": {
                     "type": "string"
                 },
-                "value": {
+                "rawTx": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "integer"
+                },
+                "txId": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.QuarantinedOp": {
+            "type": "object",
+            "properties": {
+                "expiredAt": {
+                    "type": "integer"
+                },
+                "index": {
+                    "description": "Index of the op among the tx's BAP ops, -1 when the whole tx failed",
+                    "type": "integer"
+                },
+                "parkedAt": {
+                    "description": "ParkedAt and ExpiredAt are the blocks an op waited for its identity\nbetween, for ops that expired from the pending buffer",
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.Revocation": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "block": {
+                    "type": "integer"
+                },
+                "idKey": {
+                    "type": "string"
+                },
+                "sequence": {
+                    "type": "integer"
+                },
+                "timestamp": {
+                    "type": "integer"
+                },
+                "txId": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.Signature": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "instance": {
+                    "type": "integer"
+                },
+                "scheme": {
                     "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                },
+                "vin": {
+                    "type": "integer"
+                },
+                "vout": {
+                    "type": "integer"
                 }
             }
         },
@@ -213,12 +1735,29 @@ const docTemplate = `{
                 "idKey": {
                     "type": "string"
                 },
+                "message": {
+                    "type": "string",
+                    "format": "base64"
+                },
                 "revoked": {
+                    "description": "Revoked is always false, a REVOKE removes the signer instead, see\nAttestation.Revocations",
                     "type": "boolean"
                 },
+                "scheme": {
+                    "description": "Scheme, Vout and SigInstance locate the signature that covered the op",
+                    "type": "string"
+                },
                 "sequence": {
                     "type": "integer"
                 },
+                "sigInstance": {
+                    "type": "integer"
+                },
+                "signature": {
+                    "description": "Signature is the signature's value and Message the message it signs:\nthe signed fields for AIP, the input and data hash for Sigma",
+                    "type": "string",
+                    "format": "base64"
+                },
                 "signingAddress": {
                     "type": "string"
                 },
@@ -227,9 +1766,170 @@ const docTemplate = `{
                 },
                 "txId": {
                     "type": "string"
+                },
+                "vout": {
+                    "type": "integer"
+                }
+            }
+        },
+        "vc.Check": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "no signature by the issuer on the attestation"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "signature"
+                },
+                "ok": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "vc.Credential": {
+            "type": "object",
+            "properties": {
+                "@context": {
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "credentialSubject": {
+                    "$ref": "#/definitions/vc.Subject"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "urn:bap:credential:abc123def456:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+                },
+                "issuanceDate": {
+                    "type": "string",
+                    "example": "2019-08-05T21:26:22Z"
+                },
+                "issuer": {
+                    "type": "string",
+                    "example": "did:bap:id:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+                },
+                "proof": {
+                    "$ref": "#/definitions/vc.Proof"
+                },
+                "type": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "VerifiableCredential",
+                        "BapAttestation"
+                    ]
+                }
+            }
+        },
+        "vc.Proof": {
+            "type": "object",
+            "properties": {
+                "block": {
+                    "type": "integer",
+                    "example": 594320
+                },
+                "created": {
+                    "type": "string",
+                    "example": "2019-08-05T21:26:22Z"
+                },
+                "proofPurpose": {
+                    "type": "string",
+                    "example": "assertionMethod"
+                },
+                "proofValue": {
+                    "description": "ProofValue and SignedMessage are unset for signatures indexed before\nthey were stored",
+                    "type": "string",
+                    "format": "base64",
+                    "example": "ILrHdsFAsV3r/+P0JqCjDBy2RIxrc94NMlcpvzu7oPKaB5jSMsEM18WRYvPtcJNvVh5AWESIVk4j1lyAxFd0Sd4="
+                },
+                "sequence": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "sigInstance": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "signedMessage": {
+                    "type": "string",
+                    "format": "base64",
+                    "example": "ajFCQVBTdWFQbmZHblNCTTNHTFY5eWh4VWRZZTR2R2JkTVRBVFRFU1Q2Mzg2YWZhMjIzZTU0ZDRmOTU1ZTQ0YTFlZjRhZTViMThiYmI4Njg5ZGZmMDc4NjI3YTdjYjg0MmZhZDRmN2M2MHw="
+                },
+                "signingAddress": {
+                    "type": "string",
+                    "example": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+                },
+                "txid": {
+                    "type": "string",
+                    "example": "ee7c1c6b9a2b8a2de8b7d3e6e1f0d5c4b3a29180f7e6d5c4b3a2918070605040"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "BapAipSignature"
+                },
+                "verificationMethod": {
+                    "type": "string",
+                    "example": "did:bap:id:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g#1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+                },
+                "vout": {
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
+        "vc.Subject": {
+            "type": "object",
+            "properties": {
+                "attestationHash": {
+                    "type": "string",
+                    "example": "abc123def456"
+                },
+                "attribute": {
+                    "description": "Attribute and Value are set when the index knows them",
+                    "type": "string",
+                    "example": "name"
+                },
+                "id": {
+                    "description": "ID is the did:bap of the identity the attestation is about",
+                    "type": "string",
+                    "example": "did:bap:id:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+                },
+                "value": {
+                    "type": "string",
+                    "example": "John Doe"
+                }
+            }
+        },
+        "vc.Verification": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/vc.Check"
+                    }
+                },
+                "valid": {
+                    "type": "boolean",
+                    "example": true
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "description": "\"Bearer \" followed by the ADMIN_TOKEN the server was started with",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -5,29 +5,37 @@ go 1.23.1
 toolchain go1.23.6
 
 require (
+	github.com/HugoSmits86/nativewebp v0.9.3
 	github.com/b-open-io/go-junglebus v0.3.4
 	github.com/bitcoin-sv/go-sdk v1.1.18
 	github.com/bitcoinschema/go-aip v0.3.2
+	github.com/bitcoinschema/go-b v0.2.2
 	github.com/bitcoinschema/go-bap v0.4.1
 	github.com/bitcoinschema/go-bmap v0.2.3
 	github.com/bitcoinschema/go-bob v0.5.1
+	github.com/bitcoinschema/go-bpu v0.2.1
+	github.com/bitcoinschema/go-sigma v0.1.1
 	github.com/fsnotify/fsnotify v1.8.0
 	github.com/gofiber/fiber/v2 v2.52.6
+	github.com/jpillora/backoff v1.0.0
+	github.com/prometheus/client_golang v1.21.1
 	github.com/swaggo/swag v1.16.4
 	github.com/ttacon/chalk v0.0.0-20160626202418-22c06c80ed31
 	go.mongodb.org/mongo-driver v1.17.2
+	golang.org/x/image v0.24.0
+	golang.org/x/sync v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/KyleBanks/depth v1.2.1 // indirect
 	github.com/andybalholm/brotli v1.1.1 // indirect
-	github.com/bitcoinschema/go-b v0.2.2 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/bitcoinschema/go-boost v0.2.1 // indirect
-	github.com/bitcoinschema/go-bpu v0.2.1 // indirect
 	github.com/bitcoinschema/go-map v0.2.1 // indirect
-	github.com/bitcoinschema/go-sigma v0.1.1 // indirect
 	github.com/centrifugal/centrifuge-go v0.10.4 // indirect
 	github.com/centrifugal/protocol v0.16.0 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/go-openapi/jsonpointer v0.21.0 // indirect
 	github.com/go-openapi/jsonreference v0.21.0 // indirect
 	github.com/go-openapi/spec v0.21.0 // indirect
@@ -36,15 +44,19 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
-	github.com/jpillora/backoff v1.0.0 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/mailru/easyjson v0.9.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/montanaflynn/stats v0.7.1 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/planetscale/vtprotobuf v0.6.0 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.62.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/segmentio/asm v1.2.0 // indirect
 	github.com/segmentio/encoding v0.4.1 // indirect
@@ -56,10 +68,8 @@ require (
 	github.com/xdg-go/stringprep v1.0.4 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
-	golang.org/x/sync v0.11.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	golang.org/x/tools v0.30.0 // indirect
 	google.golang.org/protobuf v1.36.5 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,280 @@
+package imageproxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/persist"
+)
+
+// Cache is a content addressed on-disk image cache.
+//
+// Blobs are stored once under blobs/<hash[:2]>/<hash> no matter how many
+// urls or variants resolve to the same bytes. Each cache key gets a small
+// ref file under refs/ pointing at a blob; refs expire after ttl and blobs are
+// evicted least recently used first, together with their refs, once the
+// total size of blobs and refs exceeds maxBytes.
+type Cache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+
+	mu sync.Mutex
+	// size is the running total of blob and ref bytes on disk
+	size int64
+	// lru holds a *blob per blob on disk, most recently used first
+	lru   *list.List
+	blobs map[string]*list.Element
+	// refs is the blob and file size of each ref file, by path
+	refs map[string]refEntry
+}
+
+type ref struct {
+	Hash        string    `json:"hash"`
+	ContentType string    `json:"contentType"`
+	Stored      time.Time `json:"stored"`
+}
+
+// blob is a blob on disk and the ref files pointing at it
+type blob struct {
+	hash string
+	size int64
+	refs map[string]struct{}
+}
+
+type refEntry struct {
+	hash string
+	size int64
+}
+
+// Hash returns the hex encoded sha256 of data
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewCache opens (or creates) a cache rooted at dir
+func NewCache(dir string, ttl time.Duration, maxBytes int64) (*Cache, error) {
+	c := &Cache{
+		dir:      dir,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		blobs:    map[string]*list.Element{},
+		refs:     map[string]refEntry{},
+	}
+	for _, sub := range []string{"blobs", "refs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	// index what is already on disk so the size cap survives restarts, in
+	// modification order since Get bumps the time of the blobs it serves
+	type found struct {
+		hash    string
+		size    int64
+		modTime time.Time
+	}
+	var blobs []found
+	err := filepath.WalkDir(filepath.Join(dir, "blobs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(path, ".tmp") {
+			// left by a write that never finished
+			return os.Remove(path)
+		}
+		if info, err := d.Info(); err == nil {
+			blobs = append(blobs, found{hash: d.Name(), size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].modTime.Before(blobs[j].modTime)
+	})
+	for _, b := range blobs {
+		c.blobs[b.hash] = c.lru.PushFront(&blob{hash: b.hash, size: b.size, refs: map[string]struct{}{}})
+		c.size += b.size
+	}
+
+	err = filepath.WalkDir(filepath.Join(dir, "refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		r := &ref{}
+		info, err := d.Info()
+		if err != nil || persist.Load(path, r) != nil || c.blobs[r.Hash] == nil {
+			// unreadable, or its blob is gone
+			return os.Remove(path)
+		}
+		c.addRef(path, r.Hash, info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// TTL is how long an entry stays fresh
+func (c *Cache) TTL() time.Duration {
+	return c.ttl
+}
+
+// Get returns the cached media for key, if present and not expired
+func (c *Cache) Get(key string) (*Media, bool) {
+	r := &ref{}
+	refPath := c.refPath(key)
+	if err := persist.Load(refPath, r); err != nil {
+		return nil, false
+	}
+	if time.Since(r.Stored) > c.ttl {
+		c.mu.Lock()
+		c.removeRef(refPath)
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	blobPath := c.blobPath(r.Hash)
+	data, err := os.ReadFile(blobPath)
+	if err != nil {
+		// the blob was evicted out from under this ref
+		c.mu.Lock()
+		c.removeRef(refPath)
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	c.mu.Lock()
+	if el, ok := c.blobs[r.Hash]; ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	// bump the modification time too, so the order survives a restart
+	now := time.Now()
+	os.Chtimes(blobPath, now, now)
+
+	return &Media{
+		Data:        data,
+		ContentType: r.ContentType,
+		Hash:        r.Hash,
+	}, true
+}
+
+// Put stores media under key
+func (c *Cache) Put(key string, m *Media) error {
+	if m.Hash == "" {
+		m.Hash = Hash(m.Data)
+	}
+
+	blobPath := c.blobPath(m.Hash)
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+			return err
+		}
+		// write to a temp file first so readers never see a partial blob
+		tmp := blobPath + ".tmp"
+		if err := os.WriteFile(tmp, m.Data, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, blobPath); err != nil {
+			return err
+		}
+	}
+
+	refPath := c.refPath(key)
+	if err := persist.Save(refPath, &ref{
+		Hash:        m.Hash,
+		ContentType: m.ContentType,
+		Stored:      time.Now(),
+	}); err != nil {
+		return err
+	}
+	info, err := os.Stat(refPath)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.blobs[m.Hash]; ok {
+		c.lru.MoveToFront(el)
+	} else {
+		c.blobs[m.Hash] = c.lru.PushFront(&blob{hash: m.Hash, size: int64(len(m.Data)), refs: map[string]struct{}{}})
+		c.size += int64(len(m.Data))
+	}
+	if old, ok := c.refs[refPath]; ok {
+		// the key pointed at a blob already, maybe another one
+		c.dropRef(refPath, old)
+	}
+	c.addRef(refPath, m.Hash, info.Size())
+	c.evict()
+	return nil
+}
+
+// evict removes least recently used blobs and the refs pointing at them
+// until the cache is under its cap. c.mu must be held.
+func (c *Cache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		b := c.lru.Back().Value.(*blob)
+		if err := os.Remove(c.blobPath(b.hash)); err != nil && !os.IsNotExist(err) {
+			log.Printf("[ERROR]: evicting %s: %v", b.hash, err)
+			return
+		}
+		for refPath := range b.refs {
+			c.removeRef(refPath)
+		}
+		c.lru.Remove(c.blobs[b.hash])
+		delete(c.blobs, b.hash)
+		c.size -= b.size
+	}
+}
+
+// addRef records the ref file at refPath. c.mu must be held.
+func (c *Cache) addRef(refPath, hash string, size int64) {
+	c.refs[refPath] = refEntry{hash: hash, size: size}
+	c.blobs[hash].Value.(*blob).refs[refPath] = struct{}{}
+	c.size += size
+}
+
+// dropRef forgets the ref file at refPath. c.mu must be held.
+func (c *Cache) dropRef(refPath string, r refEntry) {
+	delete(c.refs, refPath)
+	if el, ok := c.blobs[r.hash]; ok {
+		delete(el.Value.(*blob).refs, refPath)
+	}
+	c.size -= r.size
+}
+
+// removeRef deletes the ref file at refPath. c.mu must be held.
+func (c *Cache) removeRef(refPath string) {
+	if err := os.Remove(refPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("[ERROR]: removing %s: %v", refPath, err)
+		return
+	}
+	if r, ok := c.refs[refPath]; ok {
+		c.dropRef(refPath, r)
+	}
+}
+
+func (c *Cache) refPath(key string) string {
+	return filepath.Join(c.dir, "refs", Hash([]byte(key))+".json")
+}
+
+func (c *Cache) blobPath(hash string) string {
+	return filepath.Join(c.dir, "blobs", hash[:2], hash)
+}
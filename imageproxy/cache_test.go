@@ -0,0 +1,203 @@
+package imageproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// diskSize is the size of every file under dir
+func diskSize(t *testing.T, dir string) (size int64) {
+	t.Helper()
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+		return nil
+	})
+	return size
+}
+
+// refSize is about the size of a ref file, which varies by a few bytes
+// with the time it was stored
+func refSize(t *testing.T) int64 {
+	t.Helper()
+	b, err := json.MarshalIndent(&ref{Hash: Hash(nil), ContentType: "image/png", Stored: time.Now()}, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(b))
+}
+
+// media is a distinct blob of n bytes
+func media(b byte, n int) *Media {
+	return &Media{Data: bytes.Repeat([]byte{b}, n), ContentType: "image/png"}
+}
+
+func TestCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// run puts and gets on c, returning the keys that must still hit
+		// and those that must miss
+		run func(t *testing.T, c *Cache) (hits, misses []string)
+		// max is the cap given the size of a ref
+		max  func(r int64) int64
+		ttl  time.Duration
+		refs int
+	}{
+		{
+			name: "keys share a blob",
+			run: func(t *testing.T, c *Cache) ([]string, []string) {
+				c.Put("a", media('a', 100))
+				c.Put("a?w=10", media('a', 100))
+				return []string{"a", "a?w=10"}, []string{"b"}
+			},
+			max:  func(r int64) int64 { return 1 << 20 },
+			ttl:  time.Hour,
+			refs: 2,
+		},
+		{
+			name: "least recently used blob goes with its refs",
+			run: func(t *testing.T, c *Cache) ([]string, []string) {
+				c.Put("a", media('a', 500))
+				c.Put("b", media('b', 500))
+				c.Put("b?w=10", media('b', 500))
+				// a is now more recently used than b
+				if _, ok := c.Get("a"); !ok {
+					t.Fatal("a missed before the cap was reached")
+				}
+				c.Put("c", media('c', 500))
+				return []string{"a", "c"}, []string{"b", "b?w=10"}
+			},
+			// room for two blobs and three refs
+			max:  func(r int64) int64 { return 1000 + 3*r + r/2 },
+			ttl:  time.Hour,
+			refs: 2,
+		},
+		{
+			// refs count towards the cap, so many small refs evict too
+			name: "refs count towards the cap",
+			run: func(t *testing.T, c *Cache) ([]string, []string) {
+				c.Put("a", media('a', 450))
+				c.Put("b", media('b', 450))
+				for _, key := range []string{"b?w=1", "b?w=2", "b?w=3"} {
+					c.Put(key, media('b', 450))
+				}
+				return []string{"b", "b?w=1", "b?w=2", "b?w=3"}, []string{"a"}
+			},
+			// room for both blobs, but not with a third ref
+			max:  func(r int64) int64 { return 900 + 2*r + r/2 },
+			ttl:  time.Hour,
+			refs: 4,
+		},
+		{
+			name: "key moved to another blob",
+			run: func(t *testing.T, c *Cache) ([]string, []string) {
+				c.Put("a", media('a', 100))
+				c.Put("a", media('b', 100))
+				m, ok := c.Get("a")
+				if !ok || m.Data[0] != 'b' {
+					t.Errorf("got %v, want the second blob", m)
+				}
+				return []string{"a"}, nil
+			},
+			max:  func(r int64) int64 { return 1 << 20 },
+			ttl:  time.Hour,
+			refs: 1,
+		},
+		{
+			name: "expired ref is removed",
+			run: func(t *testing.T, c *Cache) ([]string, []string) {
+				c.Put("a", media('a', 100))
+				return nil, []string{"a"}
+			},
+			max:  func(r int64) int64 { return 1 << 20 },
+			ttl:  -time.Second,
+			refs: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			max := tt.max(refSize(t))
+			c, err := NewCache(dir, tt.ttl, max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hits, misses := tt.run(t, c)
+			for _, key := range hits {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("%s missed", key)
+				}
+			}
+			for _, key := range misses {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("%s hit", key)
+				}
+			}
+
+			if got := diskSize(t, dir); c.size != got || got > max {
+				t.Errorf("running size %d, %d on disk, cap %d", c.size, got, max)
+			}
+			refs, _ := os.ReadDir(filepath.Join(dir, "refs"))
+			if len(refs) != tt.refs || len(c.refs) != tt.refs {
+				t.Errorf("%d refs on disk, %d indexed, want %d", len(refs), len(c.refs), tt.refs)
+			}
+
+			// reopening indexes the same state
+			reopened, err := NewCache(dir, tt.ttl, max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reopened.size != c.size || len(reopened.refs) != len(c.refs) || reopened.lru.Len() != c.lru.Len() {
+				t.Errorf("reopened with size %d, %d refs, %d blobs, want %d, %d, %d",
+					reopened.size, len(reopened.refs), reopened.lru.Len(), c.size, len(c.refs), c.lru.Len())
+			}
+		})
+	}
+}
+
+func TestNewCachePrunesDanglingRefs(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCache(dir, time.Hour, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := media('a', 100)
+	if err := c.Put("a", m); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put("b", media('b', 100)); err != nil {
+		t.Fatal(err)
+	}
+	// a blob lost outside the cache, and a write that never finished
+	os.Remove(c.blobPath(m.Hash))
+	os.WriteFile(c.blobPath(m.Hash)+".tmp", m.Data, 0644)
+
+	c, err = NewCache(dir, time.Hour, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("a hit without its blob")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b missed")
+	}
+	if _, err := os.Stat(c.refPath("a")); !os.IsNotExist(err) {
+		t.Errorf("ref of the lost blob is still on disk: %v", err)
+	}
+	if got := diskSize(t, dir); c.size != got {
+		t.Errorf("running size %d, %d on disk", c.size, got)
+	}
+}
@@ -0,0 +1,90 @@
+package imageproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrNotFound is returned when the upstream has no content for a url
+var ErrNotFound = errors.New("image not found upstream")
+
+// ErrTooLarge is returned when the upstream content exceeds the size limit
+var ErrTooLarge = errors.New("image exceeds size limit")
+
+// Media is a blob of image data along with its content type
+type Media struct {
+	Data        []byte
+	ContentType string
+	// Hash is the hex sha256 of Data, used as the cache address and ETag
+	Hash string
+}
+
+// Fetcher retrieves media from an upstream source. It is an interface so the
+// proxy can be pointed at a local stand-in instead of the network.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*Media, error)
+}
+
+// HTTPFetcher fetches media over http with a timeout and a size limit
+type HTTPFetcher struct {
+	Client   *http.Client
+	MaxBytes int64
+}
+
+// NewHTTPFetcher returns a fetcher that gives up after timeout and refuses
+// bodies larger than maxBytes
+func NewHTTPFetcher(timeout time.Duration, maxBytes int64) *HTTPFetcher {
+	return &HTTPFetcher{
+		Client:   &http.Client{Timeout: timeout},
+		MaxBytes: maxBytes,
+	}
+}
+
+// Fetch downloads the content at url
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) (*Media, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned status %d for %s", resp.StatusCode, url)
+	}
+
+	if resp.ContentLength > f.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	// read one byte past the limit so we can tell a full read from a truncated one
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		// Fallback to detecting content type from data
+		contentType = http.DetectContentType(data)
+	}
+
+	return &Media{
+		Data:        data,
+		ContentType: contentType,
+		Hash:        Hash(data),
+	}, nil
+}
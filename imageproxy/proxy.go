@@ -0,0 +1,99 @@
+package imageproxy
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Proxy serves upstream images through the cache, collapsing concurrent
+// misses for the same url into a single upstream request
+type Proxy struct {
+	fetcher Fetcher
+	cache   *Cache
+	group   singleflight.Group
+}
+
+// New creates a proxy that fetches misses with fetcher and stores them in cache
+func New(fetcher Fetcher, cache *Cache) *Proxy {
+	return &Proxy{
+		fetcher: fetcher,
+		cache:   cache,
+	}
+}
+
+// Cache returns the underlying cache
+func (p *Proxy) Cache() *Cache {
+	return p.cache
+}
+
+// Get returns the image at url transformed by opts. hit reports whether the
+// response came straight from the cache.
+func (p *Proxy) Get(ctx context.Context, url string, opts Options) (m *Media, hit bool, err error) {
+	key := url
+	if !opts.IsZero() {
+		key = url + "#" + opts.String()
+	}
+
+	if m, ok := p.cache.Get(key); ok {
+		metrics.ImageCacheRequests.WithLabelValues("hit").Inc()
+		return m, true, nil
+	}
+	metrics.ImageCacheRequests.WithLabelValues("miss").Inc()
+
+	v, err, _ := p.group.Do(key, func() (interface{}, error) {
+		src, err := p.original(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		if opts.IsZero() {
+			return src, nil
+		}
+
+		out, err := Transform(src, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.cache.Put(key, out); err != nil {
+			log.Printf("[ERROR]: caching %s: %v", Redact(key), err)
+		}
+		return out, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return v.(*Media), false, nil
+}
+
+// original returns the untransformed image, fetching it upstream on a miss
+func (p *Proxy) original(ctx context.Context, url string) (*Media, error) {
+	if m, ok := p.cache.Get(url); ok {
+		return m, nil
+	}
+
+	v, err, _ := p.group.Do("src:"+url, func() (interface{}, error) {
+		// other callers may be waiting on this fetch, so one of them going
+		// away shouldn't cancel it; the fetcher enforces its own timeout
+		start := time.Now()
+		m, err := p.fetcher.Fetch(context.WithoutCancel(ctx), url)
+		if err != nil {
+			metrics.ImageFetchDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+			return nil, err
+		}
+		metrics.ImageFetchDuration.WithLabelValues("ok").Observe(time.Since(start).Seconds())
+		if err := p.cache.Put(url, m); err != nil {
+			log.Printf("[ERROR]: caching %s: %v", Redact(url), err)
+		}
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Media), nil
+}
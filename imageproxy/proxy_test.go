@@ -0,0 +1,92 @@
+package imageproxy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testFetcher serves one image after a delay and counts its fetches
+type testFetcher struct {
+	m       *Media
+	delay   time.Duration
+	fetches atomic.Int32
+}
+
+func (f *testFetcher) Fetch(ctx context.Context, url string) (*Media, error) {
+	f.fetches.Add(1)
+	time.Sleep(f.delay)
+	if url != "https://example.com/a.png" {
+		return nil, ErrNotFound
+	}
+	return f.m, nil
+}
+
+func TestProxyGet(t *testing.T) {
+	const url = "https://example.com/a.png"
+	cache, err := NewCache(t.TempDir(), time.Hour, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := &testFetcher{m: testImage(t, "png", 200, 100), delay: 50 * time.Millisecond}
+	p := New(fetcher, cache)
+
+	// concurrent misses share one upstream request
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := p.Get(context.Background(), url, Options{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	steps := []struct {
+		name string
+		opts Options
+		hit  bool
+	}{
+		{"original", Options{}, true},
+		{"new variant", Options{Width: 50}, false},
+		{"same variant", Options{Width: 50}, true},
+		{"other variant", Options{Width: 50, Format: "webp"}, false},
+	}
+	for _, step := range steps {
+		m, hit, err := p.Get(context.Background(), url, step.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if hit != step.hit || len(m.Data) == 0 {
+			t.Errorf("%s: hit %v, want %v", step.name, hit, step.hit)
+		}
+	}
+	if n := fetcher.fetches.Load(); n != 1 {
+		t.Errorf("fetched upstream %d times, want once", n)
+	}
+
+	if _, _, err := p.Get(context.Background(), "https://example.com/missing.png", Options{Width: 50}); err != ErrNotFound {
+		t.Errorf("got %v for a missing image, want %v", err, ErrNotFound)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	long := "https://example.com/" + strings.Repeat("x", 100)
+	tests := []struct {
+		key, want string
+	}{
+		{"https://example.com/a.png", "https://example.com/a.png"},
+		{long, long[:redactAfter] + "…(120 bytes)"},
+		{"data:image/png;base64," + strings.Repeat("x", 100), "data:image/png;base64,…(122 bytes)"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.key); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
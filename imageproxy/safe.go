@@ -0,0 +1,48 @@
+package imageproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrUnsafeType is returned for media that isn't one of SafeTypes
+var ErrUnsafeType = errors.New("content type is not a safe image type")
+
+// SafeTypes are the content types media is served as. Anything else, like
+// svg or html, could run script in the browser of whoever opens the url.
+var SafeTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// SafeType returns the content type of m sniffed from its bytes, rather than
+// trusting what the upstream or data url declared, and whether it is safe
+// to serve
+func SafeType(m *Media) (string, bool) {
+	contentType := http.DetectContentType(m.Data)
+	return contentType, SafeTypes[contentType]
+}
+
+// redactAfter is how much of a long key Redact keeps
+const redactAfter = 64
+
+// Redact shortens keys for logs and error messages. Data urls are replaced
+// by their media type and size, so a profile can't flood the logs with
+// base64.
+func Redact(key string) string {
+	if len(key) <= redactAfter {
+		return key
+	}
+	if strings.HasPrefix(key, "data:") {
+		meta, _, _ := strings.Cut(key, ",")
+		if len(meta) > redactAfter {
+			meta = meta[:redactAfter]
+		}
+		return fmt.Sprintf("%s,…(%d bytes)", meta, len(key))
+	}
+	return fmt.Sprintf("%s…(%d bytes)", key[:redactAfter], len(key))
+}
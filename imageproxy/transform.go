@@ -0,0 +1,149 @@
+package imageproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register gif decoder
+	"image/jpeg"
+	"image/png"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register webp decoder
+)
+
+// ErrUnsupportedFormat is returned for output formats we can't encode
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// ErrInvalidImage is returned when the source can't be decoded as an image
+var ErrInvalidImage = errors.New("invalid image data")
+
+// Options describe how an image should be transformed before it is served.
+// A zero Options leaves the image untouched.
+type Options struct {
+	// Width and Height bound the output. When only one is given the image is
+	// scaled proportionally; when both are given the image is cropped to fill
+	// the box exactly (a thumbnail).
+	Width  int
+	Height int
+	// Format is one of webp, png or jpeg. Empty keeps the source format.
+	Format string
+}
+
+// IsZero reports whether the options leave the image untouched
+func (o Options) IsZero() bool {
+	return o.Width == 0 && o.Height == 0 && o.Format == ""
+}
+
+// String is a stable representation used in cache keys
+func (o Options) String() string {
+	return fmt.Sprintf("w=%d&h=%d&format=%s", o.Width, o.Height, o.Format)
+}
+
+// ParseFormat normalizes a requested output format
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return "", nil
+	case "webp", "png":
+		return format, nil
+	case "jpeg", "jpg":
+		return "jpeg", nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Transform resizes and/or re-encodes m according to opts
+func Transform(m *Media, opts Options) (*Media, error) {
+	if opts.IsZero() {
+		return m, nil
+	}
+
+	src, srcFormat, err := image.Decode(bytes.NewReader(m.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = srcFormat
+		// we can read gifs but only write a still frame, so hand back png
+		if format == "gif" {
+			format = "png"
+		}
+	}
+
+	dst := resize(src, opts.Width, opts.Height)
+
+	buf := &bytes.Buffer{}
+	var contentType string
+	switch format {
+	case "jpeg":
+		contentType = "image/jpeg"
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: config.ImageDefaultQuality})
+	case "png":
+		contentType = "image/png"
+		err = png.Encode(buf, dst)
+	case "webp":
+		contentType = "image/webp"
+		err = nativewebp.Encode(buf, dst, nil)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", format, err)
+	}
+
+	data := buf.Bytes()
+	return &Media{
+		Data:        data,
+		ContentType: contentType,
+		Hash:        Hash(data),
+	}, nil
+}
+
+// resize scales src to fit width x height. Images are never scaled up.
+func resize(src image.Image, width, height int) image.Image {
+	b := src.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	if (width == 0 && height == 0) || srcW == 0 || srcH == 0 {
+		return src
+	}
+
+	// the region of the source we sample from, cropped for thumbnails
+	crop := b
+	switch {
+	case width > 0 && height > 0:
+		// crop the source to the target aspect ratio around its center
+		if srcW*height > srcH*width {
+			cropW := srcH * width / height
+			x0 := b.Min.X + (srcW-cropW)/2
+			crop = image.Rect(x0, b.Min.Y, x0+cropW, b.Max.Y)
+		} else {
+			cropH := srcW * height / width
+			y0 := b.Min.Y + (srcH-cropH)/2
+			crop = image.Rect(b.Min.X, y0, b.Max.X, y0+cropH)
+		}
+	case width > 0:
+		height = srcH * width / srcW
+	default:
+		width = srcW * height / srcH
+	}
+
+	if width >= crop.Dx() || height >= crop.Dy() {
+		width, height = crop.Dx(), crop.Dy()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,115 @@
+package imageproxy
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+// testImage encodes a width x height image, halved into two colors so
+// crops and scales are visible, as png or gif
+func testImage(t *testing.T, format string, width, height int) *Media {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	for x := width / 2; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.SetColorIndex(x, y, 1)
+		}
+	}
+	buf := &bytes.Buffer{}
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(buf, img)
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Media{Data: buf.Bytes(), ContentType: "image/" + format, Hash: Hash(buf.Bytes())}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		opts   Options
+		width  int
+		height int
+		// contentType of the output, empty when the source comes back as is
+		contentType string
+		err         error
+	}{
+		{name: "zero options", src: "png", width: 200, height: 100},
+		{name: "width only", src: "png", opts: Options{Width: 50}, width: 50, height: 25, contentType: "image/png"},
+		{name: "height only", src: "png", opts: Options{Height: 50}, width: 100, height: 50, contentType: "image/png"},
+		{name: "thumbnail crops", src: "png", opts: Options{Width: 40, Height: 40}, width: 40, height: 40, contentType: "image/png"},
+		{name: "never scaled up", src: "png", opts: Options{Width: 400}, width: 200, height: 100, contentType: "image/png"},
+		{name: "to jpeg", src: "png", opts: Options{Format: "jpeg"}, width: 200, height: 100, contentType: "image/jpeg"},
+		{name: "to webp", src: "png", opts: Options{Width: 20, Format: "webp"}, width: 20, height: 10, contentType: "image/webp"},
+		{name: "gif comes back as png", src: "gif", opts: Options{Width: 20}, width: 20, height: 10, contentType: "image/png"},
+		{name: "unsupported format", src: "png", opts: Options{Format: "bmp"}, err: ErrUnsupportedFormat},
+		{name: "not an image", opts: Options{Width: 20}, err: ErrInvalidImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &Media{Data: []byte("<svg/>"), ContentType: "image/svg+xml"}
+			if tt.src != "" {
+				src = testImage(t, tt.src, 200, 100)
+			}
+			out, err := Transform(src, tt.opts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if tt.contentType == "" {
+				if out != src {
+					t.Error("got a new media, want the source untouched")
+				}
+				return
+			}
+			if out.ContentType != tt.contentType || out.Hash != Hash(out.Data) {
+				t.Errorf("got %s hashed %s, want %s", out.ContentType, out.Hash, tt.contentType)
+			}
+			if contentType, ok := SafeType(out); !ok || contentType != tt.contentType {
+				t.Errorf("output sniffs as %s", contentType)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(out.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("got %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      error
+	}{
+		{"", "", nil},
+		{"webp", "webp", nil},
+		{"png", "png", nil},
+		{"jpg", "jpeg", nil},
+		{"jpeg", "jpeg", nil},
+		{"gif", "", ErrUnsupportedFormat},
+		{"svg", "", ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		if got, err := ParseFormat(tt.in); got != tt.want || err != tt.err {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
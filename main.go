@@ -1,17 +1,46 @@
 package main
 
 import (
-	"github.com/BitcoinSchema/go-bap-indexer/crawler"
-	"github.com/BitcoinSchema/go-bap-indexer/server"
-	"github.com/BitcoinSchema/go-bap-indexer/state"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/database"
 )
 
 func main() {
-	currentBlock := state.LoadProgress()
+	// SIGINT / SIGTERM start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// without a subcommand the indexer runs the API and the crawler
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(ctx, args)
 
-	go server.Start()
-	go crawler.ProcessDone()
-	crawler.SyncBlocks(int(currentBlock))
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := database.Disconnect(disconnectCtx); err != nil {
+		log.Printf("[ERROR]: disconnecting from mongo: %v", err)
+	}
 
-	<-make(chan struct{})
+	if err != nil {
+		log.Printf("[ERROR]: %s: %v", name, err)
+		os.Exit(1)
+	}
 }
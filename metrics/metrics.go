@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "bap"
+
+var (
+	// IndexedHeight is the last block the crawler fully processed
+	IndexedHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "indexed_block_height",
+		Help:      "Height of the last block the crawler fully processed.",
+	})
+
+	// ChainTip is the chain tip as last reported by JungleBus
+	ChainTip = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "chain_tip_height",
+		Help:      "Height of the chain tip as last reported by JungleBus.",
+	})
+
+	// BlockLag is how many blocks the index is behind the chain tip
+	BlockLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "block_lag",
+		Help:      "Number of blocks the index is behind the chain tip.",
+	})
+
+	// TxsProcessed counts transactions handed to ProcessTx
+	TxsProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "txs_processed_total",
+		Help:      "Transactions processed by the crawler.",
+	})
+
+	// OpsProcessed counts BAP ops with a valid signature, by type
+	OpsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ops_processed_total",
+		Help:      "Signed BAP operations processed, by type.",
+	}, []string{"type"})
+
+	// AIPFailures counts AIP signatures that errored or did not verify
+	AIPFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "aip_validation_failures_total",
+		Help:      "AIP signatures that failed validation, by reason (error or invalid).",
+	}, []string{"reason"})
+
+	// SigmaFailures counts Sigma signatures that errored or did not verify
+	SigmaFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sigma_validation_failures_total",
+		Help:      "Sigma signatures that failed validation, by reason (error or invalid).",
+	}, []string{"reason"})
+
+	// OpsWithoutID counts ops dropped because no identity matched the signer
+	OpsWithoutID = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ops_without_id_total",
+		Help:      "BAP operations whose signing address matched no identity (e.g. ATTEST without ID), by type.",
+	}, []string{"type"})
+
+	// TransientRetries counts ops retried after a transient database error
+	TransientRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transient_retries_total",
+		Help:      "BAP operations retried after a transient database error.",
+	})
+
+	// Quarantined counts ops written to the quarantine collection
+	Quarantined = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quarantined_ops_total",
+		Help:      "BAP operations (or undecodable transactions) moved to quarantine.",
+	})
+
+	// IdentityConflicts counts conflicts recorded on identities
+	IdentityConflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "identity_conflicts_recorded_total",
+		Help:      "Conflicting identity claims recorded on identities (duplicate idKey claims and addresses creating several idKeys).",
+	})
+
+	// PendingOps is the number of ops waiting for their signer's identity
+	PendingOps = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_ops",
+		Help:      "BAP operations waiting for the identity of their signer.",
+	})
+
+	// PendingOpsResolved counts waiting ops settled, by outcome (applied,
+	// failed, expired or overflow)
+	PendingOpsResolved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pending_ops_resolved_total",
+		Help:      "BAP operations that stopped waiting for an identity, by outcome (applied, failed, expired or overflow).",
+	}, []string{"outcome"})
+
+	// MongoDuration observes Mongo command latency by collection and command
+	MongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_op_duration_seconds",
+		Help:      "Latency of Mongo commands by collection, command and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"collection", "command", "status"})
+
+	// HTTPDuration observes API latency by route and status
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of API requests by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// ImageFetchDuration observes upstream image fetch latency
+	ImageFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_fetch_duration_seconds",
+		Help:      "Latency of upstream image fetches by outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+
+	// ImageCacheRequests counts image cache lookups; hit rate is
+	// hits / (hits + misses)
+	ImageCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "image_cache_requests_total",
+		Help:      "Image cache lookups by result (hit or miss).",
+	}, []string{"result"})
+)
+
+var indexed, tip atomic.Int64
+
+// SetIndexedHeight records the last processed block and updates the lag
+func SetIndexedHeight(height uint32) {
+	indexed.Store(int64(height))
+	IndexedHeight.Set(float64(height))
+	updateLag()
+}
+
+// SetChainTip records the chain tip and updates the lag
+func SetChainTip(height uint32) {
+	tip.Store(int64(height))
+	ChainTip.Set(float64(height))
+	updateLag()
+}
+
+func updateLag() {
+	if t, i := tip.Load(), indexed.Load(); t > 0 && i > 0 {
+		BlockLag.Set(float64(t - i))
+	}
+}
+
+// ObserveEventChannel exposes the depth of the crawler's event buffer
+func ObserveEventChannel(depth func() int, capacity int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_channel_depth",
+		Help:      "Events buffered between JungleBus and the crawler.",
+	}, func() float64 { return float64(depth()) })
+
+	promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_channel_capacity",
+		Help:      "Capacity of the crawler's event buffer.",
+	}).Set(float64(capacity))
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MongoMonitor returns a command monitor that records per collection latency
+// for every command sent through the client, including those issued by code
+// that talks to *mongo.Collection directly.
+func MongoMonitor() *event.CommandMonitor {
+	// the collection is only in the started event, so remember it by request id
+	var pending sync.Map
+
+	observe := func(requestID int64, command string, status string, seconds float64) {
+		collection := "unknown"
+		if v, ok := pending.LoadAndDelete(requestID); ok {
+			collection = v.(string)
+		}
+		MongoDuration.WithLabelValues(collection, command, status).Observe(seconds)
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			// commands like find, insert and update name their collection
+			// in the first element of the command document
+			collection := "unknown"
+			if elem, err := e.Command.IndexErr(0); err == nil {
+				if name, ok := elem.Value().StringValueOK(); ok && elem.Key() == e.CommandName {
+					collection = name
+				}
+			}
+			pending.Store(e.RequestID, collection)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			observe(e.RequestID, e.CommandName, "ok", e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			observe(e.RequestID, e.CommandName, "error", e.Duration.Seconds())
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// Source is where evaluation reads the index from
+type Source interface {
+	// Identity returns the identity with idKey, or nil when there is none
+	Identity(ctx context.Context, idKey string) (*types.Identity, error)
+	// Attestation returns the attestation with hash, or nil when there is none
+	Attestation(ctx context.Context, hash string) (*types.Attestation, error)
+	// Validity reports whether id is valid now, and why not
+	Validity(id *types.Identity) (bool, string)
+}
+
+// Result is the outcome of a policy and the evidence it was decided on
+type Result struct {
+	Policy        string       `json:"policy,omitempty" example:"verified-name"`
+	Subject       string       `json:"subject" example:"3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"`
+	Pass          bool         `json:"pass" example:"true"`
+	SubjectValid  bool         `json:"subjectValid" example:"true"`
+	SubjectReason string       `json:"subjectReason,omitempty" example:"identity is deactivated"`
+	Rules         []RuleResult `json:"rules"`
+}
+
+// RuleResult is the outcome of one rule
+type RuleResult struct {
+	Attribute string `json:"attribute" example:"name"`
+	Hash      string `json:"hash,omitempty"`
+	Pass      bool   `json:"pass" example:"true"`
+	Reason    string `json:"reason" example:"2 of 2 required signatures count"`
+	Required  int    `json:"required" example:"2"`
+	Counted   int    `json:"counted" example:"2"`
+	// Evidence lists every signature of the attestation and whether it
+	// counted
+	Evidence []Evidence `json:"evidence"`
+}
+
+// Evidence is one signature of an attestation
+type Evidence struct {
+	types.Signer
+	Counted bool   `json:"counted" example:"true"`
+	Reason  string `json:"reason,omitempty" example:"not a trusted issuer"`
+}
+
+// Evaluate checks subject against p at now. claims holds the subject's
+// attestation of each attribute the rules name.
+func Evaluate(ctx context.Context, src Source, p *Policy, subject *types.Identity, claims map[string]Claim, now time.Time) (*Result, error) {
+	res := &Result{Policy: p.Name, Subject: subject.IDKey, Rules: []RuleResult{}}
+	res.SubjectValid, res.SubjectReason = src.Validity(subject)
+
+	passed := 0
+	for _, rule := range p.Rules {
+		rr, err := evaluateRule(ctx, src, rule, subject.IDKey, claims, now)
+		if err != nil {
+			return nil, err
+		}
+		if rr.Pass {
+			passed++
+		}
+		res.Rules = append(res.Rules, *rr)
+	}
+
+	switch p.Match {
+	case MatchAny:
+		res.Pass = passed > 0
+	default:
+		res.Pass = passed == len(p.Rules)
+	}
+	if !res.SubjectValid && !p.AllowInvalidSubject {
+		res.Pass = false
+	}
+	return res, nil
+}
+
+func evaluateRule(ctx context.Context, src Source, rule Rule, subject string, claims map[string]Claim, now time.Time) (*RuleResult, error) {
+	rr := &RuleResult{Attribute: rule.Attribute, Required: rule.MinSigners, Evidence: []Evidence{}}
+
+	claim, ok := claims[rule.Attribute]
+	if !ok {
+		rr.Reason = "no claim for " + rule.Attribute
+		return rr, nil
+	}
+	rr.Hash = claim.Hash
+	if rr.Hash == "" {
+		rr.Hash = AttestationHash(rule.Attribute, claim.Value, claim.Secret, subject)
+	}
+	att, err := src.Attestation(ctx, rr.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if att == nil {
+		rr.Reason = "attestation is not indexed"
+		return rr, nil
+	}
+
+	var newest time.Time
+	for _, s := range att.Signers {
+		e := Evidence{Signer: *s}
+		signed := now
+		if s.Timestamp > 0 {
+			// unconfirmed signatures have no block time yet
+			signed = time.Unix(int64(s.Timestamp), 0)
+		}
+
+		switch {
+		case len(rule.Issuers) > 0 && !slices.Contains(rule.Issuers, s.IDKey):
+			e.Reason = "not a trusted issuer"
+		case rule.maxAge > 0 && now.Sub(signed) > rule.maxAge:
+			e.Reason = fmt.Sprintf("signed %d days ago, more than %s", int(now.Sub(signed).Hours()/24), rule.MaxAge)
+		default:
+			e.Counted, e.Reason = true, ""
+			if !rule.AllowInvalidIssuers {
+				issuer, err := src.Identity(ctx, s.IDKey)
+				if err != nil {
+					return nil, err
+				}
+				if issuer == nil {
+					e.Counted, e.Reason = false, "issuer identity is not indexed"
+				} else if valid, reason := src.Validity(issuer); !valid {
+					e.Counted, e.Reason = false, "issuer "+reason
+				}
+			}
+		}
+		if e.Counted {
+			rr.Counted++
+			if signed.After(newest) {
+				newest = signed
+			}
+		}
+		rr.Evidence = append(rr.Evidence, e)
+	}
+	// a REVOKE takes the signatures off att.Signers, they are listed but
+	// never count
+	for _, r := range att.Revocations {
+		for _, s := range r.Removed {
+			rr.Evidence = append(rr.Evidence, Evidence{Signer: *s, Reason: fmt.Sprintf("revoked at block %d", r.Block)})
+		}
+	}
+
+	switch {
+	case rr.Counted < rule.MinSigners:
+		rr.Reason = fmt.Sprintf("%d of %d required signatures count", rr.Counted, rule.MinSigners)
+	case rule.newestWithin > 0 && now.Sub(newest) > rule.newestWithin:
+		rr.Reason = fmt.Sprintf("newest counted signature is from %s, more than %s ago", newest.UTC().Format(time.RFC3339), rule.NewestWithin)
+	default:
+		rr.Pass = true
+		rr.Reason = fmt.Sprintf("%d of %d required signatures count", rr.Counted, rule.MinSigners)
+	}
+	return rr, nil
+}
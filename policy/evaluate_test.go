@@ -0,0 +1,249 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// testSource is an index of identities and attestations
+type testSource struct {
+	ids  map[string]*types.Identity
+	atts map[string]*types.Attestation
+}
+
+func (s testSource) Identity(ctx context.Context, idKey string) (*types.Identity, error) {
+	return s.ids[idKey], nil
+}
+
+func (s testSource) Attestation(ctx context.Context, hash string) (*types.Attestation, error) {
+	return s.atts[hash], nil
+}
+
+func (s testSource) Validity(id *types.Identity) (bool, string) {
+	if id.Status == types.StatusDeactivated {
+		return false, "identity is deactivated"
+	}
+	return true, ""
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) uint32 { return uint32(now.Add(-time.Duration(days) * 24 * time.Hour).Unix()) }
+	hash := AttestationHash("name", "Alice", "secret", "subject")
+
+	src := testSource{
+		ids: map[string]*types.Identity{
+			"subject":     {IDKey: "subject"},
+			"recent":      {IDKey: "recent"},
+			"old":         {IDKey: "old"},
+			"untrusted":   {IDKey: "untrusted"},
+			"deactivated": {IDKey: "deactivated", Status: types.StatusDeactivated},
+			"revoked":     {IDKey: "revoked"},
+			"unconfirmed": {IDKey: "unconfirmed"},
+		},
+		atts: map[string]*types.Attestation{
+			hash: {Id: hash, Signers: []*types.Signer{
+				{IDKey: "subject", Timestamp: daysAgo(500)},
+				{IDKey: "recent", Timestamp: daysAgo(100)},
+				{IDKey: "old", Timestamp: daysAgo(400)},
+				{IDKey: "untrusted", Timestamp: daysAgo(10)},
+				{IDKey: "deactivated", Timestamp: daysAgo(10)},
+				{IDKey: "unconfirmed"},
+				{IDKey: "unindexed", Timestamp: daysAgo(10)},
+			}, Revocations: []types.Revocation{
+				{IDKey: "revoked", Block: 600000, Removed: []*types.Signer{{IDKey: "revoked", Timestamp: daysAgo(10)}}},
+			}},
+		},
+	}
+	claims := map[string]Claim{"name": {Value: "Alice", Secret: "secret"}}
+	trusted := []string{"recent", "old", "deactivated"}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		subject string
+		claims  map[string]Claim
+		pass    bool
+		// counted is the number of signatures each rule counted
+		counted []int
+		reason  string
+	}{
+		{
+			name:    "any issuer",
+			policy:  Policy{Rules: []Rule{{Attribute: "name"}}},
+			pass:    true,
+			counted: []int{5},
+			reason:  "5 of 1 required signatures count",
+		},
+		{
+			name:    "trusted issuers",
+			policy:  Policy{Rules: []Rule{{Attribute: "name", Issuers: trusted, MinSigners: 2}}},
+			pass:    true,
+			counted: []int{2},
+		},
+		{
+			name:    "too few valid trusted issuers",
+			policy:  Policy{Rules: []Rule{{Attribute: "name", Issuers: trusted, MinSigners: 3}}},
+			counted: []int{2},
+			reason:  "2 of 3 required signatures count",
+		},
+		{
+			name:    "invalid issuers allowed",
+			policy:  Policy{Rules: []Rule{{Attribute: "name", Issuers: trusted, MinSigners: 3, AllowInvalidIssuers: true}}},
+			pass:    true,
+			counted: []int{3},
+		},
+		{
+			name:    "old signatures dropped",
+			policy:  Policy{Rules: []Rule{{Attribute: "name", Issuers: trusted, MinSigners: 2, MaxAge: "1y"}}},
+			counted: []int{1},
+		},
+		{
+			name:    "unconfirmed signatures are new",
+			policy:  Policy{Rules: []Rule{{Attribute: "name", Issuers: []string{"unconfirmed"}, MaxAge: "1d"}}},
+			pass:    true,
+			counted: []int{1},
+		},
+		{
+			name:    "newest signature too old",
+			policy:  Policy{Rules: []Rule{{Attribute: "name", Issuers: []string{"old"}, NewestWithin: "1y"}}},
+			counted: []int{1},
+			reason:  "newest counted signature is from 2024-11-27T00:00:00Z, more than 1y ago",
+		},
+		{
+			name:    "no claim",
+			policy:  Policy{Rules: []Rule{{Attribute: "email"}}},
+			counted: []int{0},
+			reason:  "no claim for email",
+		},
+		{
+			name:    "claim by hash",
+			policy:  Policy{Rules: []Rule{{Attribute: "name"}}},
+			claims:  map[string]Claim{"name": {Hash: hash}},
+			pass:    true,
+			counted: []int{5},
+		},
+		{
+			name:    "attestation not indexed",
+			policy:  Policy{Rules: []Rule{{Attribute: "name"}}},
+			claims:  map[string]Claim{"name": {Value: "Bob", Secret: "secret"}},
+			counted: []int{0},
+			reason:  "attestation is not indexed",
+		},
+		{
+			name:    "all rules",
+			policy:  Policy{Rules: []Rule{{Attribute: "name"}, {Attribute: "email"}}},
+			counted: []int{5, 0},
+		},
+		{
+			name:    "any rule",
+			policy:  Policy{Match: MatchAny, Rules: []Rule{{Attribute: "name"}, {Attribute: "email"}}},
+			pass:    true,
+			counted: []int{5, 0},
+		},
+		{
+			name:    "invalid subject",
+			policy:  Policy{Rules: []Rule{{Attribute: "name"}}},
+			subject: "deactivated",
+			claims:  map[string]Claim{"name": {Hash: hash}},
+			counted: []int{5},
+		},
+		{
+			name:    "invalid subject allowed",
+			policy:  Policy{AllowInvalidSubject: true, Rules: []Rule{{Attribute: "name"}}},
+			subject: "deactivated",
+			claims:  map[string]Claim{"name": {Hash: hash}},
+			pass:    true,
+			counted: []int{5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			if err := p.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			subject := src.ids["subject"]
+			if tt.subject != "" {
+				subject = src.ids[tt.subject]
+			}
+			c := claims
+			if tt.claims != nil {
+				c = tt.claims
+			}
+
+			res, err := Evaluate(context.Background(), src, &p, subject, c, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Pass != tt.pass {
+				t.Errorf("pass %v, want %v: %+v", res.Pass, tt.pass, res.Rules)
+			}
+			if res.SubjectValid != (subject.Status != types.StatusDeactivated) {
+				t.Errorf("subject valid %v", res.SubjectValid)
+			}
+			if len(res.Rules) != len(tt.counted) {
+				t.Fatalf("got %d rule results, want %d", len(res.Rules), len(tt.counted))
+			}
+			for i, rr := range res.Rules {
+				if rr.Counted != tt.counted[i] {
+					t.Errorf("rule %d counted %d, want %d", i, rr.Counted, tt.counted[i])
+				}
+			}
+			if tt.reason != "" && res.Rules[0].Reason != tt.reason {
+				t.Errorf("reason %q, want %q", res.Rules[0].Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateEvidence(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	hash := AttestationHash("name", "Alice", "secret", "subject")
+	src := testSource{
+		ids: map[string]*types.Identity{
+			"subject":     {IDKey: "subject"},
+			"trusted":     {IDKey: "trusted"},
+			"deactivated": {IDKey: "deactivated", Status: types.StatusDeactivated},
+		},
+		atts: map[string]*types.Attestation{
+			hash: {Id: hash, Signers: []*types.Signer{
+				{IDKey: "subject", Timestamp: uint32(now.Unix())},
+				{IDKey: "trusted", Timestamp: uint32(now.AddDate(-2, 0, 0).Unix())},
+				{IDKey: "deactivated", Timestamp: uint32(now.Unix())},
+				{IDKey: "unindexed", Timestamp: uint32(now.Unix())},
+			}, Revocations: []types.Revocation{
+				{IDKey: "trusted", Block: 600000, Removed: []*types.Signer{{IDKey: "trusted", Timestamp: uint32(now.Unix())}}},
+			}},
+		},
+	}
+	p := Policy{Rules: []Rule{{Attribute: "name", Issuers: []string{"trusted", "deactivated", "unindexed"}, MaxAge: "1y"}}}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Evaluate(context.Background(), src, &p, src.ids["subject"], map[string]Claim{"name": {Value: "Alice", Secret: "secret"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"not a trusted issuer",
+		"signed 731 days ago, more than 1y",
+		"issuer identity is deactivated",
+		"issuer identity is not indexed",
+		"revoked at block 600000",
+	}
+	evidence := res.Rules[0].Evidence
+	if len(evidence) != len(want) {
+		t.Fatalf("got %d pieces of evidence, want one per signature", len(evidence))
+	}
+	for i, e := range evidence {
+		if e.Counted || e.Reason != want[i] {
+			t.Errorf("%s: counted %v, %q, want %q", e.IDKey, e.Counted, e.Reason, want[i])
+		}
+	}
+}
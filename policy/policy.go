@@ -0,0 +1,134 @@
+// Package policy evaluates declarative attestation policies for relying
+// parties, e.g. "name is verified if at least 2 of our trusted issuers
+// attested it, none revoked, and the newest signature is under a year old".
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ways rules combine
+const (
+	MatchAll = "all"
+	MatchAny = "any"
+)
+
+// Policy is a set of rules a subject identity has to meet
+type Policy struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty" example:"verified-name"`
+	// Match is "all" (default) or "any" of the rules
+	Match string `json:"match,omitempty" yaml:"match,omitempty" example:"all"`
+	// AllowInvalidSubject passes a subject that is deactivated, or disputed
+	// where disputed identities aren't valid
+	AllowInvalidSubject bool   `json:"allowInvalidSubject,omitempty" yaml:"allowInvalidSubject,omitempty"`
+	Rules               []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule is met when enough signatures of the subject's attestation of
+// Attribute count. A REVOKE removes the issuer's signature from the
+// attestation's signers, so revoked signatures never count.
+type Rule struct {
+	Attribute string `json:"attribute" yaml:"attribute" example:"name"`
+	// MinSigners is how many signatures have to count, 1 when unset
+	MinSigners int `json:"minSigners,omitempty" yaml:"minSigners,omitempty" example:"2"`
+	// Issuers lists the idKeys whose signatures count, any when empty
+	Issuers []string `json:"issuers,omitempty" yaml:"issuers,omitempty"`
+	// MaxAge drops signatures older than this ("720h", "30d", "1y")
+	MaxAge string `json:"maxAge,omitempty" yaml:"maxAge,omitempty" example:"1y"`
+	// NewestWithin fails the rule unless a counted signature is this recent
+	NewestWithin string `json:"newestWithin,omitempty" yaml:"newestWithin,omitempty" example:"1y"`
+	// AllowInvalidIssuers counts signatures of issuers that are no longer
+	// valid
+	AllowInvalidIssuers bool `json:"allowInvalidIssuers,omitempty" yaml:"allowInvalidIssuers,omitempty"`
+
+	maxAge, newestWithin time.Duration
+}
+
+// Claim is the attestation a subject presents for an attribute: either its
+// hash, or the attribute value and secret to derive the hash from
+type Claim struct {
+	Value  string `json:"value,omitempty" yaml:"value,omitempty" example:"John Doe"`
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty" example:"e2c6fb4063cc04af58935737eaffc938011dff546d47b7fbb18ed346f8c93d5c"`
+	Hash   string `json:"hash,omitempty" yaml:"hash,omitempty"`
+}
+
+// ErrInvalidPolicy is returned for policies that can't be evaluated
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Validate checks p and fills in its defaults
+func (p *Policy) Validate() error {
+	switch p.Match {
+	case "":
+		p.Match = MatchAll
+	case MatchAll, MatchAny:
+	default:
+		return fmt.Errorf("%w: match must be %q or %q", ErrInvalidPolicy, MatchAll, MatchAny)
+	}
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("%w: no rules", ErrInvalidPolicy)
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Attribute == "" {
+			return fmt.Errorf("%w: rule %d has no attribute", ErrInvalidPolicy, i)
+		}
+		if r.MinSigners < 0 {
+			return fmt.Errorf("%w: rule %d: minSigners can't be negative", ErrInvalidPolicy, i)
+		} else if r.MinSigners == 0 {
+			r.MinSigners = 1
+		}
+		var err error
+		if r.maxAge, err = parseAge(r.MaxAge); err != nil {
+			return fmt.Errorf("%w: rule %d: maxAge: %v", ErrInvalidPolicy, i, err)
+		}
+		if r.newestWithin, err = parseAge(r.NewestWithin); err != nil {
+			return fmt.Errorf("%w: rule %d: newestWithin: %v", ErrInvalidPolicy, i, err)
+		}
+	}
+	return nil
+}
+
+// parseAge reads a Go duration, or a whole number of days ("30d") or years
+// ("1y", 365 days). Empty is no limit.
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	for _, u := range []struct {
+		suffix string
+		unit   time.Duration
+	}{{"d", 24 * time.Hour}, {"y", 365 * 24 * time.Hour}} {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("%q is not a positive whole number followed by %s", s, u.suffix)
+			}
+			return time.Duration(v) * u.unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%q is not positive", s)
+	}
+	return d, nil
+}
+
+// AttestationHash is the hash a subject's attestation of attribute is
+// published under, as defined by BAP:
+//
+//	sha256("urn:bap:attest:" + sha256("urn:bap:id:" + attribute + ":" + value + ":" + secret) + ":" + idKey)
+func AttestationHash(attribute string, value string, secret string, idKey string) string {
+	idUrn := sha256.Sum256([]byte(fmt.Sprintf("urn:bap:id:%s:%s:%s", attribute, value, secret)))
+	hash := sha256.Sum256([]byte(fmt.Sprintf("urn:bap:attest:%s:%s", hex.EncodeToString(idUrn[:]), idKey)))
+	return hex.EncodeToString(hash[:])
+}
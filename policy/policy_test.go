@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAttestationHash(t *testing.T) {
+	// the id urn of the BAP spec example hashes to
+	// b17c8e606afcf0d8dca65bdf8f33d275239438116557980203c82b0fae259838
+	got := AttestationHash("name", "John Doe", "e2c6fb4063cc04af58935737eaffc938011dff546d47b7fbb18ed346f8c4d4fa", "3QxhyGy6ZE5SUpzXVb6AwnXYwH8g")
+	if want := "d0d047a581b5fbabd8b40ae0d7dc6f6a69cb683850bbbd7e78c5e009182b56f1"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		err    bool
+		// match and minSigners of the first rule after defaults
+		match        string
+		minSigners   int
+		maxAge       time.Duration
+		newestWithin time.Duration
+	}{
+		{
+			name:       "defaults",
+			policy:     Policy{Rules: []Rule{{Attribute: "name"}}},
+			match:      MatchAll,
+			minSigners: 1,
+		},
+		{
+			name:         "ages",
+			policy:       Policy{Match: MatchAny, Rules: []Rule{{Attribute: "name", MinSigners: 2, MaxAge: "30d", NewestWithin: "1y"}}},
+			match:        MatchAny,
+			minSigners:   2,
+			maxAge:       30 * 24 * time.Hour,
+			newestWithin: 365 * 24 * time.Hour,
+		},
+		{
+			name:       "go duration",
+			policy:     Policy{Rules: []Rule{{Attribute: "name", MaxAge: "36h"}}},
+			match:      MatchAll,
+			minSigners: 1,
+			maxAge:     36 * time.Hour,
+		},
+		{name: "unknown match", policy: Policy{Match: "most", Rules: []Rule{{Attribute: "name"}}}, err: true},
+		{name: "no rules", policy: Policy{}, err: true},
+		{name: "no attribute", policy: Policy{Rules: []Rule{{MinSigners: 1}}}, err: true},
+		{name: "negative signers", policy: Policy{Rules: []Rule{{Attribute: "name", MinSigners: -1}}}, err: true},
+		{name: "zero days", policy: Policy{Rules: []Rule{{Attribute: "name", MaxAge: "0d"}}}, err: true},
+		{name: "fractional years", policy: Policy{Rules: []Rule{{Attribute: "name", NewestWithin: "1.5y"}}}, err: true},
+		{name: "negative duration", policy: Policy{Rules: []Rule{{Attribute: "name", MaxAge: "-1h"}}}, err: true},
+		{name: "not a duration", policy: Policy{Rules: []Rule{{Attribute: "name", MaxAge: "soon"}}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			err := p.Validate()
+			if tt.err {
+				if !errors.Is(err, ErrInvalidPolicy) {
+					t.Errorf("got %v, want %v", err, ErrInvalidPolicy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := p.Rules[0]
+			if p.Match != tt.match || r.MinSigners != tt.minSigners || r.maxAge != tt.maxAge || r.newestWithin != tt.newestWithin {
+				t.Errorf("match %s, rule %+v", p.Match, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package profile
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/resolver"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// ExtractMedia replaces the data urls in data longer than maxInline bytes,
+// at any depth, with blob://<sha256> references and returns the blobs they
+// point at. It modifies data in place. Data urls that don't decode are left
+// for Normalize to warn about.
+func ExtractMedia(data map[string]interface{}, maxInline int) []*types.Blob {
+	var blobs []*types.Blob
+	var walk func(value interface{}) interface{}
+	walk = func(value interface{}) interface{} {
+		if items, ok := list(value); ok {
+			for i, item := range items {
+				items[i] = walk(item)
+			}
+			return value
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				v[key] = walk(item)
+			}
+		case string:
+			if len(v) <= maxInline || !strings.HasPrefix(v, "data:") {
+				return v
+			}
+			media, err := resolver.DecodeDataURL(v)
+			if err != nil {
+				return v
+			}
+			blob := &types.Blob{Hash: media.Hash, ContentType: media.ContentType, Size: len(media.Data), Data: media.Data}
+			if !slices.ContainsFunc(blobs, func(b *types.Blob) bool { return b.Hash == blob.Hash }) {
+				blobs = append(blobs, blob)
+			}
+			return (&resolver.Ref{Kind: resolver.KindBlob, Hash: blob.Hash}).String()
+		}
+		return value
+	}
+	walk(data)
+	return blobs
+}
@@ -0,0 +1,54 @@
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestExtractMedia(t *testing.T) {
+	// a png signature padded past the inline limit
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	large := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	small := "data:image/png;base64,iVBORw0KGgo="
+	sum := sha256.Sum256(png)
+	ref := "blob://" + hex.EncodeToString(sum[:])
+
+	data := map[string]interface{}{
+		"@type": "Person",
+		"image": large,
+		"logo":  small,
+		"homeLocation": map[string]interface{}{
+			"image": large,
+		},
+		"sameAs": []interface{}{large, "https://example.com"},
+		"bad":    "data:image/png;base64," + strings.Repeat("!", 64),
+	}
+	blobs := ExtractMedia(data, 40)
+
+	if len(blobs) != 1 {
+		t.Fatalf("got %d blobs, want the large image once", len(blobs))
+	}
+	if b := blobs[0]; b.Hash != ref[len("blob://"):] || b.ContentType != "image/png" || b.Size != len(png) || string(b.Data) != string(png) {
+		t.Errorf("blob %s %s %d bytes, want the png", b.Hash, b.ContentType, b.Size)
+	}
+
+	// data is rewritten in place
+	for name, got := range map[string]interface{}{
+		"image":              data["image"],
+		"homeLocation.image": data["homeLocation"].(map[string]interface{})["image"],
+		"sameAs.0":           data["sameAs"].([]interface{})[0],
+	} {
+		if got != ref {
+			t.Errorf("%s is %v, want %s", name, got, ref)
+		}
+	}
+	if data["logo"] != small {
+		t.Errorf("logo under the limit was rewritten to %v", data["logo"])
+	}
+	if s, _ := data["bad"].(string); !strings.HasPrefix(s, "data:") {
+		t.Errorf("undecodable data url was rewritten to %v", data["bad"])
+	}
+}
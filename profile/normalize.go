@@ -0,0 +1,274 @@
+// Package profile checks ALIAS profiles against the schema.org Person and
+// Organization shapes and normalizes the fields BAP clients rely on.
+//
+// It is tolerant: a field that doesn't fit is left out of the normalized
+// profile with a warning, and the raw profile is kept as published, apart
+// from the large inline media ExtractMedia moves to blobs.
+package profile
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/resolver"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// personOnly and organizationOnly are the fields schema.org only defines
+// on one of the two types
+var (
+	personOnly       = []string{"givenName", "familyName", "homeLocation"}
+	organizationOnly = []string{"logo"}
+)
+
+// Normalize returns the typed form of a profile's data and what doesn't fit
+// the schema
+func Normalize(data map[string]interface{}) (*types.Profile, []string) {
+	n := &normalizer{data: data}
+	p := &types.Profile{Type: n.profileType()}
+
+	p.Name = n.text("name")
+	p.AlternateName = n.texts("alternateName")
+	p.Description = n.text("description")
+	p.Email = n.email("email")
+	p.Paymail = n.paymail("paymail")
+	p.URL = n.url("url")
+	p.Image = n.media("image")
+	p.Logo = n.media("logo")
+	p.Banner = n.media("banner")
+	p.SameAs = n.urls("sameAs")
+	p.GivenName = n.text("givenName")
+	p.FamilyName = n.text("familyName")
+	p.HomeLocation = n.place("homeLocation")
+
+	for _, field := range personOnly {
+		if _, ok := data[field]; ok && p.Type == types.ProfileOrganization {
+			n.warn("%s is not an Organization field", field)
+		}
+	}
+	for _, field := range organizationOnly {
+		if _, ok := data[field]; ok && p.Type == types.ProfilePerson {
+			n.warn("%s is not a Person field", field)
+		}
+	}
+	return p, n.warnings
+}
+
+type normalizer struct {
+	data     map[string]interface{}
+	warnings []string
+}
+
+func (n *normalizer) warn(format string, args ...interface{}) {
+	n.warnings = append(n.warnings, fmt.Sprintf(format, args...))
+}
+
+// profileType reads @type, checking @context is schema.org. Profiles
+// without a type are people.
+func (n *normalizer) profileType() string {
+	switch context := n.data["@context"].(type) {
+	case nil:
+		n.warn("no @context, assuming schema.org")
+	case string:
+		if !strings.Contains(context, "schema.org") {
+			n.warn("@context %q is not schema.org", context)
+		}
+	default:
+		n.warn("@context is %s, not schema.org", kind(context))
+	}
+
+	value, ok := n.data["@type"]
+	if !ok {
+		n.warn("no @type, assuming Person")
+		return types.ProfilePerson
+	}
+	t, ok := value.(string)
+	if !ok {
+		n.warn("@type is %s, assuming Person", kind(value))
+		return types.ProfilePerson
+	}
+	t = strings.TrimPrefix(t, "schema:")
+	t = t[strings.LastIndex(t, "/")+1:]
+	switch t {
+	case types.ProfilePerson, types.ProfileOrganization:
+		return t
+	}
+	n.warn("@type %q is not Person or Organization, assuming Person", value)
+	return types.ProfilePerson
+}
+
+// text reads a trimmed string field
+func (n *normalizer) text(field string) string {
+	value, ok := n.data[field]
+	if !ok || value == nil {
+		return ""
+	}
+	s, ok := value.(string)
+	if !ok {
+		n.warn("%s is %s, not text", field, kind(value))
+		return ""
+	}
+	return strings.TrimSpace(s)
+}
+
+// texts reads a field that is text or a list of text, like alternateName
+func (n *normalizer) texts(field string) []string {
+	value, ok := n.data[field]
+	if !ok || value == nil {
+		return nil
+	}
+	items, isList := list(value)
+	if !isList {
+		items = []interface{}{value}
+	}
+
+	var texts []string
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			n.warn("%s has %s, not text", field, kind(item))
+			continue
+		}
+		if s = strings.TrimSpace(s); s != "" && !slices.Contains(texts, s) {
+			texts = append(texts, s)
+		}
+	}
+	return texts
+}
+
+func (n *normalizer) email(field string) string {
+	s := n.text(field)
+	if s == "" {
+		return ""
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		n.warn("%s %q is not an email address", field, s)
+		return ""
+	}
+	return addr.Address
+}
+
+// paymail lowercases a paymail handle, dropping a mailto: or leading $
+func (n *normalizer) paymail(field string) string {
+	s := strings.ToLower(n.text(field))
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "mailto:"), "$")
+	if s == "" {
+		return ""
+	}
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" || !strings.Contains(domain, ".") || strings.ContainsAny(s, " \t/") || strings.Contains(domain, "@") {
+		n.warn("%s %q is not a paymail", field, n.data[field])
+		return ""
+	}
+	return s
+}
+
+func (n *normalizer) url(field string) string {
+	s := n.text(field)
+	if s == "" {
+		return ""
+	}
+	if normalized, ok := webURL(s); ok {
+		return normalized
+	}
+	n.warn("%s %q is not an http(s) url", field, s)
+	return ""
+}
+
+func (n *normalizer) urls(field string) []string {
+	var urls []string
+	for _, s := range n.texts(field) {
+		if normalized, ok := webURL(s); ok {
+			urls = append(urls, normalized)
+		} else {
+			n.warn("%s %q is not an http(s) url", field, s)
+		}
+	}
+	return urls
+}
+
+// media reads an image field as a canonical content reference. schema.org
+// ImageObjects are read by their url or contentUrl.
+func (n *normalizer) media(field string) string {
+	value, ok := n.data[field]
+	if !ok || value == nil {
+		return ""
+	}
+	if obj, ok := value.(map[string]interface{}); ok {
+		if value, ok = obj["contentUrl"]; !ok {
+			value = obj["url"]
+		}
+	}
+	s, ok := value.(string)
+	if !ok {
+		n.warn("%s is %s, not a url or content reference", field, kind(value))
+		return ""
+	}
+	ref, err := resolver.Parse(s)
+	if err != nil {
+		n.warn("%s: %v", field, err)
+		return ""
+	}
+	return ref.String()
+}
+
+// place reads a schema.org Place, or a plain place name, as its name
+func (n *normalizer) place(field string) string {
+	value, ok := n.data[field]
+	if !ok || value == nil {
+		return ""
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		if name, ok := v["name"].(string); ok {
+			return strings.TrimSpace(name)
+		}
+	}
+	n.warn("%s is %s, not a place name or Place with a name", field, kind(value))
+	return ""
+}
+
+// webURL parses an http(s) url
+func webURL(s string) (string, bool) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// list returns value as a list, whether decoded from json or bson
+func list(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case primitive.A:
+		return v, true
+	}
+	return nil, false
+}
+
+// kind names the json type of value for warnings
+func kind(value interface{}) string {
+	if _, ok := list(value); ok {
+		return "a list"
+	}
+	switch value.(type) {
+	case string:
+		return "text"
+	case bool:
+		return "a boolean"
+	case map[string]interface{}:
+		return "an object"
+	case nil:
+		return "null"
+	}
+	return "a number"
+}
@@ -0,0 +1,162 @@
+package profile
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testTxid = "1fd626dc8286d449d4c2cf3b5b70d169728f5ffefd5c3a3205d4970e21fbf187"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		want     types.Profile
+		warnings []string
+	}{
+		{
+			name: "person",
+			json: `{
+				"@context": "https://schema.org",
+				"@type": "Person",
+				"name": " Satoshi ",
+				"alternateName": ["Sato", "Sato", " ", "Nakamoto"],
+				"givenName": "Satoshi",
+				"familyName": "Nakamoto",
+				"description": "hi",
+				"email": "Satoshi <satoshi@example.com>",
+				"paymail": "mailto:$Satoshi@HandCash.io",
+				"url": "https://example.com/me",
+				"image": "/` + testTxid + `",
+				"banner": {"@type": "ImageObject", "contentUrl": "ord://` + testTxid + `_1"},
+				"homeLocation": {"@type": "Place", "name": " Tokyo "},
+				"sameAs": "https://twitter.com/satoshi"
+			}`,
+			want: types.Profile{
+				Type:          types.ProfilePerson,
+				Name:          "Satoshi",
+				AlternateName: []string{"Sato", "Nakamoto"},
+				GivenName:     "Satoshi",
+				FamilyName:    "Nakamoto",
+				Description:   "hi",
+				Email:         "satoshi@example.com",
+				Paymail:       "satoshi@handcash.io",
+				URL:           "https://example.com/me",
+				Image:         "b://" + testTxid,
+				Banner:        "ord://" + testTxid + "_1",
+				HomeLocation:  "Tokyo",
+				SameAs:        []string{"https://twitter.com/satoshi"},
+			},
+		},
+		{
+			name: "organization",
+			json: `{
+				"@context": "http://schema.org/",
+				"@type": "schema:Organization",
+				"name": "Acme",
+				"logo": {"url": "https://example.com/logo.png"},
+				"givenName": "Wile"
+			}`,
+			want: types.Profile{
+				Type:      types.ProfileOrganization,
+				Name:      "Acme",
+				Logo:      "https://example.com/logo.png",
+				GivenName: "Wile",
+			},
+			warnings: []string{"givenName is not an Organization field"},
+		},
+		{
+			name:     "type as a url",
+			json:     `{"@context": "https://schema.org", "@type": "https://schema.org/Organization"}`,
+			want:     types.Profile{Type: types.ProfileOrganization},
+			warnings: nil,
+		},
+		{
+			name: "no context or type",
+			json: `{"name": "Anon", "logo": "https://example.com/logo.png"}`,
+			want: types.Profile{Type: types.ProfilePerson, Name: "Anon", Logo: "https://example.com/logo.png"},
+			warnings: []string{
+				"no @context, assuming schema.org",
+				"no @type, assuming Person",
+				"logo is not a Person field",
+			},
+		},
+		{
+			name: "unknown context and type",
+			json: `{"@context": "https://example.com", "@type": "Thing"}`,
+			want: types.Profile{Type: types.ProfilePerson},
+			warnings: []string{
+				`@context "https://example.com" is not schema.org`,
+				`@type "Thing" is not Person or Organization, assuming Person`,
+			},
+		},
+		{
+			name: "wrong shapes",
+			json: `{
+				"@context": ["https://schema.org"],
+				"@type": 1,
+				"name": 42,
+				"alternateName": ["ok", true],
+				"email": "not an email",
+				"paymail": "no-domain@",
+				"url": "ftp://example.com",
+				"image": {"name": "no url"},
+				"banner": "ipfs://bafy",
+				"homeLocation": {"address": "no name"},
+				"sameAs": ["https://ok.example", "javascript:alert(1)"],
+				"description": null
+			}`,
+			want: types.Profile{
+				Type:          types.ProfilePerson,
+				AlternateName: []string{"ok"},
+				SameAs:        []string{"https://ok.example"},
+			},
+			warnings: []string{
+				"@context is a list, not schema.org",
+				"@type is a number, assuming Person",
+				"name is a number, not text",
+				"alternateName has a boolean, not text",
+				`email "not an email" is not an email address`,
+				`paymail "no-domain@" is not a paymail`,
+				`url "ftp://example.com" is not an http(s) url`,
+				"image is null, not a url or content reference",
+				"banner: invalid content reference",
+				`sameAs "javascript:alert(1)" is not an http(s) url`,
+				"homeLocation is an object, not a place name or Place with a name",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(tt.json), &data); err != nil {
+				t.Fatal(err)
+			}
+			p, warnings := Normalize(data)
+			if !reflect.DeepEqual(*p, tt.want) {
+				t.Errorf("got %+v\nwant %+v", *p, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings %q\nwant %q", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestNormalizeBSONLists(t *testing.T) {
+	// profiles read back from mongo hold primitive.A rather than []interface{}
+	p, warnings := Normalize(map[string]interface{}{
+		"@context":      "https://schema.org",
+		"@type":         "Person",
+		"alternateName": primitive.A{"Sato"},
+		"sameAs":        primitive.A{"https://example.com"},
+	})
+	if !reflect.DeepEqual(p.AlternateName, []string{"Sato"}) || !reflect.DeepEqual(p.SameAs, []string{"https://example.com"}) || warnings != nil {
+		t.Errorf("got %+v, %q", p, warnings)
+	}
+}
@@ -0,0 +1,152 @@
+package resolver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/BitcoinSchema/go-bap-indexer/imageproxy"
+	"github.com/bitcoin-sv/go-sdk/script"
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-b"
+)
+
+// ordTag marks an ordinal inscription envelope
+var ordTag = []byte("ord")
+
+// Extract pulls the content ref points at straight out of a raw transaction
+func Extract(rawtx []byte, ref *Ref) (*imageproxy.Media, error) {
+	tx, err := transaction.NewTransactionFromBytes(rawtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	var contentType string
+	switch ref.Kind {
+	case KindBitfs:
+		chunks, err := outputChunks(tx, ref.Vout)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Chunk >= len(chunks) || len(chunks[ref.Chunk].Data) == 0 {
+			return nil, fmt.Errorf("%w: %s has no data in chunk %d", imageproxy.ErrNotFound, ref, ref.Chunk)
+		}
+		data = chunks[ref.Chunk].Data
+		// when the chunk is the payload of a B record the media type follows it
+		if ref.Chunk > 0 && string(chunks[ref.Chunk-1].Data) == b.Prefix && ref.Chunk+1 < len(chunks) {
+			contentType = string(chunks[ref.Chunk+1].Data)
+		}
+
+	case KindB:
+		for vout := range tx.Outputs {
+			chunks, _ := outputChunks(tx, vout)
+			if data, contentType = bRecord(chunks); data != nil {
+				break
+			}
+		}
+		if data == nil {
+			return nil, fmt.Errorf("%w: %s has no B output", imageproxy.ErrNotFound, ref)
+		}
+
+	case KindOrd:
+		chunks, err := outputChunks(tx, ref.Vout)
+		if err != nil {
+			return nil, err
+		}
+		// /<txid>_<vout> paths are also used for B records in a given output
+		if data, contentType = inscription(chunks); data == nil {
+			if data, contentType = bRecord(chunks); data == nil {
+				return nil, fmt.Errorf("%w: %s has no inscription or B record", imageproxy.ErrNotFound, ref)
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("%s references can't be extracted from a transaction", ref.Kind)
+	}
+
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return &imageproxy.Media{
+		Data:        data,
+		ContentType: contentType,
+		Hash:        imageproxy.Hash(data),
+	}, nil
+}
+
+// outputChunks decodes the locking script of output vout. Scripts with
+// trailing garbage after OP_RETURN still yield the chunks before it.
+func outputChunks(tx *transaction.Transaction, vout int) ([]*script.ScriptChunk, error) {
+	if vout >= len(tx.Outputs) || tx.Outputs[vout].LockingScript == nil {
+		return nil, fmt.Errorf("%w: output %d does not exist", imageproxy.ErrNotFound, vout)
+	}
+	chunks, _ := script.DecodeScript(*tx.Outputs[vout].LockingScript)
+	return chunks, nil
+}
+
+// bRecord reads B://<data> <media type> ... from an output
+func bRecord(chunks []*script.ScriptChunk) (data []byte, contentType string) {
+	for i, chunk := range chunks {
+		if string(chunk.Data) == b.Prefix && i+1 < len(chunks) {
+			if i+2 < len(chunks) {
+				contentType = string(chunks[i+2].Data)
+			}
+			return chunks[i+1].Data, contentType
+		}
+	}
+	return nil, ""
+}
+
+// inscription reads an ordinal envelope:
+//
+//	OP_FALSE OP_IF "ord" OP_1 <content-type> OP_0 <data...> OP_ENDIF
+func inscription(chunks []*script.ScriptChunk) (data []byte, contentType string) {
+	for i := 0; i+2 < len(chunks); i++ {
+		if chunks[i].Op != script.OpFALSE || chunks[i+1].Op != script.OpIF || !bytes.Equal(chunks[i+2].Data, ordTag) {
+			continue
+		}
+
+		for j := i + 3; j < len(chunks); j++ {
+			op := chunks[j]
+			if op.Op == script.OpENDIF {
+				break
+			}
+			if op.Op == script.Op0 {
+				// everything up to OP_ENDIF is the body, possibly split over pushes
+				for _, body := range chunks[j+1:] {
+					if body.Op == script.OpENDIF {
+						break
+					}
+					data = append(data, body.Data...)
+				}
+				if data == nil {
+					data = []byte{}
+				}
+				return data, contentType
+			}
+
+			// a field tag is followed by its value
+			if j+1 >= len(chunks) {
+				break
+			}
+			if fieldTag(op) == 1 {
+				contentType = string(chunks[j+1].Data)
+			}
+			j++
+		}
+	}
+	return nil, ""
+}
+
+// fieldTag returns the numeric envelope tag encoded by op
+func fieldTag(op *script.ScriptChunk) int {
+	if op.Op >= script.Op1 && op.Op <= script.Op16 {
+		return int(op.Op-script.Op1) + 1
+	}
+	if len(op.Data) == 1 {
+		return int(op.Data[0])
+	}
+	return -1
+}
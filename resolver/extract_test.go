@@ -0,0 +1,179 @@
+package resolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/imageproxy"
+	"github.com/bitcoin-sv/go-sdk/chainhash"
+	"github.com/bitcoin-sv/go-sdk/script"
+	"github.com/bitcoin-sv/go-sdk/transaction"
+	"github.com/bitcoinschema/go-b"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+// opReturn is OP_FALSE OP_RETURN followed by pushes
+func opReturn(t *testing.T, pushes ...string) *script.Script {
+	t.Helper()
+	s := &script.Script{}
+	if err := s.AppendOpcodes(script.OpFALSE, script.OpRETURN); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPushDataStrings(pushes); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// envelope is a 1 sat ordinal output inscribed with body, split over
+// pushes, and a content type when it isn't empty
+func envelope(t *testing.T, contentType string, body ...string) *script.Script {
+	t.Helper()
+	s := &script.Script{}
+	s.AppendOpcodes(script.OpDUP, script.OpDROP, script.OpFALSE, script.OpIF)
+	s.AppendPushDataString("ord")
+	if contentType != "" {
+		s.AppendOpcodes(script.Op1)
+		s.AppendPushDataString(contentType)
+	}
+	s.AppendOpcodes(script.Op0)
+	s.AppendPushDataStrings(body)
+	s.AppendOpcodes(script.OpENDIF)
+	return s
+}
+
+// rawTx serializes a tx with one input and outputs with the given scripts
+func rawTx(outputs ...*script.Script) []byte {
+	tx := transaction.NewTransaction()
+	tx.AddInput(&transaction.TransactionInput{
+		SourceTXID:      &chainhash.Hash{1},
+		UnlockingScript: &script.Script{},
+		SequenceNumber:  0xffffffff,
+	})
+	for _, s := range outputs {
+		tx.AddOutput(&transaction.TransactionOutput{Satoshis: 1, LockingScript: s})
+	}
+	return tx.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	png := string(pngHeader) + "image data"
+	tests := []struct {
+		name        string
+		outputs     func(t *testing.T) []*script.Script
+		ref         Ref
+		data        string
+		contentType string
+		err         error
+	}{
+		{
+			name: "bitfs chunk of a B record",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, b.Prefix, png, "image/png", "binary")}
+			},
+			ref:         Ref{Kind: KindBitfs, Chunk: 3},
+			data:        png,
+			contentType: "image/png",
+		},
+		{
+			name: "bitfs chunk sniffed",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, "some", png)}
+			},
+			ref:         Ref{Kind: KindBitfs, Chunk: 3},
+			data:        png,
+			contentType: "image/png",
+		},
+		{
+			name: "bitfs chunk past the end",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, png)}
+			},
+			ref: Ref{Kind: KindBitfs, Chunk: 5},
+			err: imageproxy.ErrNotFound,
+		},
+		{
+			name: "bitfs missing output",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, png)}
+			},
+			ref: Ref{Kind: KindBitfs, Vout: 1, Chunk: 2},
+			err: imageproxy.ErrNotFound,
+		},
+		{
+			name: "b finds the B output",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{envelope(t, "text/plain", "hi"), opReturn(t, b.Prefix, "hello", "text/plain")}
+			},
+			ref:         Ref{Kind: KindB},
+			data:        "hello",
+			contentType: "text/plain",
+		},
+		{
+			name: "b without a B output",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, "hello")}
+			},
+			ref: Ref{Kind: KindB},
+			err: imageproxy.ErrNotFound,
+		},
+		{
+			name: "ord inscription split over pushes",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, "x"), envelope(t, "image/png", png[:5], png[5:])}
+			},
+			ref:         Ref{Kind: KindOrd, Vout: 1},
+			data:        png,
+			contentType: "image/png",
+		},
+		{
+			name: "ord inscription without a content type",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{envelope(t, "", png)}
+			},
+			ref:         Ref{Kind: KindOrd},
+			data:        png,
+			contentType: "image/png",
+		},
+		{
+			name: "ord path to a B record",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, b.Prefix, "hello", "text/markdown")}
+			},
+			ref:         Ref{Kind: KindOrd},
+			data:        "hello",
+			contentType: "text/markdown",
+		},
+		{
+			name: "ord output with neither",
+			outputs: func(t *testing.T) []*script.Script {
+				return []*script.Script{opReturn(t, "hello")}
+			},
+			ref: Ref{Kind: KindOrd},
+			err: imageproxy.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Extract(rawTx(tt.outputs(t)...), &tt.ref)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if string(m.Data) != tt.data || m.ContentType != tt.contentType || m.Hash != imageproxy.Hash(m.Data) {
+				t.Errorf("got %q as %s, want %q as %s", m.Data, m.ContentType, tt.data, tt.contentType)
+			}
+		})
+	}
+
+	if _, err := Extract(rawTx(opReturn(t, "x")), &Ref{Kind: KindURL}); err == nil {
+		t.Error("extracted a url ref from a tx")
+	}
+	if _, err := Extract([]byte{1, 2, 3}, &Ref{Kind: KindB}); err == nil {
+		t.Error("extracted from a truncated tx")
+	}
+}
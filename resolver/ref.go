@@ -0,0 +1,159 @@
+package resolver
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRef is returned when a profile value can't be understood as a
+// content reference
+var ErrInvalidRef = errors.New("invalid content reference")
+
+// Kind is the addressing scheme of a content reference
+type Kind string
+
+// Supported content reference schemes
+const (
+	KindData  Kind = "data"  // data:<mediatype>;base64,<data>
+	KindBitfs Kind = "bitfs" // bitfs://<txid>.out.<vout>.<chunk>
+	KindB     Kind = "b"     // b://<txid>, a raw <txid> or /<txid>
+	KindOrd   Kind = "ord"   // ord://<txid>_<vout> or /<txid>_<vout>
+	KindURL   Kind = "url"   // plain http(s) url
+	KindBlob  Kind = "blob"  // blob://<sha256>, profile media kept in the blob store
+)
+
+// Ref is a parsed pointer to a piece of on-chain (or off-chain) content
+type Ref struct {
+	Kind  Kind
+	Txid  string
+	Vout  int
+	Chunk int
+	// URL is set for KindURL, Data holds the raw data url for KindData
+	URL  string
+	Data string
+	// Hash is the sha256 of the content for KindBlob
+	Hash string
+}
+
+// Parse understands every way a BAP profile tends to point at media:
+//
+//	bitfs://<txid>.out.<vout>.<chunk>
+//	b://<txid>
+//	ord://<txid>_<vout>
+//	<txid>
+//	/<txid> and /<txid>_<vout>
+//	data:<mediatype>;base64,<data>
+//	blob://<sha256>
+//	http(s)://...
+func Parse(value string) (*Ref, error) {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case value == "":
+		return nil, ErrInvalidRef
+
+	case strings.HasPrefix(value, "data:"):
+		return &Ref{Kind: KindData, Data: value}, nil
+
+	case strings.HasPrefix(value, "bitfs://"):
+		// <txid>.out.<vout>.<chunk>
+		parts := strings.Split(strings.TrimPrefix(value, "bitfs://"), ".")
+		if len(parts) != 4 || parts[1] != "out" || !isTxid(parts[0]) {
+			return nil, fmt.Errorf("%w: bitfs url must look like bitfs://<txid>.out.<vout>.<chunk>", ErrInvalidRef)
+		}
+		vout, err := strconv.Atoi(parts[2])
+		if err != nil || vout < 0 {
+			return nil, fmt.Errorf("%w: bad bitfs vout %q", ErrInvalidRef, parts[2])
+		}
+		chunk, err := strconv.Atoi(parts[3])
+		if err != nil || chunk < 0 {
+			return nil, fmt.Errorf("%w: bad bitfs chunk %q", ErrInvalidRef, parts[3])
+		}
+		return &Ref{Kind: KindBitfs, Txid: strings.ToLower(parts[0]), Vout: vout, Chunk: chunk}, nil
+
+	case strings.HasPrefix(value, "b://"):
+		txid := strings.TrimPrefix(value, "b://")
+		if !isTxid(txid) {
+			return nil, fmt.Errorf("%w: bad b:// txid", ErrInvalidRef)
+		}
+		return &Ref{Kind: KindB, Txid: strings.ToLower(txid)}, nil
+
+	case strings.HasPrefix(value, "ord://"):
+		return parseOutpoint(strings.TrimPrefix(value, "ord://"))
+
+	case strings.HasPrefix(value, "blob://"):
+		hash := strings.TrimPrefix(value, "blob://")
+		if !isTxid(hash) {
+			return nil, fmt.Errorf("%w: bad blob:// hash", ErrInvalidRef)
+		}
+		return &Ref{Kind: KindBlob, Hash: strings.ToLower(hash)}, nil
+
+	case strings.HasPrefix(value, "http://"), strings.HasPrefix(value, "https://"):
+		return &Ref{Kind: KindURL, URL: value}, nil
+
+	case strings.HasPrefix(value, "/"):
+		path := strings.TrimPrefix(value, "/")
+		if isTxid(path) {
+			return &Ref{Kind: KindB, Txid: strings.ToLower(path)}, nil
+		}
+		return parseOutpoint(path)
+
+	case isTxid(value):
+		return &Ref{Kind: KindB, Txid: strings.ToLower(value)}, nil
+	}
+
+	return nil, ErrInvalidRef
+}
+
+// String is the canonical form of the reference, suitable as a cache key
+func (r *Ref) String() string {
+	switch r.Kind {
+	case KindData:
+		return r.Data
+	case KindBitfs:
+		return fmt.Sprintf("bitfs://%s.out.%d.%d", r.Txid, r.Vout, r.Chunk)
+	case KindB:
+		return "b://" + r.Txid
+	case KindOrd:
+		return fmt.Sprintf("ord://%s_%d", r.Txid, r.Vout)
+	case KindBlob:
+		return "blob://" + r.Hash
+	}
+	return r.URL
+}
+
+// GatewayPath is the path of this content on an ordfs style gateway
+func (r *Ref) GatewayPath() string {
+	switch r.Kind {
+	case KindBitfs, KindOrd:
+		return fmt.Sprintf("/%s_%d", r.Txid, r.Vout)
+	case KindB:
+		return "/" + r.Txid
+	}
+	return ""
+}
+
+// parseOutpoint parses <txid>_<vout>
+func parseOutpoint(s string) (*Ref, error) {
+	txid, voutStr, ok := strings.Cut(s, "_")
+	if !ok || !isTxid(txid) {
+		return nil, fmt.Errorf("%w: expected <txid>_<vout>", ErrInvalidRef)
+	}
+	vout, err := strconv.Atoi(voutStr)
+	if err != nil || vout < 0 {
+		return nil, fmt.Errorf("%w: bad vout %q", ErrInvalidRef, voutStr)
+	}
+	return &Ref{Kind: KindOrd, Txid: strings.ToLower(txid), Vout: vout}, nil
+}
+
+// isTxid reports whether s is 32 hex encoded bytes, like a txid or sha256
+func isTxid(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,118 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testTxid = "1fd626dc8286d449d4c2cf3b5b70d169728f5ffefd5c3a3205d4970e21fbf187"
+	testHash = "b17c8e606afcf0d8dca65bdf8f33d275239438116557980203c82b0fae259838"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Ref
+		// canonical is what String returns, path the gateway path
+		canonical string
+		path      string
+		err       bool
+	}{
+		{
+			value:     "bitfs://" + testTxid + ".out.1.3",
+			want:      Ref{Kind: KindBitfs, Txid: testTxid, Vout: 1, Chunk: 3},
+			canonical: "bitfs://" + testTxid + ".out.1.3",
+			path:      "/" + testTxid + "_1",
+		},
+		{
+			value:     "b://" + strings.ToUpper(testTxid),
+			want:      Ref{Kind: KindB, Txid: testTxid},
+			canonical: "b://" + testTxid,
+			path:      "/" + testTxid,
+		},
+		{
+			value:     "  " + testTxid + "\n",
+			want:      Ref{Kind: KindB, Txid: testTxid},
+			canonical: "b://" + testTxid,
+			path:      "/" + testTxid,
+		},
+		{
+			value:     "/" + testTxid,
+			want:      Ref{Kind: KindB, Txid: testTxid},
+			canonical: "b://" + testTxid,
+			path:      "/" + testTxid,
+		},
+		{
+			value:     "ord://" + testTxid + "_0",
+			want:      Ref{Kind: KindOrd, Txid: testTxid},
+			canonical: "ord://" + testTxid + "_0",
+			path:      "/" + testTxid + "_0",
+		},
+		{
+			value:     "/" + testTxid + "_2",
+			want:      Ref{Kind: KindOrd, Txid: testTxid, Vout: 2},
+			canonical: "ord://" + testTxid + "_2",
+			path:      "/" + testTxid + "_2",
+		},
+		{
+			value:     "blob://" + testHash,
+			want:      Ref{Kind: KindBlob, Hash: testHash},
+			canonical: "blob://" + testHash,
+		},
+		{
+			value:     "data:image/png;base64,iVBORw0KGgo=",
+			want:      Ref{Kind: KindData, Data: "data:image/png;base64,iVBORw0KGgo="},
+			canonical: "data:image/png;base64,iVBORw0KGgo=",
+		},
+		{
+			value:     "https://example.com/a.png",
+			want:      Ref{Kind: KindURL, URL: "https://example.com/a.png"},
+			canonical: "https://example.com/a.png",
+		},
+		{value: "", err: true},
+		{value: "bitfs://" + testTxid + ".out.1", err: true},
+		{value: "bitfs://" + testTxid + ".in.1.3", err: true},
+		{value: "bitfs://" + testTxid + ".out.-1.3", err: true},
+		{value: "bitfs://" + testTxid + ".out.1.x", err: true},
+		{value: "bitfs://abc.out.1.3", err: true},
+		{value: "b://" + testTxid[:63], err: true},
+		{value: "ord://" + testTxid, err: true},
+		{value: "ord://" + testTxid + "_x", err: true},
+		{value: "blob://" + testHash + "00", err: true},
+		{value: "/not-a-txid", err: true},
+		{value: "ipfs://bafy", err: true},
+		{value: "John Doe", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ref, err := Parse(tt.value)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidRef) {
+					t.Errorf("got %+v, %v, want %v", ref, err, ErrInvalidRef)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *ref != tt.want {
+				t.Errorf("got %+v, want %+v", *ref, tt.want)
+			}
+			if got := ref.String(); got != tt.canonical {
+				t.Errorf("String() = %s, want %s", got, tt.canonical)
+			}
+			if got := ref.GatewayPath(); got != tt.path {
+				t.Errorf("GatewayPath() = %s, want %s", got, tt.path)
+			}
+
+			// the canonical form parses back to the same ref
+			again, err := Parse(ref.String())
+			if err != nil || *again != *ref {
+				t.Errorf("%s parsed back as %+v, %v", ref, again, err)
+			}
+		})
+	}
+}
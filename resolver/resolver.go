@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/imageproxy"
+)
+
+// Resolver turns content references into media. Transaction backed content
+// is extracted from the local archive when possible and fetched from an
+// ordfs style gateway otherwise.
+//
+// Resolver implements imageproxy.Fetcher, so it can sit behind the image cache
+// with canonical references as cache keys.
+type Resolver struct {
+	store   TxStore
+	blobs   BlobStore
+	gateway string
+	fetcher imageproxy.Fetcher
+}
+
+// New creates a resolver. store may be nil when there is no local archive,
+// and blobs when blob:// references can't be resolved.
+func New(store TxStore, blobs BlobStore, gateway string, fetcher imageproxy.Fetcher) *Resolver {
+	return &Resolver{
+		store:   store,
+		blobs:   blobs,
+		gateway: strings.TrimSuffix(gateway, "/"),
+		fetcher: fetcher,
+	}
+}
+
+// Fetch resolves value, which may be any reference Parse understands
+func (r *Resolver) Fetch(ctx context.Context, value string) (*imageproxy.Media, error) {
+	ref, err := Parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ref.Kind {
+	case KindData:
+		return DecodeDataURL(ref.Data)
+	case KindBlob:
+		if r.blobs == nil {
+			return nil, imageproxy.ErrNotFound
+		}
+		return r.blobs.Blob(ctx, ref.Hash)
+	case KindURL:
+		return r.fetcher.Fetch(ctx, ref.URL)
+	}
+
+	if r.store != nil {
+		if rawtx, err := r.store.RawTx(ctx, ref.Txid); err == nil {
+			if media, err := Extract(rawtx, ref); err == nil {
+				return media, nil
+			} else {
+				log.Printf("[ERROR]: extracting %s from archived tx: %v", ref, err)
+			}
+		} else if !os.IsNotExist(err) {
+			log.Printf("[ERROR]: reading archived tx %s: %v", ref.Txid, err)
+		}
+	}
+
+	return r.fetcher.Fetch(ctx, r.gateway+ref.GatewayPath())
+}
+
+// DecodeDataURL decodes data:<mediatype>[;base64],<data>
+func DecodeDataURL(dataURL string) (*imageproxy.Media, error) {
+	meta, payload, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !ok {
+		return nil, fmt.Errorf("%w: data url has no payload", ErrInvalidRef)
+	}
+
+	// meta = image/jpeg;base64
+	params := strings.Split(meta, ";")
+	isBase64 := params[len(params)-1] == "base64"
+	if isBase64 {
+		params = params[:len(params)-1]
+	}
+
+	mediaType := "text/plain"
+	if params[0] != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(strings.Join(params, ";")); err != nil {
+			return nil, fmt.Errorf("%w: invalid media type in data url: %v", ErrInvalidRef, err)
+		}
+	}
+
+	var data []byte
+	var err error
+	if isBase64 {
+		data, err = base64.StdEncoding.DecodeString(payload)
+	} else {
+		var s string
+		s, err = url.PathUnescape(payload)
+		data = []byte(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode data url: %v", ErrInvalidRef, err)
+	}
+
+	return &imageproxy.Media{
+		Data:        data,
+		ContentType: mediaType,
+		Hash:        imageproxy.Hash(data),
+	}, nil
+}
@@ -0,0 +1,116 @@
+package resolver
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/imageproxy"
+	"github.com/bitcoinschema/go-b"
+)
+
+// testFetcher records the urls it is asked for
+type testFetcher struct {
+	urls []string
+}
+
+func (f *testFetcher) Fetch(ctx context.Context, url string) (*imageproxy.Media, error) {
+	f.urls = append(f.urls, url)
+	return &imageproxy.Media{Data: []byte(url)}, nil
+}
+
+// testBlobs holds a single blob
+type testBlobs struct{}
+
+func (testBlobs) Blob(ctx context.Context, hash string) (*imageproxy.Media, error) {
+	if hash != testHash {
+		return nil, imageproxy.ErrNotFound
+	}
+	return &imageproxy.Media{Data: []byte("blob")}, nil
+}
+
+func TestFetch(t *testing.T) {
+	// testTxid is archived as hex, with a B record in its only output
+	dir := t.TempDir()
+	raw := rawTx(opReturn(t, b.Prefix, "archived", "text/plain"))
+	if err := os.WriteFile(filepath.Join(dir, testTxid), []byte(hex.EncodeToString(raw)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := testHash
+
+	tests := []struct {
+		value string
+		data  string
+		// fetched is the url asked of the fetcher, if any
+		fetched string
+		err     error
+	}{
+		{value: "b://" + testTxid, data: "archived"},
+		{value: "ord://" + testTxid + "_0", data: "archived"},
+		// the archived tx has no output 3, so the gateway is asked
+		{value: "bitfs://" + testTxid + ".out.3.3", fetched: "https://gateway.test/" + testTxid + "_3"},
+		{value: "/" + other, fetched: "https://gateway.test/" + other},
+		{value: "https://example.com/a.png", fetched: "https://example.com/a.png"},
+		{value: "data:text/plain,hello%20world", data: "hello world"},
+		{value: "blob://" + testHash, data: "blob"},
+		{value: "blob://" + testTxid, err: imageproxy.ErrNotFound},
+		{value: "not a ref", err: ErrInvalidRef},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			fetcher := &testFetcher{}
+			r := New(DirStore{Dir: dir}, testBlobs{}, "https://gateway.test/", fetcher)
+			m, err := r.Fetch(context.Background(), tt.value)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			want := tt.data
+			if tt.fetched != "" {
+				want = tt.fetched
+				if len(fetcher.urls) != 1 || fetcher.urls[0] != tt.fetched {
+					t.Errorf("fetched %v, want %s", fetcher.urls, tt.fetched)
+				}
+			} else if len(fetcher.urls) > 0 {
+				t.Errorf("fetched %v, want nothing fetched", fetcher.urls)
+			}
+			if string(m.Data) != want {
+				t.Errorf("got %q, want %q", m.Data, want)
+			}
+		})
+	}
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		data        string
+		contentType string
+		err         bool
+	}{
+		{url: "data:image/png;base64,aGVsbG8=", data: "hello", contentType: "image/png"},
+		{url: "data:,hello%20world", data: "hello world", contentType: "text/plain"},
+		{url: "data:text/plain;charset=utf-8,hi", data: "hi", contentType: "text/plain"},
+		{url: "data:image/png;base64", err: true},
+		{url: "data:image/png;base64,!!", err: true},
+		{url: "data:image/;base64,aGVsbG8=", err: true},
+	}
+	for _, tt := range tests {
+		m, err := DecodeDataURL(tt.url)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidRef) {
+				t.Errorf("%s: got %v, want %v", tt.url, err, ErrInvalidRef)
+			}
+			continue
+		}
+		if err != nil || string(m.Data) != tt.data || m.ContentType != tt.contentType {
+			t.Errorf("%s: got %+v, %v, want %q as %s", tt.url, m, err, tt.data, tt.contentType)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/BitcoinSchema/go-bap-indexer/imageproxy"
+)
+
+// TxStore gives access to locally archived raw transactions
+type TxStore interface {
+	// RawTx returns the raw bytes of txid, or an error satisfying
+	// os.IsNotExist when the transaction isn't archived
+	RawTx(ctx context.Context, txid string) ([]byte, error)
+}
+
+// BlobStore gives access to media extracted from profiles
+type BlobStore interface {
+	// Blob returns the media with sha256 hash, or imageproxy.ErrNotFound
+	Blob(ctx context.Context, hash string) (*imageproxy.Media, error)
+}
+
+// DirStore reads raw transactions from files named <txid> in Dir. Files may
+// hold either the raw bytes or their hex encoding.
+type DirStore struct {
+	Dir string
+}
+
+// RawTx reads txid from the archive directory
+func (s DirStore) RawTx(ctx context.Context, txid string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, txid))
+	if err != nil {
+		return nil, err
+	}
+
+	// hex archives are handy to inspect and to drop in by hand
+	trimmed := bytes.TrimSpace(data)
+	if raw, err := hex.DecodeString(string(trimmed)); err == nil {
+		return raw, nil
+	}
+
+	return data, nil
+}
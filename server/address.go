@@ -0,0 +1,210 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/bitcoinschema/go-bap"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// @Summary Get address activity
+// @Description Starts from a Bitcoin address: the identities it belongs or belonged to, the block ranges during which
+// @Description it was their current address, whether it is an active signing key now, and every BAP op it signed
+// @Description (ID, ATTEST, REVOKE and ALIAS). ATTESTs include signatures a later ATTEST replaced or a REVOKE removed.
+// @Description Only the latest ALIAS of an identity is kept, so ALIAS ops a later profile replaced are not listed.
+// @Tags identity
+// @Produce json
+// @Param address path string true "Bitcoin address"
+// @Success 200 {object} Response{result=AddressResponse} "Identities and ops of the address"
+// @Failure 404 {object} Response "No BAP activity for the address"
+// @Failure 500 {object} Response "Server error"
+// @Router /address/{address} [get]
+func getAddressHandler(c *fiber.Ctx) error {
+	res, err := addressActivity(c.Context(), c.Params("address"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+	if len(res.Identities) == 0 && len(res.Ops) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "No BAP activity for address " + res.Address,
+		})
+	}
+	return c.JSON(Response{
+		Status: "OK",
+		Result: res,
+	})
+}
+
+// addressActivity collects the identities of address and the ops it signed
+func addressActivity(ctx context.Context, address string) (*AddressResponse, error) {
+	res := &AddressResponse{Address: address, Identities: []AddressIdentity{}, Ops: []AddressOp{}}
+
+	var ids []types.Identity
+	cursor, err := idColl.Find(ctx, addressIdentityFilter(address))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &ids); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		res.Identities = append(res.Identities, addressIdentity(&id, address))
+		if id.CurrentAddress == address && id.Status != types.StatusDeactivated {
+			res.Active = true
+		}
+
+		// each ID op is signed by the address before the one it adds, the
+		// first by the root address
+		signer := id.RootAddress
+		for _, a := range id.Addresses {
+			if signer == address {
+				res.Ops = append(res.Ops, AddressOp{Type: string(bap.ID), Txid: a.Txid, Block: a.Block, IDKey: id.IDKey, Address: a.Address})
+			}
+			signer = a.Address
+		}
+		// an identity revoking its own idKey, see Identity Lifecycle
+		for _, change := range id.StatusHistory {
+			if change.Op == string(bap.REVOKE) && change.Signer == address {
+				res.Ops = append(res.Ops, AddressOp{Type: string(bap.REVOKE), Txid: change.Txid, Block: change.Block, IDKey: id.IDKey, Hash: id.IDKey})
+			}
+		}
+	}
+
+	// ID ops indexed only as conflicts, for idKeys the address doesn't belong to
+	var disputed []types.Identity
+	if cursor, err = idColl.Find(ctx, bson.M{"conflicts.address": address}); err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &disputed); err != nil {
+		return nil, err
+	}
+	for _, id := range disputed {
+		for _, conflict := range id.Conflicts {
+			listed := slices.ContainsFunc(res.Ops, func(op AddressOp) bool { return op.Type == string(bap.ID) && op.Txid == conflict.Txid })
+			if conflict.Address == address && !listed {
+				res.Ops = append(res.Ops, AddressOp{Type: string(bap.ID), Txid: conflict.Txid, Block: conflict.Block, IDKey: conflict.IDKey, Note: conflict.Type})
+			}
+		}
+	}
+
+	var atts []types.Attestation
+	if cursor, err = atColl.Find(ctx, addressAttestationFilter(address)); err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &atts); err != nil {
+		return nil, err
+	}
+	for _, att := range atts {
+		res.Ops = append(res.Ops, attestationOps(&att, address)...)
+	}
+
+	var profiles []struct {
+		IDKey string `bson:"_id"`
+		Txid  string `bson:"txId"`
+		Block uint32 `bson:"block"`
+	}
+	if cursor, err = proColl.Find(ctx, bson.M{"signer": address}); err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &profiles); err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		res.Ops = append(res.Ops, AddressOp{Type: string(bap.ALIAS), Txid: p.Txid, Block: p.Block, IDKey: p.IDKey})
+	}
+
+	// chain order; block 0 wraps around, so unconfirmed ops come last
+	slices.SortStableFunc(res.Ops, func(a, b AddressOp) int {
+		return cmp.Or(
+			cmp.Compare(a.Block-1, b.Block-1),
+			cmp.Compare(a.Txid, b.Txid),
+		)
+	})
+	return res, nil
+}
+
+// addressIdentityFilter matches the identities address is the root of or
+// belongs (or belonged) to
+func addressIdentityFilter(address string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"rootAddress": address},
+		bson.M{"addresses.address": address},
+	}}
+}
+
+// addressAttestationFilter matches the attestations address signed or
+// revoked signatures on, including signatures since replaced or revoked
+func addressAttestationFilter(address string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"signers.signingAddress": address},
+		bson.M{"replaced.signer.signingAddress": address},
+		bson.M{"revocations.address": address},
+		bson.M{"revocations.removed.signingAddress": address},
+	}}
+}
+
+// attestationOps lists the ATTEST and REVOKE ops address signed on att. The
+// ATTESTs include signatures a higher sequence replaced or a REVOKE removed.
+func attestationOps(att *types.Attestation, address string) []AddressOp {
+	var ops []AddressOp
+	attest := func(s *types.Signer) {
+		if s == nil || s.Address != address {
+			return
+		}
+		listed := slices.ContainsFunc(ops, func(op AddressOp) bool {
+			return op.Type == string(bap.ATTEST) && op.Txid == s.Txid && op.Sequence == s.Sequence
+		})
+		if !listed {
+			ops = append(ops, AddressOp{Type: string(bap.ATTEST), Txid: s.Txid, Block: s.Block, IDKey: s.IDKey, Hash: att.Id, Sequence: s.Sequence})
+		}
+	}
+	for _, s := range att.Signers {
+		attest(s)
+	}
+	for _, r := range att.Replaced {
+		attest(r.Signer)
+	}
+	for _, r := range att.Revocations {
+		for _, s := range r.Removed {
+			attest(s)
+		}
+		if r.Address == address {
+			ops = append(ops, AddressOp{Type: string(bap.REVOKE), Txid: r.Txid, Block: r.Block, IDKey: r.IDKey, Hash: att.Id, Sequence: r.Sequence})
+		}
+	}
+	return ops
+}
+
+// addressIdentity describes address's part in id
+func addressIdentity(id *types.Identity, address string) AddressIdentity {
+	ai := AddressIdentity{
+		IDKey:   id.IDKey,
+		Root:    id.RootAddress == address,
+		Current: id.CurrentAddress == address,
+		Status:  id.Status,
+		Ranges:  []BlockRange{},
+	}
+	if ai.Status == "" {
+		// indexed before states were tracked
+		ai.Status = types.StatusActive
+	}
+	for i, a := range id.Addresses {
+		if a.Address != address {
+			continue
+		}
+		r := BlockRange{From: a.Block}
+		if i+1 < len(id.Addresses) {
+			r.To = id.Addresses[i+1].Block
+		}
+		ai.Ranges = append(ai.Ranges, r)
+	}
+	return ai
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	testIDKey   = "3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+	testAddress = "134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"
+	testHash    = "b17c8e606afcf0d8dca65bdf8f33d275239438116557980203c82b0fae259838"
+	testTxid    = "1fd626dc8286d449d4c2cf3b5b70d169728f5ffefd5c3a3205d4970e21fbf187"
+)
+
+// testAttestation is an attestation signed once by testAddress, as the
+// crawler stores it
+func testAttestation() *types.Attestation {
+	return &types.Attestation{
+		Id: testHash,
+		Signers: []*types.Signer{{
+			IDKey:    testIDKey,
+			Address:  testAddress,
+			Txid:     testTxid,
+			Block:    590230,
+			Sequence: 1,
+		}},
+	}
+}
+
+// matches reports whether doc has value at the dotted path, looking into
+// arrays the way a mongo query does
+func matches(doc interface{}, path []string, value interface{}) bool {
+	if len(path) == 0 {
+		return doc == value
+	}
+	switch v := doc.(type) {
+	case bson.M:
+		return matches(v[path[0]], path[1:], value)
+	case bson.A:
+		for _, item := range v {
+			if matches(item, path, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestAddressAttestationFilter(t *testing.T) {
+	replaced := testAttestation()
+	replaced.Replaced = []types.ReplacedSigner{{Signer: replaced.Signers[0], ReplacedAt: 590300}}
+	replaced.Signers = []*types.Signer{}
+	revoked := testAttestation()
+	revoked.Revocations = []types.Revocation{{IDKey: testIDKey, Address: "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", Removed: revoked.Signers}}
+	revoked.Signers = []*types.Signer{}
+
+	for name, att := range map[string]*types.Attestation{"signed": testAttestation(), "replaced": replaced, "revoked": revoked} {
+		raw, err := bson.Marshal(att)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := bson.M{}
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			t.Fatal(err)
+		}
+
+		for address, want := range map[string]bool{testAddress: true, "1KUrv2Ns8SwNkLgVKrVbSQz5Qi2BFp5wLY": false} {
+			matched := false
+			for _, clause := range addressAttestationFilter(address)["$or"].(bson.A) {
+				for field, value := range clause.(bson.M) {
+					matched = matched || matches(doc, strings.Split(field, "."), value)
+				}
+			}
+			if matched != want {
+				t.Errorf("filter for %s matched the %s attestation: %v, want %v", address, name, matched, want)
+			}
+		}
+	}
+}
+
+func TestAddressIdentityFilter(t *testing.T) {
+	id := &types.Identity{
+		IDKey:       testIDKey,
+		RootAddress: "1BoatSLRHtKNngkdXEeobR76b53LETtpyT",
+		Addresses:   []types.Address{{Address: testAddress}},
+	}
+	raw, err := bson.Marshal(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"1BoatSLRHtKNngkdXEeobR76b53LETtpyT": true,
+		testAddress:                          true,
+		"1KUrv2Ns8SwNkLgVKrVbSQz5Qi2BFp5wLY": false,
+	}
+	for address, want := range tests {
+		matched := false
+		for _, clause := range addressIdentityFilter(address)["$or"].(bson.A) {
+			for field, value := range clause.(bson.M) {
+				matched = matched || matches(doc, strings.Split(field, "."), value)
+			}
+		}
+		if matched != want {
+			t.Errorf("filter for %s matched the identity: %v, want %v", address, matched, want)
+		}
+	}
+}
+
+// testCollections points the server at a scratch database, skipping the
+// test when MONGO_PRIVATE_URL isn't set
+func testCollections(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("MONGO_PRIVATE_URL")
+	if url == "" {
+		t.Skip("MONGO_PRIVATE_URL is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database(fmt.Sprintf("bap_test_%d", time.Now().UnixNano()))
+	idColl, atColl, proColl = db.Collection("id"), db.Collection("attest"), db.Collection("profile")
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+}
+
+func TestAddressActivityAttest(t *testing.T) {
+	testCollections(t)
+	ctx := context.Background()
+
+	// staged the way the crawler creates an attestation
+	att := testAttestation()
+	if _, err := atColl.UpdateOne(ctx,
+		bson.M{"_id": att.Id},
+		bson.M{"$setOnInsert": bson.M{"signers": att.Signers}},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/v1/address/:address", getAddressHandler)
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/address/"+testAddress, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+
+	var body struct {
+		Result AddressResponse `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Result.Ops) != 1 {
+		t.Fatalf("got %d ops, want the ATTEST: %+v", len(body.Result.Ops), body.Result.Ops)
+	}
+	op := body.Result.Ops[0]
+	if op.Type != "ATTEST" || op.Hash != testHash || op.Txid != testTxid || op.IDKey != testIDKey || op.Sequence != 1 {
+		t.Errorf("got %+v", op)
+	}
+}
+
+func TestAttestationOps(t *testing.T) {
+	const other = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+	signer := func(address string, sequence uint64, block uint32) *types.Signer {
+		return &types.Signer{IDKey: testIDKey, Address: address, Txid: fmt.Sprintf("%064x", block), Block: block, Sequence: sequence}
+	}
+	att := &types.Attestation{
+		Id:      testHash,
+		Signers: []*types.Signer{signer(testAddress, 3, 600020), signer(other, 1, 600000)},
+		Replaced: []types.ReplacedSigner{
+			{Signer: signer(testAddress, 1, 600000), ReplacedAt: 600010},
+			{Signer: signer(other, 0, 590000), ReplacedAt: 600000},
+		},
+		Revocations: []types.Revocation{{
+			IDKey:    testIDKey,
+			Address:  testAddress,
+			Txid:     fmt.Sprintf("%064x", 600015),
+			Block:    600015,
+			Sequence: 3,
+			Removed:  []*types.Signer{signer(testAddress, 2, 600010)},
+		}},
+	}
+
+	tests := []struct {
+		address string
+		// ops is type:sequence@block of every op listed
+		ops []string
+	}{
+		{testAddress, []string{"ATTEST:3@600020", "ATTEST:1@600000", "ATTEST:2@600010", "REVOKE:3@600015"}},
+		{other, []string{"ATTEST:1@600000", "ATTEST:0@590000"}},
+		{"1KUrv2Ns8SwNkLgVKrVbSQz5Qi2BFp5wLY", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, op := range attestationOps(att, tt.address) {
+			if op.Hash != testHash || op.IDKey != testIDKey {
+				t.Errorf("%s: op %+v is not on the attestation", tt.address, op)
+			}
+			got = append(got, fmt.Sprintf("%s:%d@%d", op.Type, op.Sequence, op.Block))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.ops) {
+			t.Errorf("%s: got %v, want %v", tt.address, got, tt.ops)
+		}
+	}
+}
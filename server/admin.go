@@ -0,0 +1,180 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/crawler"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// adminAuth only lets requests through that carry "Bearer <ADMIN_TOKEN>".
+// Without ADMIN_TOKEN the admin API is disabled.
+func adminAuth(c *fiber.Ctx) error {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return c.Status(fiber.StatusForbidden).JSON(Response{
+			Status:  "ERROR",
+			Message: "Admin API is disabled, set ADMIN_TOKEN to enable it",
+		})
+	}
+
+	given, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(Response{
+			Status:  "ERROR",
+			Message: "Invalid admin token",
+		})
+	}
+	return c.Next()
+}
+
+// @Summary List quarantined transactions
+// @Description Lists transactions with ops that could not be applied, most recent first
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param offset query integer false "Number of records to skip (default: 0)"
+// @Param limit query integer false "Number of records to return (default: 20, max: 100)"
+// @Success 200 {object} Response{result=[]types.Quarantine} "Quarantined transactions"
+// @Failure 400 {object} Response "Invalid pagination parameters"
+// @Failure 401 {object} Response "Invalid admin token"
+// @Failure 403 {object} Response "Admin API disabled"
+// @Failure 500 {object} Response "Server error"
+// @Router /admin/quarantine [get]
+func listQuarantineHandler(c *fiber.Ctx) error {
+	offset, err := strconv.ParseInt(c.Query("offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "Offset must be a non-negative integer",
+		})
+	}
+	limit, err := strconv.ParseInt(c.Query("limit", "20"), 10, 64)
+	if err != nil || limit <= 0 || limit > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "Limit must be a positive integer up to 100",
+		})
+	}
+
+	cursor, err := conn.Database("bap").Collection(config.QuarantineCollection).Find(
+		c.Context(),
+		bson.M{},
+		options.Find().
+			SetSkip(offset).
+			SetLimit(limit).
+			SetSort(bson.D{{Key: "quarantinedAt", Value: -1}}),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	results := []types.Quarantine{}
+	if err := cursor.All(c.Context(), &results); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(Response{
+		Status: "OK",
+		Result: results,
+	})
+}
+
+// @Summary Reprocess a quarantined transaction
+// @Description Applies the failed ops of a quarantined transaction again. It leaves quarantine when they all apply.
+// @Description The ops are applied on top of the block the crawler is staging, which is written together with them.
+// @Description Not available while dumping to files.
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param txid path string true "Transaction ID"
+// @Success 200 {object} Response "Transaction applied and removed from quarantine"
+// @Failure 401 {object} Response "Invalid admin token"
+// @Failure 403 {object} Response "Admin API disabled"
+// @Failure 404 {object} Response "Transaction not in quarantine"
+// @Failure 422 {object} Response "Ops still failing, quarantine record updated"
+// @Router /admin/quarantine/{txid}/reprocess [post]
+func reprocessHandler(c *fiber.Ctx) error {
+	txid := c.Params("txid")
+	if err := crawler.Reprocess(txid); err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "Transaction not in quarantine",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(Response{
+		Status:  "OK",
+		Message: "Transaction " + txid + " applied",
+	})
+}
+
+// @Summary Simulate indexing a transaction
+// @Description Parses a raw transaction and plans what indexing it would do: each BAP op with its AIP validity, the mutations with reasons (created identity, rotated address, added signer, skipped: bad sequence, ...) and the database writes. Lookups read the index; nothing is written.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param request body SimulateRequest true "Transaction to simulate"
+// @Success 200 {object} Response{result=crawler.Simulation} "Planned mutations"
+// @Failure 400 {object} Response "Invalid request or transaction"
+// @Failure 401 {object} Response "Invalid admin token"
+// @Failure 403 {object} Response "Admin API disabled"
+// @Failure 500 {object} Response "Server error"
+// @Router /admin/simulate [post]
+func simulateHandler(c *fiber.Ctx) error {
+	var req SimulateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "Invalid request body",
+		})
+	}
+
+	rawtx, err := hex.DecodeString(req.RawTx)
+	if err != nil || len(rawtx) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "rawTx must be a hex encoded transaction",
+		})
+	}
+
+	sim, err := crawler.SimulateRawTx(rawtx, req.Block, req.Timestamp)
+	if errors.Is(err, crawler.ErrInvalidTx) {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(Response{
+		Status: "OK",
+		Result: sim,
+	})
+}
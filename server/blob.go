@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+
+	"github.com/BitcoinSchema/go-bap-indexer/imageproxy"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// @Summary Get profile blob
+// @Description Serves media moved out of a profile because it was too large to keep inline. Profiles reference it
+// @Description as blob://<sha256>. Like image fields, it can be resized and converted, and only png, jpeg, gif and
+// @Description webp images are served.
+// @Tags profile
+// @Produce octet-stream
+// @Param hash path string true "sha256 of the blob"
+// @Param w query integer false "Resize to this width in pixels"
+// @Param h query integer false "Resize to this height in pixels (with w, crops a thumbnail)"
+// @Param format query string false "Output format" Enums(webp, png, jpeg)
+// @Success 200 "The image"
+// @Success 304 "Not modified"
+// @Failure 400 {object} Response "Invalid hash"
+// @Failure 404 {object} Response "Blob not found"
+// @Failure 415 {object} Response "Not a safe image type"
+// @Failure 422 {object} Response "Image can't be transformed"
+// @Failure 500 {object} Response "Server error"
+// @Router /blob/{hash} [get]
+func getBlobHandler(c *fiber.Ctx) error {
+	return sendProfileImage(c, "blob://"+c.Params("hash"))
+}
+
+// mongoBlobs is the resolver.BlobStore backed by the blob collection
+type mongoBlobs struct{}
+
+func (mongoBlobs) Blob(ctx context.Context, hash string) (*imageproxy.Media, error) {
+	blob := &types.Blob{}
+	if err := blobColl.FindOne(ctx, bson.M{"_id": hash}).Decode(blob); err == mongo.ErrNoDocuments {
+		return nil, imageproxy.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &imageproxy.Media{
+		Data:        blob.Data,
+		ContentType: blob.ContentType,
+		Hash:        blob.Hash,
+	}, nil
+}
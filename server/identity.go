@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// @Summary Get identity conflicts
+// @Description Lists the competing claims recorded on an identity: ID ops for its idKey signed by another root address
+// @Description (duplicate-claim), and other idKeys created by one of its addresses (shared-root)
+// @Tags identity
+// @Produce json
+// @Param idKey path string true "Identity key"
+// @Success 200 {object} Response{result=[]types.Conflict} "Conflicts, empty when there are none"
+// @Failure 404 {object} Response "Identity not found"
+// @Failure 500 {object} Response "Server error"
+// @Router /identity/{idKey}/conflicts [get]
+func getIdentityConflictsHandler(c *fiber.Ctx) error {
+	id := &types.Identity{}
+	if err := idColl.FindOne(c.Context(), bson.M{"_id": c.Params("idKey")}).Decode(id); err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "Identity could not be found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	conflicts := id.Conflicts
+	if conflicts == nil {
+		conflicts = []types.Conflict{}
+	}
+	return c.JSON(Response{
+		Status: "OK",
+		Result: conflicts,
+	})
+}
+
+// identityValidity reports whether id's lifecycle state at block, or at
+// timestamp when block is 0, lets it be valid, and why not. The address it
+// is checked for is up to the caller.
+func identityValidity(id *types.Identity, block uint32, timestamp uint32) (bool, string) {
+	conflictingValid := config.Bool("CONFLICTING_IDENTITIES_VALID", config.ConflictingIdentitiesValid)
+	switch id.StatusAt(block, timestamp) {
+	case types.StatusDeactivated:
+		return false, "identity is deactivated"
+	case types.StatusDisputed:
+		if !conflictingValid {
+			return false, "identity has conflicting claims"
+		}
+	default:
+		// identities indexed before disputes were tracked as a status
+		if len(id.StatusHistory) == 0 && len(id.Conflicts) > 0 && !conflictingValid {
+			return false, "identity has conflicting claims"
+		}
+	}
+	return true, ""
+}
+
+// signerIdentities loads the identity of each signer of att, by idKey
+func signerIdentities(ctx context.Context, att *types.Attestation) (map[string]*types.Identity, error) {
+	idKeys := make([]string, 0, len(att.Signers))
+	for _, signer := range att.Signers {
+		idKeys = append(idKeys, signer.IDKey)
+	}
+	var ids []*types.Identity
+	cursor, err := idColl.Find(ctx, bson.M{"_id": bson.M{"$in": idKeys}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &ids); err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*types.Identity, len(ids))
+	for _, id := range ids {
+		byKey[id.IDKey] = id
+	}
+	return byKey, nil
+}
+
+// markSigners marks each signer of att with whether its identity in ids is
+// valid as of the chain tip. A signer whose identity isn't indexed is invalid.
+func markSigners(att *types.Attestation, ids map[string]*types.Identity) *AttestationResponse {
+	res := &AttestationResponse{Attestation: *att, Signers: make([]AttestationSigner, 0, len(att.Signers))}
+	for _, signer := range att.Signers {
+		marked := AttestationSigner{Signer: *signer}
+		if id, ok := ids[signer.IDKey]; ok {
+			marked.Valid, marked.Reason = indexSource{}.Validity(id)
+		} else {
+			marked.Reason = "identity is not indexed"
+		}
+		res.Signers = append(res.Signers, marked)
+	}
+	return res
+}
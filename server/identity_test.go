@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+func TestMarkSigners(t *testing.T) {
+	att := testAttestation()
+	att.Signers = append(att.Signers,
+		&types.Signer{IDKey: "deactivated", Address: "1Deactivated", Sequence: 1},
+		&types.Signer{IDKey: "missing", Address: "1Missing", Sequence: 1},
+	)
+	ids := map[string]*types.Identity{
+		testIDKey:     {IDKey: testIDKey, Status: types.StatusActive},
+		"deactivated": {IDKey: "deactivated", Status: types.StatusDeactivated},
+	}
+
+	tests := []struct {
+		idKey  string
+		valid  bool
+		reason string
+	}{
+		{testIDKey, true, ""},
+		{"deactivated", false, "identity is deactivated"},
+		{"missing", false, "identity is not indexed"},
+	}
+	res := markSigners(att, ids)
+	if len(res.Signers) != len(tests) {
+		t.Fatalf("got %d signers, want %d", len(res.Signers), len(tests))
+	}
+	for i, tt := range tests {
+		got := res.Signers[i]
+		if got.IDKey != tt.idKey || got.Valid != tt.valid || got.Reason != tt.reason {
+			t.Errorf("signer %d is %s valid=%v %q, want %s valid=%v %q", i, got.IDKey, got.Valid, got.Reason, tt.idKey, tt.valid, tt.reason)
+		}
+	}
+
+	// the marked signers replace the attestation's own in the JSON
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), `"signers"`); n != 1 {
+		t.Errorf("%d signers keys in %s", n, b)
+	}
+	if !strings.Contains(string(b), `"valid":false,"reason":"identity is deactivated"`) {
+		t.Errorf("deactivated signer isn't marked in %s", b)
+	}
+}
@@ -1,6 +1,11 @@
 package server
 
-import "github.com/BitcoinSchema/go-bap-indexer/types"
+import (
+	"github.com/BitcoinSchema/go-bap-indexer/crawler"
+	"github.com/BitcoinSchema/go-bap-indexer/policy"
+	"github.com/BitcoinSchema/go-bap-indexer/trust"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
 
 // Response represents the standard API response format
 // @Description Standard API response wrapper
@@ -64,6 +69,8 @@ type ValidityRecord struct {
 	Block uint32 `json:"block" example:"123456"`
 	// Timestamp at which validity was checked
 	Timestamp uint32 `json:"timestamp" example:"1612137600"`
+	// Why the identity is not valid, when that is not just the address
+	Reason string `json:"reason,omitempty" example:"identity has conflicting claims"`
 }
 
 // @Description Response for attestation validation
@@ -74,6 +81,25 @@ type AttestationValidResponse struct {
 	ValidityRecord
 }
 
+// AttestationResponse is an attestation with each signer marked valid or not
+// @Description Attestation whose signers carry the validity of their identity as of the chain tip
+type AttestationResponse struct {
+	types.Attestation
+	// Signers of the attestation. Signatures are kept when an identity is
+	// deactivated, so check valid before counting one.
+	Signers []AttestationSigner `json:"signers"`
+}
+
+// AttestationSigner is a signer and whether its identity is valid
+// @Description Attestation signer and the validity of its identity as of the chain tip
+type AttestationSigner struct {
+	types.Signer
+	// Whether the signer's identity is valid
+	Valid bool `json:"valid" example:"true"`
+	// Why the identity is not valid
+	Reason string `json:"reason,omitempty" example:"identity is deactivated"`
+}
+
 // IdentityValidResponse represents the response for identity validation
 // @Description Response containing identity validation results
 type IdentityValidResponse struct {
@@ -84,3 +110,114 @@ type IdentityValidResponse struct {
 	// Associated profile data if valid
 	Profile interface{} `json:"profile,omitempty"`
 }
+
+// ReadinessCheck is the outcome of one readiness probe
+// @Description Outcome of a single readiness check
+type ReadinessCheck struct {
+	// Name of the dependency checked (mongo, crawler, lag)
+	Name string `json:"name" example:"mongo"`
+	// Whether the check passed
+	OK bool `json:"ok" example:"true"`
+	// Why the check failed
+	Message string `json:"message,omitempty" example:"index is 12 blocks behind the chain tip (max 6)"`
+}
+
+// StatusResponse describes how far the indexer has synced
+// @Description Sync status of the indexer
+type StatusResponse struct {
+	// Height stored in the _state collection
+	IndexedHeight uint32 `json:"indexedHeight" example:"875000"`
+	// Chain tip as last reported by JungleBus
+	ChainTip uint32 `json:"chainTip" example:"875002"`
+	// Blocks between the chain tip and the indexed height
+	Lag int64 `json:"lag" example:"2"`
+	// Crawler connection state and last processed block
+	Crawler crawler.Status `json:"crawler"`
+	// Document counts per collection
+	Collections map[string]int64 `json:"collections"`
+}
+
+// SimulateRequest is a tx to run through indexing without writing anything
+// @Description Request format for simulating a transaction
+type SimulateRequest struct {
+	// Raw transaction, hex encoded
+	RawTx string `json:"rawTx" example:"0100000001..."`
+	// Block height to simulate the tx at (optional)
+	Block uint32 `json:"block" example:"761173"`
+	// Block time to simulate the tx at (optional)
+	Timestamp uint32 `json:"timestamp" example:"1665592880"`
+}
+
+// TrustResponse scores an identity from a set of trusted roots
+// @Description Trust scores of an identity over the attestation graph
+type TrustResponse struct {
+	// Identity scored
+	IDKey string `json:"idKey" example:"3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"`
+	// Trusted roots the scores start from
+	From []string `json:"from"`
+	// Personalized PageRank from the roots, scores of all identities add up to 1
+	PageRank float64 `json:"pageRank" example:"0.042"`
+	// decay to the power of the length of path, 1 for a root, 0 when unreachable
+	PathScore float64 `json:"pathScore" example:"0.25"`
+	// Shortest chain of attestations from a root
+	Path []trust.Edge `json:"path"`
+}
+
+// PolicyEvaluateRequest is a policy to check a subject identity against
+// @Description Subject, policy and the subject's attestation claims, as JSON or YAML
+type PolicyEvaluateRequest struct {
+	// idKey of the identity the policy is checked for
+	Subject string `json:"subject" yaml:"subject" example:"3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"`
+	// Policy to evaluate
+	Policy policy.Policy `json:"policy" yaml:"policy"`
+	// Subject's attestation of each attribute the rules name, by attribute
+	Claims map[string]policy.Claim `json:"claims" yaml:"claims"`
+}
+
+// AddressResponse is what an address did as a BAP signing key
+// @Description Identities an address belongs or belonged to, and the BAP ops it signed
+type AddressResponse struct {
+	Address string `json:"address" example:"134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"`
+	// Whether the address is the current address of an identity that isn't deactivated
+	Active     bool              `json:"active" example:"true"`
+	Identities []AddressIdentity `json:"identities"`
+	// Ops signed by the address, oldest first, unconfirmed last
+	Ops []AddressOp `json:"ops"`
+}
+
+// AddressIdentity is an identity an address belongs or belonged to
+// @Description An identity the address is or was used by, and when it was the current address
+type AddressIdentity struct {
+	IDKey string `json:"idKey" example:"714a3c856435781fb48ca16a4cf0ba9bc1ef16dd7abbc060d3e18e7e900eec9f"`
+	// Whether the address signed the identity's first ID op
+	Root bool `json:"root" example:"false"`
+	// Whether the address is the identity's current address
+	Current bool   `json:"current" example:"true"`
+	Status  string `json:"status" example:"active"`
+	// Block ranges during which the address was the identity's current address
+	Ranges []BlockRange `json:"ranges"`
+}
+
+// BlockRange is a span of blocks
+// @Description Span of blocks, to is unset while still open
+type BlockRange struct {
+	From uint32 `json:"from" example:"590194"`
+	To   uint32 `json:"to,omitempty" example:"600000"`
+}
+
+// AddressOp is a BAP op signed by an address
+// @Description A BAP op signed by the address
+type AddressOp struct {
+	Type  string `json:"type" example:"ATTEST"`
+	Txid  string `json:"txId" example:"1fd626dc8286d449d4c2cf3b5b70d169728f5ffefd5c3a3205d4970e21fbf187"`
+	Block uint32 `json:"block" example:"590230"`
+	// IDKey is the identity the op was for
+	IDKey string `json:"idKey" example:"714a3c856435781fb48ca16a4cf0ba9bc1ef16dd7abbc060d3e18e7e900eec9f"`
+	// Hash is the attestation hash of ATTEST and REVOKE ops
+	Hash string `json:"hash,omitempty" example:"b17c8e606afcf0d8dca65bdf8f33d275239438116557980203c82b0fae259838"`
+	// Address is the address an ID op moved the identity to
+	Address  string `json:"address,omitempty" example:"134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"`
+	Sequence uint64 `json:"sequence,omitempty" example:"0"`
+	// Note says how the op was indexed, e.g. that it was recorded as a conflict
+	Note string `json:"note,omitempty" example:"duplicate-claim"`
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/policy"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gopkg.in/yaml.v3"
+)
+
+// @Summary Evaluate an attestation policy
+// @Description Checks a subject identity against a declarative policy: for each rule, how many signatures of the
+// @Description subject's attestation of an attribute count, given trusted issuers, signature age and issuer validity.
+// @Description The subject itself has to be valid unless the policy allows otherwise. Send JSON, or YAML with a
+// @Description yaml Content-Type. Claims give the attestation hash, or the attribute value and secret to derive it.
+// @Tags policy
+// @Accept json,application/yaml
+// @Produce json
+// @Param request body PolicyEvaluateRequest true "Subject, policy and claims"
+// @Success 200 {object} Response{result=policy.Result} "Pass or fail with the evidence for each rule"
+// @Failure 400 {object} Response "Invalid request or policy"
+// @Failure 404 {object} Response "Subject identity not found"
+// @Failure 500 {object} Response "Server error"
+// @Router /policy/evaluate [post]
+func evaluatePolicyHandler(c *fiber.Ctx) error {
+	req := &PolicyEvaluateRequest{}
+	var err error
+	if strings.Contains(c.Get(fiber.HeaderContentType), "yaml") {
+		err = yaml.Unmarshal(c.Body(), req)
+	} else {
+		err = json.Unmarshal(c.Body(), req)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "Invalid request body: " + err.Error(),
+		})
+	}
+	if req.Subject == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "subject is required",
+		})
+	}
+	if err := req.Policy.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	src := indexSource{}
+	subject, err := src.Identity(c.Context(), req.Subject)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	} else if subject == nil {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "Identity could not be found",
+		})
+	}
+
+	res, err := policy.Evaluate(c.Context(), src, &req.Policy, subject, req.Claims, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+	return c.JSON(Response{
+		Status: "OK",
+		Result: res,
+	})
+}
+
+// indexSource is the policy.Source and vc.Source backed by the bap collections
+type indexSource struct{}
+
+func (indexSource) Identity(ctx context.Context, idKey string) (*types.Identity, error) {
+	id := &types.Identity{}
+	if err := idColl.FindOne(ctx, bson.M{"_id": idKey}).Decode(id); err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (indexSource) Attestation(ctx context.Context, hash string) (*types.Attestation, error) {
+	att := &types.Attestation{}
+	if err := atColl.FindOne(ctx, bson.M{"_id": hash}).Decode(att); err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return att, nil
+}
+
+// Validity checks id as of the chain tip, or of now when the tip is unknown
+func (indexSource) Validity(id *types.Identity) (bool, string) {
+	if currentBlock == nil {
+		return identityValidity(id, 0, uint32(time.Now().Unix()))
+	}
+	return identityValidity(id, currentBlock.Height, currentBlock.Time)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"github.com/BitcoinSchema/go-bap-indexer/profile"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// normalizeProfile fills in the normalized form of a profile document and
+// its warnings. Profiles indexed before normalization don't have them
+// stored, so they are always worked out from the raw data.
+func normalizeProfile(doc map[string]interface{}) {
+	data, ok := doc["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	doc["normalized"], doc["warnings"] = profile.Normalize(data)
+}
+
+// withProfile sets the raw and normalized profile of id from its profile
+// document, which is empty when it has none
+func withProfile(id *types.Identity, doc map[string]interface{}) {
+	id.Identity, id.Profile, id.ProfileWarnings = nil, nil, nil
+	if data, ok := doc["data"].(map[string]interface{}); ok {
+		id.Identity = data
+		id.Profile, id.ProfileWarnings = profile.Normalize(data)
+	} else if data, exists := doc["data"]; exists {
+		id.Identity = data
+	}
+}
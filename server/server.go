@@ -2,25 +2,29 @@ package server
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"mime"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/BitcoinSchema/go-bap-indexer/config"
 	"github.com/BitcoinSchema/go-bap-indexer/database"
 	_ "github.com/BitcoinSchema/go-bap-indexer/docs"
+	"github.com/BitcoinSchema/go-bap-indexer/imageproxy"
+	"github.com/BitcoinSchema/go-bap-indexer/metrics"
+	"github.com/BitcoinSchema/go-bap-indexer/resolver"
 	"github.com/BitcoinSchema/go-bap-indexer/types"
 	"github.com/b-open-io/go-junglebus"
 	"github.com/b-open-io/go-junglebus/models"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -28,9 +32,10 @@ import (
 var TRUE = true
 var FALSE = false
 var conn *database.Connection
-var idColl, atColl, proColl *mongo.Collection
+var idColl, atColl, proColl, blobColl *mongo.Collection
 var jb *junglebus.Client
 var currentBlock *models.BlockHeader
+var imgProxy *imageproxy.Proxy
 
 // @title Sigma Identity API
 // @version 1.0
@@ -44,6 +49,10 @@ var currentBlock *models.BlockHeader
 // @host api.sigmaidentity.com
 // @BasePath /v1
 // @schemes https
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description "Bearer " followed by the ADMIN_TOKEN the server was started with
 
 // @Summary Get root endpoint
 // @Description Returns a hello world message
@@ -57,13 +66,15 @@ func rootHandler(c *fiber.Ctx) error {
 }
 
 // @Summary Get attestation by hash
-// @Description Retrieves an attestation using its unique hash identifier
+// @Description Retrieves an attestation using its unique hash identifier. Each signer is marked with whether its
+// @Description identity is valid as of the chain tip, signatures from deactivated identities are kept but not valid.
 // @Tags attestation
 // @Accept json
 // @Produce json
 // @Param hash body string true "Attestation hash"
-// @Success 200 {object} Response{result=types.Attestation} "Successful response with attestation data"
+// @Success 200 {object} Response{result=AttestationResponse} "Successful response with attestation data"
 // @Failure 404 {object} Response "Attestation not found"
+// @Failure 500 {object} Response "Server error"
 // @Router /attestation/get [post]
 func getAttestationHandler(c *fiber.Ctx) error {
 	req := map[string]string{}
@@ -77,23 +88,41 @@ func getAttestationHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	ids, err := signerIdentities(c.Context(), att)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
 	return c.JSON(Response{
 		Status: "OK",
-		Result: att,
+		Result: markSigners(att, ids),
 	})
 }
 
 // @Summary Get person field
-// @Description Get a specific field from a person's profile
+// @Description Get a specific field from a person's profile. Image fields (image, logo, banner) are served as media,
+// @Description every other field is returned as JSON, or as plain text when the client accepts text/plain.
+// @Description Nested fields can be addressed with dots, e.g. homeLocation.name. Only png, jpeg, gif and webp images
+// @Description are served, whatever type the source declares.
 // @Tags person
 // @Accept json
-// @Produce json,octet-stream
-// @Param field path string true "Field name"
-// @Param bapId path string true "BAP ID"
+// @Produce json,plain,octet-stream
+// @Param field path string true "Field name or dotted path"
+// @Param bapId path string true "BAP ID, or the root address or an address of the identity"
+// @Param w query integer false "Resize to this width in pixels"
+// @Param h query integer false "Resize to this height in pixels (with w, crops a thumbnail)"
+// @Param format query string false "Output format" Enums(webp, png, jpeg)
 // @Success 200 {object} Response
+// @Success 304 "Not modified"
 // @Failure 400 {object} Response
 // @Failure 404 {object} Response
+// @Failure 415 {object} Response
+// @Failure 422 {object} Response
 // @Failure 500 {object} Response
+// @Failure 502 {object} Response
 // @Router /person/{field}/{bapId} [get]
 func getPersonFieldHandler(c *fiber.Ctx) error {
 	field := c.Params("field")
@@ -112,9 +141,9 @@ func getPersonFieldHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Fetch the profile associated with the BAPID
-	profile := map[string]interface{}{}
-	if err := proColl.FindOne(c.Context(), bson.M{"_id": bapId}).Decode(&profile); err == mongo.ErrNoDocuments {
+	// Fetch the profile associated with the BAPID, which may also be an address
+	profile, err := findProfile(c.Context(), bapId)
+	if err == mongo.ErrNoDocuments {
 		return c.Status(fiber.StatusNotFound).JSON(Response{
 			Status:  "ERROR",
 			Message: "Profile not found",
@@ -126,13 +155,7 @@ func getPersonFieldHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// if bap ID
-	// if len(bapId) > 30 {
-	// 	// TODO: consider it an address, find match based on match on addresses field
-
-	// }
-
-	// Extract the image URL from the profile's data field
+	// Extract the field from the profile's data field
 	data, dataExists := profile["data"].(map[string]interface{})
 	if !dataExists {
 		return c.Status(fiber.StatusNotFound).JSON(Response{
@@ -141,136 +164,224 @@ func getPersonFieldHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	imageUrl, imageExists := data[field].(string)
-	if !imageExists || strings.TrimSpace(imageUrl) == "" {
-		// return the default image url
-		imageUrl = "/096b5fdcb6e88f8f0325097acca2784eabd62cd4d1e692946695060aff3d6833_7"
+	value, found := lookupField(data, field)
+	if isImageField(field) {
+		return sendProfileImage(c, value)
 	}
 
-	// Check if the imageUrl is a raw txid (64 character hex string)
-	if len(imageUrl) == 64 && !strings.HasPrefix(imageUrl, "/") && !strings.HasPrefix(imageUrl, "http") && !strings.HasPrefix(imageUrl, "data:") {
-		imageUrl = "/" + imageUrl
+	if !found || value == nil {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "Field " + field + " not found in profile",
+		})
 	}
 
-	if strings.HasPrefix(imageUrl, "data:") {
-		// Handle base64-encoded data URL
-		commaIndex := strings.Index(imageUrl, ",")
-		if commaIndex < 0 {
-			return c.Status(fiber.StatusBadRequest).JSON(Response{
-				Status:  "ERROR",
-				Message: "Invalid data URL format",
-			})
+	// scalars can be asked for as plain text, objects and arrays are always json
+	switch value.(type) {
+	case map[string]interface{}, primitive.A:
+	default:
+		if c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextPlain) == fiber.MIMETextPlain {
+			return c.SendString(fmt.Sprint(value))
 		}
+	}
 
-		// Extract the metadata and data
-		// Remove "data:" prefix from metaData
-		metaData := strings.TrimPrefix(imageUrl[:commaIndex], "data:")
-		// metadata = image/jpeg;base64
-		metaDataParts := strings.Split(metaData, ";")
+	return c.JSON(Response{
+		Status: "OK",
+		Result: value,
+	})
+}
 
-		metaData = metaDataParts[0]
-		// metadata = image/jpeg
+// imageFields are profile fields served as media rather than json
+var imageFields = map[string]bool{
+	"image":  true,
+	"logo":   true,
+	"banner": true,
+}
 
-		base64Data := imageUrl[commaIndex+1:]
+// defaultImage is served for image fields the profile doesn't set
+const defaultImage = "/096b5fdcb6e88f8f0325097acca2784eabd62cd4d1e692946695060aff3d6833_7"
 
-		// Parse the media type from the metadata
-		mediaType, _, err := mime.ParseMediaType(metaData)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(Response{
-				Status:  "ERROR",
-				Message: "Invalid media type in data URL " + metaData + " " + err.Error(),
-			})
+// isImageField reports whether the last segment of a dotted path is an image field
+func isImageField(field string) bool {
+	return imageFields[field[strings.LastIndex(field, ".")+1:]]
+}
+
+// lookupField walks a dotted path like homeLocation.name through profile data
+func lookupField(data map[string]interface{}, path string) (value interface{}, found bool) {
+	value = data
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
 		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
 
-		// image/jpeg;base64
-		log.Println(("Data URL: " + base64Data))
+// profileProjection leaves out the profiles an ALIAS replaced, kept only so
+// a rewind can restore them
+var profileProjection = bson.M{"history": 0}
 
-		// Decode the base64 data
-		imgData, err := base64.StdEncoding.DecodeString(base64Data)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(Response{
-				Status:  "ERROR",
-				Message: "Failed to decode base64 image data",
-			})
-		}
+// findProfile loads a profile by idKey, falling back to the identity that
+// an address is the root of or belongs (or belonged) to
+func findProfile(ctx context.Context, bapId string) (map[string]interface{}, error) {
+	profile := map[string]interface{}{}
+	err := proColl.FindOne(ctx, bson.M{"_id": bapId}, options.FindOne().SetProjection(profileProjection)).Decode(&profile)
+	if err != mongo.ErrNoDocuments {
+		return profile, err
+	}
 
-		// Set the Content-Type header
-		c.Set("Content-Type", mediaType)
+	id := &types.Identity{}
+	if err := idColl.FindOne(ctx, addressIdentityFilter(bapId)).Decode(id); err != nil {
+		return nil, err
+	}
+	err = proColl.FindOne(ctx, bson.M{"_id": id.IDKey}, options.FindOne().SetProjection(profileProjection)).Decode(&profile)
+	return profile, err
+}
 
-		// Return the image data
-		return c.Send(imgData)
-	} else {
-		// Handle regular image URL
-		// If the image URL uses a custom protocol (e.g., bitfs://), handle it accordingly
-		// Handle regular image URL
-		if strings.HasPrefix(imageUrl, "bitfs://") {
-			// Convert bitfs://<txid>.out.<vout>.<script_chunk> to https://ordfs.network/<txid>_<vout>
-			baseUrl := "https://ordfs.network/"
-			// Remove the "bitfs://" prefix
-			path := strings.TrimPrefix(imageUrl, "bitfs://")
-			// Split the path by "."
-			parts := strings.Split(path, ".")
-			if len(parts) >= 3 && parts[1] == "out" {
-				txid := parts[0]
-				// vout := parts[2]
-				// Construct the new URL
-				imageUrl = baseUrl + txid // + "_" + vout
-			} else {
-				// Handle error: unexpected format
-				return c.Status(fiber.StatusBadRequest).JSON(Response{
-					Status:  "ERROR",
-					Message: "Invalid bitfs URL format",
-				})
-			}
-		}
+// sendProfileImage serves the media a profile image field points at
+func sendProfileImage(c *fiber.Ctx, value interface{}) error {
+	opts, err := parseImageOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
 
-		// Fetch the image data from the URL
-		// if imageUrl.startsWith
-		if strings.HasPrefix(imageUrl, "/") {
-			imageUrl = "https://ordfs.network" + imageUrl
+	var imageUrl string
+	switch v := value.(type) {
+	case string:
+		imageUrl = v
+	case map[string]interface{}:
+		// schema.org ImageObject
+		if imageUrl, _ = v["contentUrl"].(string); imageUrl == "" {
+			imageUrl, _ = v["url"].(string)
 		}
+	}
+	if strings.TrimSpace(imageUrl) == "" {
+		// return the default image url
+		imageUrl = defaultImage
+	}
 
-		resp, err := http.Get(imageUrl)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(Response{
-				Status:  "ERROR",
-				Message: "Failed to fetch image at " + imageUrl + err.Error(),
-			})
-		}
-		defer resp.Body.Close()
+	// bitfs://, b://, ord://, raw txids, /txid_vout paths, data urls, blob:// and plain urls
+	ref, err := resolver.Parse(imageUrl)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return c.Status(fiber.StatusNotFound).JSON(Response{
-				Status:  "ERROR",
-				Message: "Image not found at the specified URL",
-			})
-		}
+	media, _, err := imgProxy.Get(c.Context(), ref.String(), opts)
+	if errors.Is(err, imageproxy.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "Image not found for " + imageproxy.Redact(ref.String()),
+		})
+	} else if errors.Is(err, resolver.ErrInvalidRef) {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	} else if err == imageproxy.ErrTooLarge {
+		return c.Status(fiber.StatusBadGateway).JSON(Response{
+			Status:  "ERROR",
+			Message: "Image at " + imageproxy.Redact(ref.String()) + " is too large",
+		})
+	} else if errors.Is(err, imageproxy.ErrInvalidImage) || err == imageproxy.ErrUnsupportedFormat {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(Response{
+			Status:  "ERROR",
+			Message: "Failed to transform image: " + err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: "Failed to fetch image at " + imageproxy.Redact(ref.String()) + " " + err.Error(),
+		})
+	}
 
-		// Read the image data
-		imgData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(Response{
-				Status:  "ERROR",
-				Message: "Failed to read image data",
-			})
-		}
+	// Return the image data as the response
+	return sendMedia(c, media)
+}
 
-		// Determine the content type
-		contentType := resp.Header.Get("Content-Type")
-		if contentType == "" {
-			// Fallback to detecting content type from data
-			contentType = http.DetectContentType(imgData)
+// metricsMiddleware records request latency labelled by the matched route
+// pattern, so /v1/person/:field/:bapId is one series rather than one per id
+func metricsMiddleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+
+	route := c.Route().Path
+	if status == fiber.StatusNotFound && route == "/" && c.Path() != "/" {
+		// unmatched requests land on the catch all route; don't let them
+		// mint a series per path
+		route = "unmatched"
+	}
+
+	metrics.HTTPDuration.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// parseImageOptions reads the w, h and format query parameters
+func parseImageOptions(c *fiber.Ctx) (opts imageproxy.Options, err error) {
+	for _, dim := range []struct {
+		name string
+		dest *int
+	}{{"w", &opts.Width}, {"h", &opts.Height}} {
+		if v := c.Query(dim.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > config.ImageMaxDimension {
+				return opts, fmt.Errorf("%s must be an integer between 1 and %d", dim.name, config.ImageMaxDimension)
+			}
+			*dim.dest = n
 		}
+	}
 
-		// Set the appropriate content type header
-		c.Set("Content-Type", contentType)
+	if opts.Format, err = imageproxy.ParseFormat(c.Query("format")); err != nil {
+		return opts, fmt.Errorf("format must be one of webp, png or jpeg")
+	}
+
+	return opts, nil
+}
 
-		// Return the image data as the response
-		return c.Send(imgData)
+// sendMedia writes media with caching headers, answering conditional
+// requests with 304 Not Modified. Only imageproxy.SafeTypes are served, with
+// the content type sniffed from the data.
+func sendMedia(c *fiber.Ctx, media *imageproxy.Media) error {
+	contentType, safe := imageproxy.SafeType(media)
+	if !safe {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(Response{
+			Status:  "ERROR",
+			Message: "Refusing to serve " + contentType + ", only png, jpeg, gif and webp images are served",
+		})
 	}
+
+	etag := `"` + media.Hash + `"`
+	c.Set("ETag", etag)
+	c.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(imgProxy.Cache().TTL().Seconds())))
+
+	if c.Get("If-None-Match") == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set("Content-Type", contentType)
+	c.Set("X-Content-Type-Options", "nosniff")
+	return c.Send(media.Data)
 }
 
-func Start() {
+// Start serves the API until ctx is cancelled, then shuts the server down
+// gracefully, letting in-flight requests finish
+func Start(ctx context.Context) error {
 	var err error
 	if jb, err = junglebus.New(
 		junglebus.WithHTTP("https://junglebus.gorillapool.io"),
@@ -282,16 +393,43 @@ func Start() {
 	idColl = conn.Database("bap").Collection("id")
 	atColl = conn.Database("bap").Collection("attest")
 	proColl = conn.Database("bap").Collection("profile")
+	blobColl = conn.Database("bap").Collection(config.BlobCollection)
+	if err := conn.EnsureIndexes(ctx); err != nil {
+		log.Printf("[ERROR]: %v", err)
+	}
+	go trustGraph.Follow(ctx, atColl)
+
+	imgCache, err := imageproxy.NewCache(config.ImageCacheDir, config.ImageCacheTTL, config.ImageCacheMaxBytes)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	contentResolver := resolver.New(
+		resolver.DirStore{Dir: config.RawTxDir},
+		mongoBlobs{},
+		config.String("CONTENT_GATEWAY", config.ContentGateway),
+		imageproxy.NewHTTPFetcher(config.ImageFetchTimeout, config.ImageFetchMaxBytes),
+	)
+	imgProxy = imageproxy.New(contentResolver, imgCache)
 
 	if currentBlock, err = jb.GetChainTip(context.Background()); err != nil {
 		log.Println(err.Error())
+	} else {
+		metrics.SetChainTip(currentBlock.Height)
 	}
 
 	go func() {
 		ticker := time.NewTicker(time.Minute)
-		for range ticker.C {
-			if currentBlock, err = jb.GetChainTip(context.Background()); err != nil {
-				log.Println(err.Error())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if currentBlock, err = jb.GetChainTip(ctx); err != nil {
+					log.Println(err.Error())
+				} else {
+					metrics.SetChainTip(currentBlock.Height)
+				}
 			}
 		}
 	}()
@@ -299,6 +437,9 @@ func Start() {
 	// Initialize a new Fiber app
 	app := fiber.New()
 
+	// Record latency and status for every route
+	app.Use(metricsMiddleware)
+
 	// Enable CORS for all routes from any origin
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
@@ -341,9 +482,30 @@ func Start() {
 		return c.SendFile("docs/swagger.json")
 	})
 
+	// Prometheus metrics
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
+	// Liveness, readiness and sync status
+	app.Get("/healthz", healthzHandler)
+	app.Get("/readyz", readyzHandler)
+	app.Get("/v1/status", statusHandler)
+
+	// Admin routes, refused unless ADMIN_TOKEN is set
+	admin := app.Group("/v1/admin", adminAuth)
+	admin.Get("/quarantine", listQuarantineHandler)
+	admin.Post("/quarantine/:txid/reprocess", reprocessHandler)
+	admin.Post("/simulate", simulateHandler)
+
 	// Define routes with their handlers
 	app.Get("/", rootHandler)
+	app.Get("/v1/address/:address", getAddressHandler)
 	app.Post("/v1/attestation/get", getAttestationHandler)
+	app.Get("/v1/attestation/:hash/vc", getAttestationVCHandler)
+	app.Post("/v1/attestation/vc/verify", verifyAttestationVCHandler)
+	app.Get("/v1/blob/:hash", getBlobHandler)
+	app.Get("/v1/identity/:idKey/conflicts", getIdentityConflictsHandler)
+	app.Get("/v1/identity/:idKey/trust", getIdentityTrustHandler)
+	app.Post("/v1/policy/evaluate", evaluatePolicyHandler)
 	app.Get("/v1/person/:field/:bapId", getPersonFieldHandler)
 
 	// @Summary Get profiles with pagination
@@ -404,7 +566,8 @@ func Start() {
 		findOptions := options.Find()
 		findOptions.SetSkip(offset)
 		findOptions.SetLimit(limit)
-		findOptions.SetSort(bson.D{{"timestamp", -1}}) // Adjust sorting as needed
+		findOptions.SetSort(bson.D{{Key: "timestamp", Value: -1}}) // Adjust sorting as needed
+		findOptions.SetProjection(profileProjection)
 
 		// Query the profiles collection
 		cursor, err := proColl.Find(c.Context(), bson.M{}, findOptions)
@@ -426,6 +589,7 @@ func Start() {
 					Message: "Error decoding profile",
 				})
 			}
+			normalizeProfile(profile)
 			profiles = append(profiles, profile)
 		}
 
@@ -501,7 +665,7 @@ func Start() {
 		findOptions := options.Find()
 		findOptions.SetSkip(offset)
 		findOptions.SetLimit(limit)
-		findOptions.SetSort(bson.D{{"firstSeen", -1}}) // Adjust sorting as needed
+		findOptions.SetSort(bson.D{{Key: "firstSeen", Value: -1}}) // Adjust sorting as needed
 
 		// Query the identities collection
 		cursor, err := idColl.Find(c.Context(), bson.M{}, findOptions)
@@ -526,27 +690,26 @@ func Start() {
 
 			// Fetch the profile associated with the identity
 			profile := map[string]interface{}{}
-			if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}).Decode(&profile); err != nil && err != mongo.ErrNoDocuments {
+			if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}, options.FindOne().SetProjection(profileProjection)).Decode(&profile); err != nil && err != mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusInternalServerError).JSON(Response{
 					Status:  "ERROR",
 					Message: err.Error(),
 				})
 			}
 
-			// Extract the 'data' field from the profile
-			var identityData interface{} = nil
-			if data, exists := profile["data"]; exists {
-				identityData = data
-			}
+			// Extract the raw and normalized profile
+			withProfile(&id, profile)
 
 			// Build the response object
 			identityResponse := map[string]interface{}{
-				"idKey":          id.IDKey,
-				"firstSeen":      id.FirstSeen,
-				"rootAddress":    id.RootAddress,
-				"currentAddress": id.CurrentAddress,
-				"addresses":      id.Addresses,
-				"identity":       identityData,
+				"idKey":           id.IDKey,
+				"firstSeen":       id.FirstSeen,
+				"rootAddress":     id.RootAddress,
+				"currentAddress":  id.CurrentAddress,
+				"addresses":       id.Addresses,
+				"identity":        id.Identity,
+				"profile":         id.Profile,
+				"profileWarnings": id.ProfileWarnings,
 			}
 
 			identities = append(identities, identityResponse)
@@ -606,7 +769,8 @@ func Start() {
 
 		// Set up options to sort profiles by timestamp (ascending)
 		opts := options.Find()
-		opts.SetSort(bson.D{{"timestamp", 1}}) // Change to -1 for descending order
+		opts.SetSort(bson.D{{Key: "timestamp", Value: 1}}) // Change to -1 for descending order
+		opts.SetProjection(profileProjection)
 
 		// Fetch all profiles associated with the identity
 		cursor, err := proColl.Find(c.Context(), bson.M{"idKey": idKey}, opts)
@@ -628,6 +792,7 @@ func Start() {
 					Message: err.Error(),
 				})
 			}
+			normalizeProfile(profile)
 			profiles = append(profiles, profile)
 		}
 
@@ -668,19 +833,15 @@ func Start() {
 
 		// Fetch the profile associated with the identity
 		profile := map[string]interface{}{}
-		if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}).Decode(profile); err != nil && err != mongo.ErrNoDocuments {
+		if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}, options.FindOne().SetProjection(profileProjection)).Decode(profile); err != nil && err != mongo.ErrNoDocuments {
 			return c.Status(fiber.StatusInternalServerError).JSON(Response{
 				Status:  "ERROR",
 				Message: err.Error(),
 			})
 		}
 
-		// Assign the profile data to id.Identity
-		if data, exists := profile["data"]; exists {
-			id.Identity = data
-		} else {
-			id.Identity = nil
-		}
+		// Assign the raw and normalized profile to id
+		withProfile(id, profile)
 
 		return c.JSON(Response{
 			Status: "OK",
@@ -757,19 +918,15 @@ func Start() {
 
 			// Fetch the profile associated with the identity
 			profile := map[string]interface{}{}
-			if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}).Decode(profile); err != nil && err != mongo.ErrNoDocuments {
+			if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}, options.FindOne().SetProjection(profileProjection)).Decode(profile); err != nil && err != mongo.ErrNoDocuments {
 				return c.Status(fiber.StatusInternalServerError).JSON(Response{
 					Status:  "ERROR",
 					Message: err.Error(),
 				})
 			}
 
-			// Assign the profile data to id.Identity
-			if data, exists := profile["data"]; exists {
-				id.Identity = data
-			} else {
-				id.Identity = nil
-			}
+			// Assign the raw and normalized profile to id
+			withProfile(&id, profile)
 
 			ids = append(ids, id)
 		}
@@ -843,7 +1000,8 @@ func Start() {
 	})
 
 	// @Summary Validate identity by address
-	// @Description Validates an identity at a specific block height or timestamp
+	// @Description Validates an identity at a specific block height or timestamp. Identities deactivated by then are invalid,
+	// @Description as are disputed ones unless CONFLICTING_IDENTITIES_VALID is set; reason says why.
 	// @Tags identity
 	// @Accept json
 	// @Produce json
@@ -870,16 +1028,31 @@ func Start() {
 			})
 		}
 		profile := map[string]interface{}{}
-		if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}).Decode(profile); err != nil && err != mongo.ErrNoDocuments {
+		if err := proColl.FindOne(c.Context(), bson.M{"_id": id.IDKey}, options.FindOne().SetProjection(profileProjection)).Decode(profile); err != nil && err != mongo.ErrNoDocuments {
 			return c.Status(fiber.StatusInternalServerError).JSON(Response{
 				Status:  "ERROR",
 				Message: err.Error(),
 			})
 		}
+		withProfile(id, profile)
 		if req.Block == 0 && req.Timestamp == 0 {
 			req.Block = currentBlock.Height
 			req.Timestamp = currentBlock.Time
 		}
+		if valid, reason := identityValidity(id, req.Block, req.Timestamp); !valid {
+			return c.JSON(Response{
+				Status: "OK",
+				Result: IdentityValidResponse{
+					Identity: *id,
+					ValidityRecord: ValidityRecord{
+						Valid:     false,
+						Block:     req.Block,
+						Timestamp: req.Timestamp,
+						Reason:    reason,
+					},
+				},
+			})
+		}
 		if req.Block > 0 {
 			currentAddress := ""
 			for _, addr := range id.Addresses {
@@ -959,6 +1132,15 @@ func Start() {
 	}
 
 	addr := fmt.Sprintf(":%s", port)
+
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down API server")
+		if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
+			log.Printf("[ERROR]: %v", err)
+		}
+	}()
+
 	// Start the server on port 3000
-	log.Fatal(app.Listen(addr))
+	return app.Listen(addr)
 }
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestLookupField(t *testing.T) {
+	data := map[string]interface{}{
+		"name":  "Alice",
+		"empty": nil,
+		"homeLocation": map[string]interface{}{
+			"name": "Lisbon",
+			"geo":  map[string]interface{}{"latitude": 38.7},
+		},
+		"sameAs": bson.A{"https://example.com"},
+	}
+	tests := []struct {
+		path  string
+		value interface{}
+		found bool
+	}{
+		{"name", "Alice", true},
+		{"empty", nil, true},
+		{"homeLocation.name", "Lisbon", true},
+		{"homeLocation.geo.latitude", 38.7, true},
+		{"homeLocation.missing", nil, false},
+		{"name.first", nil, false},
+		{"sameAs.0", nil, false},
+		{"missing", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		value, found := lookupField(data, tt.path)
+		if fmt.Sprint(value) != fmt.Sprint(tt.value) || found != tt.found {
+			t.Errorf("lookupField(%q) = %v, %v, want %v, %v", tt.path, value, found, tt.value, tt.found)
+		}
+	}
+}
+
+func TestIsImageField(t *testing.T) {
+	tests := map[string]bool{
+		"image":             true,
+		"logo":              true,
+		"banner":            true,
+		"brand.logo":        true,
+		"author.image":      true,
+		"name":              false,
+		"image.url":         false,
+		"imageUrl":          false,
+		"homeLocation.name": false,
+		"":                  false,
+	}
+	for field, want := range tests {
+		if got := isImageField(field); got != want {
+			t.Errorf("isImageField(%q) = %v, want %v", field, got, want)
+		}
+	}
+}
+
+func TestFindProfile(t *testing.T) {
+	testCollections(t)
+	ctx := context.Background()
+
+	const (
+		rootAddress    = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+		currentAddress = "1KUrv2Ns8SwNkLgVKrVbSQz5Qi2BFp5wLY"
+	)
+	if _, err := idColl.InsertOne(ctx, &types.Identity{
+		IDKey:          testIDKey,
+		RootAddress:    rootAddress,
+		CurrentAddress: currentAddress,
+		Addresses: []types.Address{
+			{Address: testAddress, Block: 590000},
+			{Address: currentAddress, Block: 600000},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proColl.InsertOne(ctx, bson.M{
+		"_id":     testIDKey,
+		"data":    bson.M{"name": "Alice"},
+		"history": bson.A{bson.M{"data": bson.M{"name": "Old"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		bapId string
+		err   error
+	}{
+		{"idKey", testIDKey, nil},
+		{"root address", rootAddress, nil},
+		{"address rotated out", testAddress, nil},
+		{"current address", currentAddress, nil},
+		{"unknown", "1Unknown", mongo.ErrNoDocuments},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := findProfile(ctx, tt.bapId)
+			if err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			data, _ := profile["data"].(map[string]interface{})
+			if profile["_id"] != testIDKey || data["name"] != "Alice" {
+				t.Errorf("got %v, want the profile of %s", profile, testIDKey)
+			}
+			if _, ok := profile["history"]; ok {
+				t.Errorf("profile history was returned")
+			}
+		})
+	}
+}
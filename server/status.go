@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/crawler"
+	"github.com/BitcoinSchema/go-bap-indexer/state"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// statusCollections are counted in /v1/status
+var statusCollections = []string{"id", "attest", "profile", config.BlobCollection}
+
+// healthzHandler reports that the process is alive. It deliberately checks
+// nothing else so an unhealthy dependency doesn't get the process restarted.
+func healthzHandler(c *fiber.Ctx) error {
+	return c.JSON(Response{Status: "OK"})
+}
+
+// readyzHandler reports whether this instance should receive traffic: Mongo
+// is reachable, the crawler (if running in this process) is subscribed, and
+// the index is within ReadyMaxLag blocks of the chain tip.
+func readyzHandler(c *fiber.Ctx) error {
+	checks := []ReadinessCheck{}
+	ready := true
+	check := func(name string, err error) {
+		rc := ReadinessCheck{Name: name, OK: err == nil}
+		if err != nil {
+			rc.Message = err.Error()
+			ready = false
+		}
+		checks = append(checks, rc)
+	}
+
+	check("mongo", conn.Ping(c.Context()))
+
+	if crawlerStatus := crawler.CurrentStatus(); !crawlerStatus.Running {
+		// API only instances rely on the lag check alone
+		checks = append(checks, ReadinessCheck{Name: "crawler", OK: true, Message: "not running in this process"})
+	} else if !crawlerStatus.Subscribed() {
+		check("crawler", fmt.Errorf("junglebus connection is %s", crawlerStatus.Connection))
+	} else {
+		check("crawler", nil)
+	}
+
+	indexed, err := state.ReadProgress()
+	maxLag := config.Int("READY_MAX_LAG", config.ReadyMaxLag)
+	if err == nil {
+		if currentBlock == nil {
+			err = fmt.Errorf("chain tip unknown")
+		} else if lag := int64(currentBlock.Height) - int64(indexed); lag > int64(maxLag) {
+			err = fmt.Errorf("index is %d blocks behind the chain tip (max %d)", lag, maxLag)
+		}
+	}
+	check("lag", err)
+
+	if !ready {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(Response{
+			Status:  "ERROR",
+			Message: "Not ready",
+			Result:  checks,
+		})
+	}
+
+	return c.JSON(Response{
+		Status: "OK",
+		Result: checks,
+	})
+}
+
+// @Summary Get indexer status
+// @Description Returns the indexed height, chain tip, lag, JungleBus connection state, last processed block and collection counts
+// @Tags status
+// @Produce json
+// @Success 200 {object} Response{result=StatusResponse} "Indexer status"
+// @Failure 500 {object} Response "Server error"
+// @Router /status [get]
+func statusHandler(c *fiber.Ctx) error {
+	indexed, err := state.ReadProgress()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	res := StatusResponse{
+		IndexedHeight: indexed,
+		Crawler:       crawler.CurrentStatus(),
+		Collections:   map[string]int64{},
+	}
+	if currentBlock != nil {
+		res.ChainTip = currentBlock.Height
+		res.Lag = int64(currentBlock.Height) - int64(indexed)
+	}
+
+	for _, name := range statusCollections {
+		count, err := conn.CountCollectionDocs(name, bson.M{})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(Response{
+				Status:  "ERROR",
+				Message: err.Error(),
+			})
+		}
+		res.Collections[name] = count
+	}
+
+	return c.JSON(Response{
+		Status: "OK",
+		Result: res,
+	})
+}
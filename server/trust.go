@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/trust"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var trustGraph = trust.New()
+
+// @Summary Get identity trust scores
+// @Description Scores an identity over the attestation graph, starting from a set of trusted root identities.
+// @Description An edge runs from each identity that co-signed an attestation to the identity that signed it first.
+// @Description pageRank is the identity's personalized PageRank from the roots, pathScore is decay to the power of the
+// @Description number of attestations on the shortest path from a root, and path is that path.
+// @Tags identity
+// @Produce json
+// @Param idKey path string true "Identity key"
+// @Param from query string true "Comma separated idKeys of the trusted roots"
+// @Param damping query number false "PageRank damping, between 0 and 1 (default: 0.85)"
+// @Param decay query number false "Path score kept per hop, between 0 and 1 (default: 0.5)"
+// @Success 200 {object} Response{result=TrustResponse} "Trust scores"
+// @Failure 400 {object} Response "Missing roots or invalid parameters"
+// @Failure 404 {object} Response "Identity not found"
+// @Failure 500 {object} Response "Server error"
+// @Router /identity/{idKey}/trust [get]
+func getIdentityTrustHandler(c *fiber.Ctx) error {
+	var roots []string
+	for _, root := range strings.Split(c.Query("from"), ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "from must list at least one root idKey",
+		})
+	}
+	damping, err := unitParam(c, "damping", config.TrustDamping)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+	decay, err := unitParam(c, "decay", config.TrustDecay)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	id := &types.Identity{}
+	if err := idColl.FindOne(c.Context(), bson.M{"_id": c.Params("idKey")}).Decode(id); err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "Identity could not be found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	pathScore, path := trustGraph.Path(roots, id.IDKey, decay, config.TrustMaxDepth)
+	if path == nil {
+		path = []trust.Edge{}
+	}
+	return c.JSON(Response{
+		Status: "OK",
+		Result: TrustResponse{
+			IDKey:     id.IDKey,
+			From:      roots,
+			PageRank:  trustGraph.PageRank(roots, damping)[id.IDKey],
+			PathScore: pathScore,
+			Path:      path,
+		},
+	})
+}
+
+// unitParam reads query param name as a number strictly between 0 and 1
+func unitParam(c *fiber.Ctx, name string, fallback float64) (float64, error) {
+	v := c.Query(name)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 || f >= 1 {
+		return 0, fmt.Errorf("%s must be a number between 0 and 1", name)
+	}
+	return f, nil
+}
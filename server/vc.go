@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"github.com/BitcoinSchema/go-bap-indexer/vc"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// @Summary Get attestation as verifiable credentials
+// @Description Renders each signature of an attestation that hasn't been revoked as a W3C Verifiable Credential
+// @Description (JSON-LD). The issuer is the signer's did:bap:id identifier, the subject is the identity that signed
+// @Description the attestation first, and the proof points at the on-chain signature by txid, output and instance and
+// @Description carries its value and the message it signs.
+// @Tags attestation
+// @Produce json
+// @Param hash path string true "Attestation hash"
+// @Success 200 {object} Response{result=[]vc.Credential} "One credential per signer"
+// @Failure 404 {object} Response "Attestation not found"
+// @Failure 500 {object} Response "Server error"
+// @Router /attestation/{hash}/vc [get]
+func getAttestationVCHandler(c *fiber.Ctx) error {
+	att := &types.Attestation{}
+	if err := atColl.FindOne(c.Context(), bson.M{"_id": c.Params("hash")}).Decode(att); err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(Response{
+			Status:  "ERROR",
+			Message: "Attestation could not be found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(Response{
+		Status: "OK",
+		Result: vc.FromAttestation(att, time.Now()),
+	})
+}
+
+// @Summary Verify an attestation credential
+// @Description Checks a credential from /v1/attestation/{hash}/vc against the index: the attestation and the issuer's
+// @Description signature must be indexed as described, the proof value must verify against the signed message, the
+// @Description issuer must be valid now, and the signing address must have been the issuer's address when it signed.
+// @Description Each check is reported.
+// @Tags attestation
+// @Accept json
+// @Produce json
+// @Param credential body vc.Credential true "Verifiable credential"
+// @Success 200 {object} Response{result=vc.Verification} "Whether the credential is valid, and the checks made"
+// @Failure 400 {object} Response "Invalid credential"
+// @Failure 500 {object} Response "Server error"
+// @Router /attestation/vc/verify [post]
+func verifyAttestationVCHandler(c *fiber.Ctx) error {
+	cred := &vc.Credential{}
+	if err := json.Unmarshal(c.Body(), cred); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{
+			Status:  "ERROR",
+			Message: "Invalid credential: " + err.Error(),
+		})
+	}
+
+	v, err := vc.Verify(c.Context(), indexSource{}, cred)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(Response{
+			Status:  "ERROR",
+			Message: err.Error(),
+		})
+	}
+	return c.JSON(Response{
+		Status: "OK",
+		Result: v,
+	})
+}
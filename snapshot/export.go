@@ -0,0 +1,178 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/database"
+	"github.com/BitcoinSchema/go-bap-indexer/state"
+	"github.com/b-open-io/go-junglebus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Export writes every collection in Collections to a gzipped tar at path.
+// Each collection is an NDJSON file of canonical extended JSON, so types
+// survive the round trip. The indexer should not be writing while it runs.
+func Export(ctx context.Context, path string) (*Manifest, error) {
+	height, err := state.ReadProgress()
+	if err != nil {
+		return nil, fmt.Errorf("reading progress: %w", err)
+	}
+	hash, err := blockHash(ctx, height)
+	if err != nil {
+		return nil, fmt.Errorf("getting hash of block %d: %w", height, err)
+	}
+
+	manifest := &Manifest{
+		Version:     Version,
+		CreatedAt:   time.Now().UTC(),
+		Height:      height,
+		BlockHash:   hash,
+		Collections: map[string]CollectionManifest{},
+	}
+
+	// tar needs each entry's size up front, so collections are staged on disk
+	tmpDir, err := os.MkdirTemp("", "bap-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{}
+	for _, name := range Collections {
+		files[name] = fmt.Sprintf("%s/%s.ndjson", tmpDir, name)
+		cm, err := exportCollection(ctx, name, files[name])
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", name, err)
+		}
+		manifest.Collections[name] = *cm
+	}
+
+	if err := writeArchive(path, manifest, files); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeArchive writes manifest and then the file of each collection in
+// Collections, by name in files, to a gzipped tar at path
+func writeArchive(path string, manifest *Manifest, files map[string]string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	m, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, manifestName, int64(len(m)), bytes.NewReader(m)); err != nil {
+		return err
+	}
+	for _, name := range Collections {
+		if err := copyFileEntry(tw, manifest.Collections[name].File, files[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func exportCollection(ctx context.Context, name string, path string) (*CollectionManifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, hash))
+
+	cursor, err := database.GetConnection().Database("bap").Collection(name).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	cm := &CollectionManifest{File: name + ".ndjson"}
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return nil, err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+		cm.Documents++
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	cm.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return cm, f.Close()
+}
+
+func copyFileEntry(tw *tar.Writer, name string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeEntry(tw, name, info.Size(), f)
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// blockHash looks up the hash of the block at height on JungleBus
+func blockHash(ctx context.Context, height uint32) (string, error) {
+	jb, err := junglebus.New(
+		junglebus.WithHTTP(config.JunglebusEndpoint),
+	)
+	if err != nil {
+		return "", err
+	}
+	header, err := jb.GetBlockHeader(ctx, strconv.FormatUint(uint64(height), 10))
+	if err != nil {
+		return "", err
+	}
+	return header.Hash, nil
+}
@@ -0,0 +1,214 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/BitcoinSchema/go-bap-indexer/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// importBatch is the number of documents per InsertMany
+const importBatch = 1000
+
+// Verify checks the snapshot at path against its manifest: supported
+// version, every collection present, and matching document counts and
+// checksums. It returns the manifest.
+func Verify(path string) (*Manifest, error) {
+	seen := map[string]bool{}
+
+	manifest, err := walk(path, func(m *Manifest, name string, r io.Reader) error {
+		collection, cm, ok := m.collectionFor(name)
+		if !ok {
+			return fmt.Errorf("unexpected entry %s", name)
+		}
+
+		hash := sha256.New()
+		scanner := newScanner(io.TeeReader(r, hash))
+		var docs int64
+		for scanner.Scan() {
+			docs++
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		// drain anything the scanner didn't consume
+		if _, err := io.Copy(io.Discard, io.TeeReader(r, hash)); err != nil {
+			return err
+		}
+
+		if docs != cm.Documents {
+			return fmt.Errorf("%s has %d documents, manifest says %d", name, docs, cm.Documents)
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != cm.SHA256 {
+			return fmt.Errorf("%s checksum %s does not match manifest %s", name, sum, cm.SHA256)
+		}
+		seen[collection] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range manifest.Collections {
+		if !seen[name] {
+			return nil, fmt.Errorf("collection %s is missing from the snapshot", name)
+		}
+	}
+	return manifest, nil
+}
+
+// Import verifies the snapshot at path and loads it. The target collections
+// must be empty unless force is set, in which case they are emptied first.
+// The block hash is checked against JungleBus when it can be reached.
+func Import(ctx context.Context, path string, force bool) (*Manifest, error) {
+	manifest, err := Verify(path)
+	if err != nil {
+		return nil, fmt.Errorf("verifying snapshot: %w", err)
+	}
+
+	if hash, err := blockHash(ctx, manifest.Height); err != nil {
+		log.Printf("[WARN]: could not check the hash of block %d: %v", manifest.Height, err)
+	} else if hash != manifest.BlockHash {
+		return nil, fmt.Errorf("snapshot block %d has hash %s but the chain has %s", manifest.Height, manifest.BlockHash, hash)
+	}
+
+	conn := database.GetConnection()
+	db := conn.Database("bap")
+	for name := range manifest.Collections {
+		coll := db.Collection(name)
+		if force {
+			// not Drop, which would take the indexes with it
+			if _, err := coll.DeleteMany(ctx, bson.M{}); err != nil {
+				return nil, fmt.Errorf("emptying %s: %w", name, err)
+			}
+			continue
+		}
+		if n, err := coll.EstimatedDocumentCount(ctx); err != nil {
+			return nil, err
+		} else if n > 0 {
+			return nil, fmt.Errorf("collection %s is not empty, import with force to replace it", name)
+		}
+	}
+
+	_, err = walk(path, func(m *Manifest, name string, r io.Reader) error {
+		collection, _, _ := m.collectionFor(name)
+		return load(ctx, db.Collection(collection), r)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, cm := range manifest.Collections {
+		if n, err := db.Collection(name).CountDocuments(ctx, bson.M{}); err != nil {
+			return nil, err
+		} else if n != cm.Documents {
+			return nil, fmt.Errorf("%s has %d documents after import, manifest says %d", name, n, cm.Documents)
+		}
+	}
+	// a fresh database has no indexes yet
+	if err := conn.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func load(ctx context.Context, coll *mongo.Collection, r io.Reader) error {
+	scanner := newScanner(r)
+	docs := make([]interface{}, 0, importBatch)
+	flush := func() error {
+		if len(docs) == 0 {
+			return nil
+		}
+		_, err := coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		docs = docs[:0]
+		return err
+	}
+
+	for scanner.Scan() {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+			return fmt.Errorf("%s: %w", coll.Name(), err)
+		}
+		docs = append(docs, doc)
+		if len(docs) == importBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// walk reads the manifest from the first entry of the snapshot at path, then
+// calls fn for every collection entry
+func walk(path string, fn func(m *Manifest, name string, r io.Reader) error) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if header.Name != manifestName {
+		return nil, fmt.Errorf("first entry is %s, expected %s", header.Name, manifestName)
+	}
+	manifest := &Manifest{}
+	if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, fmt.Errorf("snapshot version %d is not supported (max %d)", manifest.Version, Version)
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return manifest, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if err := fn(manifest, header.Name, tr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// collectionFor finds the collection stored in the entry named file
+func (m *Manifest) collectionFor(file string) (string, CollectionManifest, bool) {
+	for name, cm := range m.Collections {
+		if cm.File == file {
+			return name, cm, true
+		}
+	}
+	return "", CollectionManifest{}, false
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return scanner
+}
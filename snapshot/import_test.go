@@ -0,0 +1,184 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSnapshot writes a snapshot with two documents per collection, each
+// in <collection>.ndjson, and the manifest of them after edit has had a
+// chance to change it. It returns the snapshot's path.
+func testSnapshot(t *testing.T, edit func(m *Manifest)) string {
+	t.Helper()
+	manifest, files := testCollections(t)
+	if edit != nil {
+		edit(manifest)
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := writeEntry(tw, manifestName, int64(len(data)), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range Collections {
+		if err := copyFileEntry(tw, name+".ndjson", files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testCollections writes two documents per collection and returns their
+// manifest and files, as exportCollection would
+func testCollections(t *testing.T) (*Manifest, map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	manifest := &Manifest{Version: Version, Height: 600000, BlockHash: "00", Collections: map[string]CollectionManifest{}}
+	files := map[string]string{}
+	for _, name := range Collections {
+		content := `{"_id":"` + name + `-1"}` + "\n" + `{"_id":"` + name + `-2"}` + "\n"
+		files[name] = filepath.Join(dir, name+".ndjson")
+		if err := os.WriteFile(files[name], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		manifest.Collections[name] = CollectionManifest{File: name + ".ndjson", Documents: 2, SHA256: hex.EncodeToString(sum[:])}
+	}
+	return manifest, files
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(m *Manifest)
+		// err is a substring of the error, empty when the snapshot is valid
+		err string
+	}{
+		{"valid", nil, ""},
+		{"checksum", func(m *Manifest) {
+			cm := m.Collections["attest"]
+			cm.SHA256 = strings.Repeat("0", 64)
+			m.Collections["attest"] = cm
+		}, "attest.ndjson checksum"},
+		{"document count", func(m *Manifest) {
+			cm := m.Collections["profile"]
+			cm.Documents = 3
+			m.Collections["profile"] = cm
+		}, "profile.ndjson has 2 documents, manifest says 3"},
+		{"missing collection", func(m *Manifest) {
+			m.Collections["extra"] = CollectionManifest{File: "extra.ndjson"}
+		}, "collection extra is missing"},
+		{"unexpected entry", func(m *Manifest) {
+			cm := m.Collections["id"]
+			cm.File = "identities.ndjson"
+			m.Collections["id"] = cm
+		}, "unexpected entry id.ndjson"},
+		{"newer version", func(m *Manifest) { m.Version = Version + 1 }, "not supported"},
+		{"no version", func(m *Manifest) { m.Version = 0 }, "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := Verify(testSnapshot(t, tt.edit))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if manifest.Height != 600000 || len(manifest.Collections) != len(Collections) {
+					t.Errorf("manifest %+v, want height 600000 and %d collections", manifest, len(Collections))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyManifestFirst(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := writeEntry(tw, "id.ndjson", 0, strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	if _, err := Verify(path); err == nil || !strings.Contains(err.Error(), "expected "+manifestName) {
+		t.Errorf("got %v, want the manifest to be required first", err)
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	manifest, files := testCollections(t)
+	path := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	if err := writeArchive(path, manifest, files); err != nil {
+		t.Fatal(err)
+	}
+	verified, err := Verify(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.Height != manifest.Height || verified.BlockHash != manifest.BlockHash {
+		t.Errorf("read back %+v, want %+v", verified, manifest)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	var names []string
+	manifest, err := walk(testSnapshot(t, nil), func(m *Manifest, name string, r io.Reader) error {
+		collection, _, ok := m.collectionFor(name)
+		if !ok {
+			t.Errorf("no collection for %s", name)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(string(data), `{"_id":"`+collection+`-1"}`) {
+			t.Errorf("%s holds %q", name, data)
+		}
+		names = append(names, collection)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.BlockHash != "00" {
+		t.Errorf("block hash %q, want 00", manifest.BlockHash)
+	}
+	if strings.Join(names, ",") != strings.Join(Collections, ",") {
+		t.Errorf("walked %v, want %v in order", names, Collections)
+	}
+}
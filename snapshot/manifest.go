@@ -0,0 +1,37 @@
+package snapshot
+
+import (
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+)
+
+// Version of the snapshot format written by Export. Import refuses snapshots
+// from a newer version.
+const Version = 1
+
+// manifestName is the first entry of every snapshot archive
+const manifestName = "manifest.json"
+
+// Collections are the collections a snapshot carries
+var Collections = []string{"id", "attest", "profile", config.BlobCollection, "_state"}
+
+// Manifest describes a snapshot
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Height is the _state height at export time, crawling resumes from it
+	Height uint32 `json:"height"`
+	// BlockHash is the hash of the block at Height, used to check the
+	// snapshot belongs to the chain being crawled
+	BlockHash   string                        `json:"blockHash"`
+	Collections map[string]CollectionManifest `json:"collections"`
+}
+
+// CollectionManifest describes the file holding one collection
+type CollectionManifest struct {
+	File      string `json:"file"`
+	Documents int64  `json:"documents"`
+	// SHA256 of the uncompressed file, hex encoded
+	SHA256 string `json:"sha256"`
+}
@@ -0,0 +1,40 @@
+package snapshot
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+)
+
+func TestCollections(t *testing.T) {
+	for _, name := range []string{"id", "attest", "profile", config.BlobCollection, "_state"} {
+		if !slices.Contains(Collections, name) {
+			t.Errorf("snapshots don't carry %s", name)
+		}
+	}
+}
+
+func TestCollectionFor(t *testing.T) {
+	m := &Manifest{Collections: map[string]CollectionManifest{
+		"id":                  {File: "id.ndjson", Documents: 1},
+		config.BlobCollection: {File: config.BlobCollection + ".ndjson", Documents: 2},
+	}}
+	tests := []struct {
+		file       string
+		collection string
+		documents  int64
+		ok         bool
+	}{
+		{"id.ndjson", "id", 1, true},
+		{config.BlobCollection + ".ndjson", config.BlobCollection, 2, true},
+		{"attest.ndjson", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		collection, cm, ok := m.collectionFor(tt.file)
+		if collection != tt.collection || cm.Documents != tt.documents || ok != tt.ok {
+			t.Errorf("collectionFor(%q) = %q, %d, %v, want %q, %d, %v", tt.file, collection, cm.Documents, ok, tt.collection, tt.documents, tt.ok)
+		}
+	}
+}
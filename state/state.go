@@ -28,6 +28,25 @@ func SaveProgress(height uint32) {
 
 }
 
+// ReadProgress returns the height stored in the _state collection without
+// creating it when missing
+func ReadProgress() (height uint32, err error) {
+	conn := database.GetConnection()
+
+	doc, err := conn.GetStateDocs("_state", 1, 0, bson.M{"_id": "_state"})
+	if err != nil || len(doc) == 0 {
+		return 0, err
+	}
+
+	switch h := doc[0]["height"].(type) {
+	case int64:
+		height = uint32(h)
+	case int32:
+		height = uint32(h)
+	}
+	return
+}
+
 // LoadProgress loads the block height from ./block.tmp
 func LoadProgress() (height uint32) {
 
@@ -0,0 +1,90 @@
+package trust
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Load rebuilds g from every attestation in coll
+func (g *Graph) Load(ctx context.Context, coll *mongo.Collection) error {
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var atts []*types.Attestation
+	if err := cursor.All(ctx, &atts); err != nil {
+		return err
+	}
+	g.Replace(atts)
+	return nil
+}
+
+// Follow keeps g in step with coll until ctx is cancelled. Attestations
+// written or revoked by the crawler, in this process or another, are applied
+// one at a time from a change stream. Where change streams aren't available
+// (a standalone server) g is reloaded every config.TrustReloadInterval.
+func (g *Graph) Follow(ctx context.Context, coll *mongo.Collection) {
+	for ctx.Err() == nil {
+		if err := g.follow(ctx, coll); err != nil && ctx.Err() == nil {
+			log.Printf("[TRUST]: %v, reloading in %s", err, config.TrustReloadInterval)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(config.TrustReloadInterval):
+		}
+	}
+}
+
+// follow loads g and applies changes until the stream fails
+func (g *Graph) follow(ctx context.Context, coll *mongo.Collection) error {
+	// opened before loading so nothing written in between is missed,
+	// replaying those changes is harmless
+	stream, streamErr := coll.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err := g.Load(ctx, coll); err != nil {
+		if stream != nil {
+			stream.Close(context.Background())
+		}
+		return fmt.Errorf("loading attestations: %w", err)
+	}
+	attestations, edges := g.Size()
+	log.Printf("[TRUST]: loaded %d attestations, %d edges", attestations, edges)
+	if streamErr != nil {
+		return fmt.Errorf("watching attestations: %w", streamErr)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var change struct {
+			OperationType string             `bson:"operationType"`
+			FullDocument  *types.Attestation `bson:"fullDocument"`
+			DocumentKey   struct {
+				ID string `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			return fmt.Errorf("decoding attestation change: %w", err)
+		}
+		switch change.OperationType {
+		case "insert", "update", "replace":
+			if change.FullDocument == nil {
+				// deleted before the lookup
+				g.Remove(change.DocumentKey.ID)
+			} else {
+				g.Set(change.FullDocument)
+			}
+		case "delete":
+			g.Remove(change.DocumentKey.ID)
+		case "drop", "rename", "dropDatabase", "invalidate":
+			return fmt.Errorf("attestation stream ended by %s", change.OperationType)
+		}
+	}
+	return stream.Err()
+}
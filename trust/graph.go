@@ -0,0 +1,157 @@
+// Package trust scores identities over the attestation graph. An edge runs
+// from each identity that signed an attestation to the identity it is about.
+//
+// Attestation hashes don't name their subject, so the identity that signed an
+// attestation first is taken as its subject: owners publish their own
+// attributes and others co-sign them to vouch for them.
+package trust
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// Edge is one attestation by From about To
+type Edge struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Attestation string `json:"hash"`
+}
+
+// claim is the part of an attestation the graph keeps
+type claim struct {
+	subject   string
+	attesters []string
+}
+
+// Graph is the attestation graph, kept up to date one attestation at a time
+type Graph struct {
+	mu     sync.RWMutex
+	claims map[string]claim
+	// out holds the attestation hashes behind each edge, by attester then
+	// subject
+	out map[string]map[string][]string
+	// version changes with every edit, cached scores are for one version
+	version uint64
+	// ranks is written by readers of g.mu, so it has a lock of its own
+	ranksMu sync.Mutex
+	ranks   map[string]*rankCache
+}
+
+// New returns an empty graph
+func New() *Graph {
+	return &Graph{
+		claims: map[string]claim{},
+		out:    map[string]map[string][]string{},
+		ranks:  map[string]*rankCache{},
+	}
+}
+
+// newClaim reads the edges of att. A REVOKE removes the signature from
+// att.Signers, so revoked signers don't vouch for anything.
+func newClaim(att *types.Attestation) claim {
+	var c claim
+	for _, s := range att.Signers {
+		if s == nil || s.IDKey == "" {
+			continue
+		}
+		if c.subject == "" {
+			c.subject = s.IDKey
+		} else if s.IDKey != c.subject && !slices.Contains(c.attesters, s.IDKey) {
+			c.attesters = append(c.attesters, s.IDKey)
+		}
+	}
+	return c
+}
+
+// Set adds att or replaces the edges of an earlier version of it
+func (g *Graph) Set(att *types.Attestation) {
+	c := newClaim(att)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if old, ok := g.claims[att.Id]; ok {
+		if old.subject == c.subject && slices.Equal(old.attesters, c.attesters) {
+			return
+		}
+		g.unlink(att.Id, old)
+	}
+	if c.subject == "" {
+		delete(g.claims, att.Id)
+	} else {
+		g.claims[att.Id] = c
+		g.link(att.Id, c)
+	}
+	g.version++
+}
+
+// Remove drops the edges of the attestation with hash
+func (g *Graph) Remove(hash string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if old, ok := g.claims[hash]; ok {
+		g.unlink(hash, old)
+		delete(g.claims, hash)
+		g.version++
+	}
+}
+
+// Replace swaps the whole graph for one built from atts
+func (g *Graph) Replace(atts []*types.Attestation) {
+	claims := make(map[string]claim, len(atts))
+	for _, att := range atts {
+		if c := newClaim(att); c.subject != "" {
+			claims[att.Id] = c
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.claims, g.out = claims, map[string]map[string][]string{}
+	for hash, c := range claims {
+		g.link(hash, c)
+	}
+	g.version++
+}
+
+// Size returns the number of attestations and edges in the graph
+func (g *Graph) Size() (attestations int, edges int) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, subjects := range g.out {
+		for _, hashes := range subjects {
+			edges += len(hashes)
+		}
+	}
+	return len(g.claims), edges
+}
+
+// link adds the edges of c. The caller holds g.mu.
+func (g *Graph) link(hash string, c claim) {
+	for _, from := range c.attesters {
+		subjects, ok := g.out[from]
+		if !ok {
+			subjects = map[string][]string{}
+			g.out[from] = subjects
+		}
+		subjects[c.subject] = append(subjects[c.subject], hash)
+	}
+}
+
+// unlink removes the edges of c. The caller holds g.mu.
+func (g *Graph) unlink(hash string, c claim) {
+	for _, from := range c.attesters {
+		subjects := g.out[from]
+		subjects[c.subject] = slices.DeleteFunc(subjects[c.subject], func(h string) bool {
+			return h == hash
+		})
+		if len(subjects[c.subject]) == 0 {
+			delete(subjects, c.subject)
+		}
+		if len(subjects) == 0 {
+			delete(g.out, from)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package trust
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// att is an attestation signed first by subject, then by attesters
+func att(hash, subject string, attesters ...string) *types.Attestation {
+	a := &types.Attestation{Id: hash, Signers: []*types.Signer{{IDKey: subject}}}
+	for _, from := range attesters {
+		a.Signers = append(a.Signers, &types.Signer{IDKey: from})
+	}
+	return a
+}
+
+func TestGraphEdits(t *testing.T) {
+	// as the crawler stores a REVOKE by a
+	revoked := att("h3", "b", "c")
+	revoked.Revocations = []types.Revocation{{IDKey: "a", Removed: []*types.Signer{{IDKey: "a"}}}}
+
+	tests := []struct {
+		name string
+		edit func(g *Graph)
+		// attesters of b, by attester
+		attesters    map[string][]string
+		attestations int
+		edges        int
+	}{
+		{
+			name:         "attesters of the first signer",
+			edit:         func(g *Graph) { g.Set(att("h1", "b", "a", "c")) },
+			attesters:    map[string][]string{"a": {"h1"}, "c": {"h1"}},
+			attestations: 1,
+			edges:        2,
+		},
+		{
+			name: "edges add up per attestation",
+			edit: func(g *Graph) {
+				g.Set(att("h1", "b", "a"))
+				g.Set(att("h2", "b", "a"))
+			},
+			attesters:    map[string][]string{"a": {"h1", "h2"}},
+			attestations: 2,
+			edges:        2,
+		},
+		{
+			name:         "revoked signers don't vouch",
+			edit:         func(g *Graph) { g.Set(revoked) },
+			attesters:    map[string][]string{"c": {"h3"}},
+			attestations: 1,
+			edges:        1,
+		},
+		{
+			name: "a signer can't vouch for itself",
+			edit: func(g *Graph) {
+				g.Set(att("h1", "b", "b", "a", "a"))
+			},
+			attesters:    map[string][]string{"a": {"h1"}},
+			attestations: 1,
+			edges:        1,
+		},
+		{
+			name: "set replaces the earlier version",
+			edit: func(g *Graph) {
+				g.Set(att("h1", "b", "a"))
+				g.Set(att("h1", "b", "c"))
+			},
+			attesters:    map[string][]string{"c": {"h1"}},
+			attestations: 1,
+			edges:        1,
+		},
+		{
+			name: "remove",
+			edit: func(g *Graph) {
+				g.Set(att("h1", "b", "a"))
+				g.Set(att("h2", "b", "c"))
+				g.Remove("h1")
+			},
+			attesters:    map[string][]string{"c": {"h2"}},
+			attestations: 1,
+			edges:        1,
+		},
+		{
+			name: "attestation with every signer revoked",
+			edit: func(g *Graph) {
+				g.Set(att("h1", "b", "a"))
+				all := att("h1", "b", "a")
+				all.Revocations = []types.Revocation{{IDKey: "b", Removed: all.Signers[:1]}, {IDKey: "a", Removed: all.Signers[1:]}}
+				all.Signers = []*types.Signer{}
+				g.Set(all)
+			},
+			attesters: map[string][]string{},
+		},
+		{
+			name: "replace",
+			edit: func(g *Graph) {
+				g.Set(att("h1", "b", "a"))
+				g.Replace([]*types.Attestation{att("h2", "b", "c"), att("h3", "c", "b"), att("h4", "b")})
+			},
+			attesters:    map[string][]string{"c": {"h2"}},
+			attestations: 3,
+			edges:        2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			tt.edit(g)
+			if got := g.Attesters("b"); !maps.EqualFunc(got, tt.attesters, slices.Equal) {
+				t.Errorf("attesters %v, want %v", got, tt.attesters)
+			}
+			if attestations, edges := g.Size(); attestations != tt.attestations || edges != tt.edges {
+				t.Errorf("%d attestations, %d edges, want %d, %d", attestations, edges, tt.attestations, tt.edges)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package trust
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/BitcoinSchema/go-bap-indexer/config"
+)
+
+// maxCachedRanks bounds the root sets PageRank keeps scores for
+const maxCachedRanks = 100
+
+// rankCache holds the PageRank scores for one set of roots at one version
+type rankCache struct {
+	version uint64
+	scores  map[string]float64
+}
+
+// PageRank returns the personalized PageRank of every identity in the graph,
+// restarting from roots with probability 1-damping at each step. Each
+// attester's score is split over its edges by the number of attestations
+// behind them. Scores add up to 1 and are cached until the graph changes.
+func (g *Graph) PageRank(roots []string, damping float64) map[string]float64 {
+	roots = slices.Compact(slices.Sorted(slices.Values(roots)))
+	key := fmt.Sprintf("%s|%g", strings.Join(roots, ","), damping)
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	g.ranksMu.Lock()
+	cached, ok := g.ranks[key]
+	g.ranksMu.Unlock()
+	if ok && cached.version == g.version {
+		return cached.scores
+	}
+	if len(roots) == 0 {
+		return map[string]float64{}
+	}
+
+	teleport := make(map[string]float64, len(roots))
+	for _, root := range roots {
+		teleport[root] = 1 / float64(len(roots))
+	}
+	scores := teleport
+	for i := 0; i < config.TrustIterations; i++ {
+		next := make(map[string]float64, len(scores))
+		for root, p := range teleport {
+			next[root] += (1 - damping) * p
+		}
+		for from, score := range scores {
+			subjects := g.out[from]
+			total := 0
+			for _, hashes := range subjects {
+				total += len(hashes)
+			}
+			if total == 0 {
+				// nobody to pass it to, so it goes back to the roots
+				for root, p := range teleport {
+					next[root] += damping * score * p
+				}
+				continue
+			}
+			for to, hashes := range subjects {
+				next[to] += damping * score * float64(len(hashes)) / float64(total)
+			}
+		}
+
+		moved := 0.0
+		for id, score := range next {
+			moved += math.Abs(score - scores[id])
+		}
+		for id, score := range scores {
+			if _, ok := next[id]; !ok {
+				moved += score
+			}
+		}
+		scores = next
+		if moved < config.TrustTolerance {
+			break
+		}
+	}
+
+	g.ranksMu.Lock()
+	if len(g.ranks) >= maxCachedRanks {
+		g.ranks = map[string]*rankCache{}
+	}
+	g.ranks[key] = &rankCache{version: g.version, scores: scores}
+	g.ranksMu.Unlock()
+	return scores
+}
+
+// Path returns the shortest chain of attestations from any of roots to
+// target, no longer than maxDepth, and its score: decay to the power of its
+// length. A root scores 1 with no path, an unreachable identity 0.
+func (g *Graph) Path(roots []string, target string, decay float64, maxDepth int) (float64, []Edge) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	// breadth first, remembering the edge each identity was reached by
+	via := map[string]*Edge{}
+	frontier := []string{}
+	for _, root := range roots {
+		if root == target {
+			return 1, []Edge{}
+		}
+		if _, seen := via[root]; !seen {
+			via[root] = nil
+			frontier = append(frontier, root)
+		}
+	}
+
+	for depth := 1; depth <= maxDepth && len(frontier) > 0; depth++ {
+		var next []string
+		for _, from := range frontier {
+			// sorted so the same graph always gives the same path
+			for _, to := range slices.Sorted(maps.Keys(g.out[from])) {
+				if _, seen := via[to]; seen {
+					continue
+				}
+				via[to] = &Edge{From: from, To: to, Attestation: g.out[from][to][0]}
+				if to == target {
+					path := make([]Edge, 0, depth)
+					for e := via[to]; e != nil; e = via[e.From] {
+						path = append(path, *e)
+					}
+					slices.Reverse(path)
+					return math.Pow(decay, float64(depth)), path
+				}
+				next = append(next, to)
+			}
+		}
+		frontier = next
+	}
+	return 0, nil
+}
+
+// Attesters returns the identities with an edge to idKey and the hashes of
+// their attestations about it
+func (g *Graph) Attesters(idKey string) map[string][]string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	attesters := map[string][]string{}
+	for from, subjects := range g.out {
+		if hashes, ok := subjects[idKey]; ok {
+			attesters[from] = slices.Clone(hashes)
+		}
+	}
+	return attesters
+}
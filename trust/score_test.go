@@ -0,0 +1,156 @@
+package trust
+
+import (
+	"math"
+	"testing"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+func TestPageRank(t *testing.T) {
+	tests := []struct {
+		name    string
+		atts    []*types.Attestation
+		roots   []string
+		damping float64
+		want    map[string]float64
+	}{
+		{
+			name:    "no roots",
+			atts:    []*types.Attestation{att("h1", "b", "a")},
+			damping: 0.5,
+			want:    map[string]float64{},
+		},
+		{
+			// pA = 1/2 + pB/2 since b gives its score back, pB = pA/2
+			name:    "one edge",
+			atts:    []*types.Attestation{att("h1", "b", "a")},
+			roots:   []string{"a"},
+			damping: 0.5,
+			want:    map[string]float64{"a": 2. / 3, "b": 1. / 3},
+		},
+		{
+			// a splits its score 2:1 by attestations
+			name:    "weighted edges",
+			atts:    []*types.Attestation{att("h1", "b", "a"), att("h2", "b", "a"), att("h3", "c", "a")},
+			roots:   []string{"a"},
+			damping: 0.5,
+			want:    map[string]float64{"a": 2. / 3, "b": 2. / 9, "c": 1. / 9},
+		},
+		{
+			name:    "unreachable identities score nothing",
+			atts:    []*types.Attestation{att("h1", "b", "a"), att("h2", "d", "c")},
+			roots:   []string{"a", "a"},
+			damping: 0.5,
+			want:    map[string]float64{"a": 2. / 3, "b": 1. / 3},
+		},
+		{
+			name:    "roots share the restart",
+			atts:    []*types.Attestation{att("h1", "b", "a")},
+			roots:   []string{"a", "b"},
+			damping: 0.5,
+			// pA = 1/4 + pB/4, pB = 1/4 + pA/2 + pB/4
+			want: map[string]float64{"a": 0.4, "b": 0.6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			g.Replace(tt.atts)
+			got := g.PageRank(tt.roots, tt.damping)
+			sum := 0.0
+			for id, score := range got {
+				sum += score
+				if score > 1e-9 && tt.want[id] == 0 {
+					t.Errorf("%s scored %g, want 0", id, score)
+				}
+			}
+			for id, want := range tt.want {
+				if math.Abs(got[id]-want) > 1e-6 {
+					t.Errorf("%s scored %g, want %g", id, got[id], want)
+				}
+			}
+			if len(tt.want) > 0 && math.Abs(sum-1) > 1e-6 {
+				t.Errorf("scores add up to %g", sum)
+			}
+		})
+	}
+}
+
+func TestPageRankCache(t *testing.T) {
+	g := New()
+	g.Set(att("h1", "b", "a"))
+	first := g.PageRank([]string{"a"}, 0.5)
+	if again := g.PageRank([]string{"a"}, 0.5); again["b"] != first["b"] {
+		t.Fatalf("scores changed without an edit: %v, %v", first, again)
+	}
+
+	// the same claim again isn't an edit
+	g.Set(att("h1", "b", "a"))
+	g.ranksMu.Lock()
+	cached := g.ranks["a|0.5"]
+	g.ranksMu.Unlock()
+	if cached == nil || cached.version != g.version {
+		t.Errorf("cache dropped by a no-op set")
+	}
+
+	g.Set(att("h2", "c", "a"))
+	if got := g.PageRank([]string{"a"}, 0.5); got["c"] == 0 || got["b"] >= first["b"] {
+		t.Errorf("scores %v weren't recomputed after an edit", got)
+	}
+}
+
+func TestPath(t *testing.T) {
+	g := New()
+	g.Replace([]*types.Attestation{
+		att("ab", "b", "a"),
+		att("bc", "c", "b"),
+		att("cd", "d", "c"),
+		att("ed", "d", "e"),
+		att("ac", "c", "a"),
+	})
+
+	tests := []struct {
+		name     string
+		roots    []string
+		target   string
+		maxDepth int
+		score    float64
+		// path lists the attestations from the root
+		path []string
+	}{
+		{name: "root", roots: []string{"a"}, target: "a", maxDepth: 6, score: 1, path: []string{}},
+		{name: "one hop", roots: []string{"a"}, target: "b", maxDepth: 6, score: 0.5, path: []string{"ab"}},
+		{name: "shortest of two", roots: []string{"a"}, target: "c", maxDepth: 6, score: 0.5, path: []string{"ac"}},
+		{name: "two hops", roots: []string{"a"}, target: "d", maxDepth: 6, score: 0.25, path: []string{"ac", "cd"}},
+		{name: "nearest root", roots: []string{"a", "e"}, target: "d", maxDepth: 6, score: 0.5, path: []string{"ed"}},
+		{name: "beyond max depth", roots: []string{"a"}, target: "d", maxDepth: 1},
+		{name: "edges only run one way", roots: []string{"d"}, target: "a", maxDepth: 6},
+		{name: "unknown target", roots: []string{"a"}, target: "z", maxDepth: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, path := g.Path(tt.roots, tt.target, 0.5, tt.maxDepth)
+			var hashes []string
+			for i, e := range path {
+				hashes = append(hashes, e.Attestation)
+				if i > 0 && e.From != path[i-1].To {
+					t.Errorf("path breaks at %+v", e)
+				}
+			}
+			if score != tt.score || len(hashes) != len(tt.path) {
+				t.Fatalf("score %g, path %v, want %g, %v", score, hashes, tt.score, tt.path)
+			}
+			for i := range hashes {
+				if hashes[i] != tt.path[i] {
+					t.Errorf("path %v, want %v", hashes, tt.path)
+				}
+			}
+			if len(path) > 0 && path[len(path)-1].To != tt.target {
+				t.Errorf("path ends at %s", path[len(path)-1].To)
+			}
+		})
+	}
+}
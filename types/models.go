@@ -1,8 +1,11 @@
 package types
 
 import (
+	"time"
+
 	"github.com/bitcoinschema/go-aip"
 	"github.com/bitcoinschema/go-bap"
+	"github.com/bitcoinschema/go-sigma"
 )
 
 // {
@@ -24,20 +27,160 @@ type Address struct {
 	Txid      string `json:"txId" bson:"txId"`
 	Block     uint32 `json:"block" bson:"block"`
 	Timestamp uint32 `json:"-" bson:"timestamp"`
+	// Scheme is the signature scheme of the op that added the address
+	Scheme string `json:"scheme,omitempty" bson:"scheme,omitempty"`
 }
 
 type Identity struct {
-	IDKey          string      `json:"idKey" bson:"_id"`
-	FirstSeen      uint32      `json:"firstSeen" bson:"firstSeen"`
-	RootAddress    string      `json:"rootAddress" bson:"rootAddress"`
-	CurrentAddress string      `json:"currentAddress" bson:"currentAddress"`
-	Addresses      []Address   `json:"addresses" bson:"addresses"`
-	Identity       interface{} `json:"identity" bson:"-"`
+	IDKey          string     `json:"idKey" bson:"_id"`
+	FirstSeen      uint32     `json:"firstSeen" bson:"firstSeen"`
+	RootAddress    string     `json:"rootAddress" bson:"rootAddress"`
+	CurrentAddress string     `json:"currentAddress" bson:"currentAddress"`
+	Addresses      []Address  `json:"addresses" bson:"addresses"`
+	Conflicts      []Conflict `json:"conflicts,omitempty" bson:"conflicts,omitempty"`
+	// Status is the lifecycle state, StatusHistory the transitions into it
+	Status        string         `json:"status,omitempty" bson:"status,omitempty"`
+	StatusHistory []StatusChange `json:"statusHistory,omitempty" bson:"statusHistory,omitempty"`
+	// Identity is the raw profile, with large inline media replaced by
+	// blob:// references, Profile its normalized form and ProfileWarnings
+	// what normalizing it found
+	Identity        interface{} `json:"identity" bson:"-"`
+	Profile         *Profile    `json:"profile,omitempty" bson:"-"`
+	ProfileWarnings []string    `json:"profileWarnings,omitempty" bson:"-"`
+}
+
+// Profile types
+const (
+	ProfilePerson       = "Person"
+	ProfileOrganization = "Organization"
+)
+
+// Profile is an ALIAS profile normalized to the schema.org Person or
+// Organization fields BAP profiles use
+type Profile struct {
+	Type          string   `json:"@type" bson:"@type"`
+	Name          string   `json:"name,omitempty" bson:"name,omitempty"`
+	AlternateName []string `json:"alternateName,omitempty" bson:"alternateName,omitempty"`
+	GivenName     string   `json:"givenName,omitempty" bson:"givenName,omitempty"`
+	FamilyName    string   `json:"familyName,omitempty" bson:"familyName,omitempty"`
+	Description   string   `json:"description,omitempty" bson:"description,omitempty"`
+	Email         string   `json:"email,omitempty" bson:"email,omitempty"`
+	Paymail       string   `json:"paymail,omitempty" bson:"paymail,omitempty"`
+	URL           string   `json:"url,omitempty" bson:"url,omitempty"`
+	// Image, Logo and Banner are canonical content references, see resolver
+	Image        string   `json:"image,omitempty" bson:"image,omitempty"`
+	Logo         string   `json:"logo,omitempty" bson:"logo,omitempty"`
+	Banner       string   `json:"banner,omitempty" bson:"banner,omitempty"`
+	HomeLocation string   `json:"homeLocation,omitempty" bson:"homeLocation,omitempty"`
+	SameAs       []string `json:"sameAs,omitempty" bson:"sameAs,omitempty"`
+}
+
+// Blob is inline profile media too large to keep in the profile document.
+// Profiles reference it as blob://<sha256>.
+type Blob struct {
+	Hash        string `json:"hash" bson:"_id"`
+	ContentType string `json:"contentType" bson:"contentType"`
+	Size        int    `json:"size" bson:"size"`
+	Data        []byte `json:"-" bson:"data"`
+	// Block and Txid are the ALIAS that first published the blob
+	Block uint32 `json:"block" bson:"block"`
+	Txid  string `json:"txId" bson:"txId"`
+}
+
+// Identity lifecycle states, in order of precedence. An identity never moves
+// back to a lower state except through a rewind.
+const (
+	StatusActive      = "active"
+	StatusRotated     = "rotated"     // moved off its first address, still usable
+	StatusDisputed    = "disputed"    // has conflicting claims, see Conflicts
+	StatusDeactivated = "deactivated" // retired, nothing it signs afterwards is indexed
+)
+
+// StatusChange is a lifecycle transition and the tx that caused it
+type StatusChange struct {
+	Status string `json:"status" bson:"status"`
+	Reason string `json:"reason" bson:"reason"`
+	// Op and Signer are the type and signing address of the BAP op
+	Op        string `json:"op,omitempty" bson:"op,omitempty"`
+	Signer    string `json:"signer,omitempty" bson:"signer,omitempty"`
+	Txid      string `json:"txId" bson:"txId"`
+	Block     uint32 `json:"block" bson:"block"`
+	Timestamp uint32 `json:"timestamp" bson:"timestamp"`
+}
+
+// StatusAt returns the state id was in at block, or at timestamp when block
+// is 0. Identities indexed before states were tracked are active.
+func (id *Identity) StatusAt(block uint32, timestamp uint32) string {
+	if len(id.StatusHistory) == 0 {
+		if id.Status == "" {
+			return StatusActive
+		}
+		return id.Status
+	}
+
+	status := StatusActive
+	for _, change := range id.StatusHistory {
+		if (block > 0 && change.Block <= block) || (block == 0 && change.Timestamp <= timestamp) {
+			status = change.Status
+		}
+	}
+	return status
 }
 
+// Identity conflict types
+const (
+	// ConflictDuplicateClaim is an ID op for an idKey that already belongs
+	// to a different root address
+	ConflictDuplicateClaim = "duplicate-claim"
+	// ConflictSharedRoot is an address that created more than one idKey
+	ConflictSharedRoot = "shared-root"
+)
+
+// Conflict is a competing claim recorded on an identity. IDKey is the other
+// identity involved, or the identity itself for a duplicate claim, and
+// Address the address that signed the competing ID op.
+type Conflict struct {
+	Type    string `json:"type" bson:"type"`
+	IDKey   string `json:"idKey" bson:"idKey"`
+	Address string `json:"address" bson:"address"`
+	Txid    string `json:"txId" bson:"txId"`
+	Block   uint32 `json:"block" bson:"block"`
+}
+
+// Signature schemes that can authenticate a BAP op
+const (
+	SchemeAIP   = "AIP"
+	SchemeSigma = "SIGMA"
+)
+
+// BapAip is a BAP op with the signatures covering it. Signature is the one
+// the op is attributed to, set once a signature verifies.
 type BapAip struct {
-	BAP *bap.Bap
-	AIP *aip.Aip
+	BAP        *bap.Bap
+	Vout       int
+	Signatures []*Signature
+	Signature  *Signature
+}
+
+// Signature is an AIP or Sigma signature found in an output. Instance is its
+// position among the signatures of its scheme in the output. Fields are the
+// signed AIP field indexes, empty when it signs every field before it. Vin
+// is the input a Sigma signature is bound to.
+type Signature struct {
+	Scheme   string `json:"scheme"`
+	Vout     int    `json:"vout"`
+	Instance int    `json:"instance"`
+	Address  string `json:"address"`
+	Fields   []int  `json:"fields,omitempty"`
+	Vin      *int   `json:"vin,omitempty"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+	// Value and Message are the signature and the message it signs, set
+	// once the signature verifies
+	Value   []byte     `json:"-"`
+	Message []byte     `json:"-"`
+	AIP     *aip.Aip   `json:"-"`
+	Sigma   *sigma.Sig `json:"-"`
 }
 
 // {
@@ -67,7 +210,17 @@ type Signer struct {
 	Block     uint32 `json:"block" bson:"block"`
 	Txid      string `json:"txId" bson:"txId"`
 	Timestamp uint32 `json:"timestamp" bson:"timestamp"`
-	Revoked   bool   `json:"revoked" bson:"revoked"`
+	// Revoked is always false, a REVOKE removes the signer instead, see
+	// Attestation.Revocations
+	Revoked bool `json:"revoked" bson:"revoked"`
+	// Scheme, Vout and SigInstance locate the signature that covered the op
+	Scheme      string `json:"scheme,omitempty" bson:"scheme,omitempty"`
+	Vout        int    `json:"vout" bson:"vout"`
+	SigInstance int    `json:"sigInstance" bson:"sigInstance"`
+	// Signature is the signature's value and Message the message it signs:
+	// the signed fields for AIP, the input and data hash for Sigma
+	Signature []byte `json:"signature,omitempty" bson:"signature,omitempty" swaggertype:"string" format:"base64"`
+	Message   []byte `json:"message,omitempty" bson:"message,omitempty" swaggertype:"string" format:"base64"`
 }
 
 type Attestation struct {
@@ -77,4 +230,52 @@ type Attestation struct {
 	Nonce     string    `json:"nonce,omitempty" bson:"nonce,omitempty"`
 	URN       string    `json:"urn,omitempty" bson:"urn,omitempty"`
 	Signers   []*Signer `json:"signers" bson:"signers"`
+	// Revocations are the REVOKE ops that removed signers
+	Revocations []Revocation `json:"revocations,omitempty" bson:"revocations,omitempty"`
+	// Replaced are the signers ATTESTs with a higher sequence replaced, kept
+	// so a rewind can put them back
+	Replaced []ReplacedSigner `json:"-" bson:"replaced,omitempty"`
+}
+
+// ReplacedSigner is a signer and the block of the ATTEST that replaced it
+type ReplacedSigner struct {
+	Signer     *Signer `json:"signer" bson:"signer"`
+	ReplacedAt uint32  `json:"replacedAt" bson:"replacedAt"`
+}
+
+// Revocation is a REVOKE of the signatures of IDKey below Sequence
+type Revocation struct {
+	IDKey     string `json:"idKey" bson:"idKey"`
+	Address   string `json:"address" bson:"address"`
+	Txid      string `json:"txId" bson:"txId"`
+	Block     uint32 `json:"block" bson:"block"`
+	Timestamp uint32 `json:"timestamp" bson:"timestamp"`
+	Sequence  uint64 `json:"sequence" bson:"sequence"`
+	// Removed are the signers the REVOKE removed, kept so a rewind can put
+	// them back
+	Removed []*Signer `json:"-" bson:"removed,omitempty"`
+}
+
+// QuarantinedOp is a BAP op that could not be applied
+type QuarantinedOp struct {
+	// Index of the op among the tx's BAP ops, -1 when the whole tx failed
+	Index  int    `json:"index" bson:"index"`
+	Type   string `json:"type,omitempty" bson:"type,omitempty"`
+	Reason string `json:"reason" bson:"reason"`
+	// ParkedAt and ExpiredAt are the blocks an op waited for its identity
+	// between, for ops that expired from the pending buffer
+	ParkedAt  uint32 `json:"parkedAt,omitempty" bson:"parkedAt,omitempty"`
+	ExpiredAt uint32 `json:"expiredAt,omitempty" bson:"expiredAt,omitempty"`
+}
+
+// Quarantine holds a tx with ops that could not be applied, so it can be
+// inspected and reprocessed instead of crashing the indexer
+type Quarantine struct {
+	Txid          string          `json:"txId" bson:"_id"`
+	Block         uint32          `json:"block" bson:"block"`
+	Timestamp     uint32          `json:"timestamp" bson:"timestamp"`
+	RawTx         string          `json:"rawTx" bson:"rawTx"`
+	Ops           []QuarantinedOp `json:"ops" bson:"ops"`
+	Attempts      int             `json:"attempts" bson:"attempts"`
+	QuarantinedAt time.Time       `json:"quarantinedAt" bson:"quarantinedAt"`
 }
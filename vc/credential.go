@@ -0,0 +1,156 @@
+// Package vc renders BAP attestations as W3C Verifiable Credentials and
+// checks such credentials against the index.
+//
+// Each signer of an attestation issues its own credential. The identity that
+// signed the attestation first is taken as its subject, as in package trust,
+// since attestation hashes don't name one.
+package vc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// DIDPrefix starts the did:bap identifier of an identity, followed by its
+// idKey
+const DIDPrefix = "did:bap:id:"
+
+// Credential types and proof types
+const (
+	TypeCredential  = "VerifiableCredential"
+	TypeAttestation = "BapAttestation"
+	ProofAIP        = "BapAipSignature"
+	ProofSigma      = "BapSigmaSignature"
+)
+
+// ContextV1 is the W3C Verifiable Credentials data model context
+const ContextV1 = "https://www.w3.org/2018/credentials/v1"
+
+// bapContext defines the BAP terms used in credentials, inline since BAP
+// publishes no JSON-LD context of its own
+var bapContext = map[string]string{
+	"bap":             "https://github.com/icellan/bap#",
+	TypeAttestation:   "bap:Attestation",
+	ProofAIP:          "bap:AipSignature",
+	ProofSigma:        "bap:SigmaSignature",
+	"attestationHash": "bap:attestationHash",
+	"attribute":       "bap:attribute",
+	"value":           "bap:value",
+	"txid":            "bap:txid",
+	"block":           "bap:block",
+	"vout":            "bap:vout",
+	"sigInstance":     "bap:sigInstance",
+	"signingAddress":  "bap:signingAddress",
+	"sequence":        "bap:sequence",
+	"proofValue":      "https://w3id.org/security#proofValue",
+	"signedMessage":   "bap:signedMessage",
+}
+
+// Credential is a W3C Verifiable Credential for one signature of an
+// attestation
+type Credential struct {
+	Context           []interface{} `json:"@context" swaggertype:"array,object"`
+	ID                string        `json:"id" example:"urn:bap:credential:abc123def456:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"`
+	Type              []string      `json:"type" example:"VerifiableCredential,BapAttestation"`
+	Issuer            string        `json:"issuer" example:"did:bap:id:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"`
+	IssuanceDate      string        `json:"issuanceDate" example:"2019-08-05T21:26:22Z"`
+	CredentialSubject Subject       `json:"credentialSubject"`
+	Proof             Proof         `json:"proof"`
+}
+
+// Subject is what a credential attests
+type Subject struct {
+	// ID is the did:bap of the identity the attestation is about
+	ID              string `json:"id,omitempty" example:"did:bap:id:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"`
+	AttestationHash string `json:"attestationHash" example:"abc123def456"`
+	// Attribute and Value are set when the index knows them
+	Attribute string `json:"attribute,omitempty" example:"name"`
+	Value     string `json:"value,omitempty" example:"John Doe"`
+}
+
+// Proof points at the on-chain signature behind a credential and carries
+// it: ProofValue is the Bitcoin Signed Message signature of SigningAddress
+// over SignedMessage, which is the signed fields for AIP and the hash of the
+// bound input and the data for Sigma
+type Proof struct {
+	Type               string `json:"type" example:"BapAipSignature"`
+	Created            string `json:"created" example:"2019-08-05T21:26:22Z"`
+	ProofPurpose       string `json:"proofPurpose" example:"assertionMethod"`
+	VerificationMethod string `json:"verificationMethod" example:"did:bap:id:3QxhyGy6ZE5SUpzXVb6AwnXYwH8g#1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"`
+	Txid               string `json:"txid" example:"ee7c1c6b9a2b8a2de8b7d3e6e1f0d5c4b3a29180f7e6d5c4b3a2918070605040"`
+	Block              uint32 `json:"block" example:"594320"`
+	Vout               int    `json:"vout" example:"0"`
+	SigInstance        int    `json:"sigInstance" example:"0"`
+	SigningAddress     string `json:"signingAddress" example:"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"`
+	Sequence           uint64 `json:"sequence" example:"0"`
+	// ProofValue and SignedMessage are unset for signatures indexed before
+	// they were stored
+	ProofValue    []byte `json:"proofValue,omitempty" swaggertype:"string" format:"base64" example:"ILrHdsFAsV3r/+P0JqCjDBy2RIxrc94NMlcpvzu7oPKaB5jSMsEM18WRYvPtcJNvVh5AWESIVk4j1lyAxFd0Sd4="`
+	SignedMessage []byte `json:"signedMessage,omitempty" swaggertype:"string" format:"base64" example:"ajFCQVBTdWFQbmZHblNCTTNHTFY5eWh4VWRZZTR2R2JkTVRBVFRFU1Q2Mzg2YWZhMjIzZTU0ZDRmOTU1ZTQ0YTFlZjRhZTViMThiYmI4Njg5ZGZmMDc4NjI3YTdjYjg0MmZhZDRmN2M2MHw="`
+}
+
+// DID returns the did:bap identifier of idKey
+func DID(idKey string) string {
+	return DIDPrefix + idKey
+}
+
+// IDKey returns the idKey of a did:bap identifier
+func IDKey(did string) (string, bool) {
+	idKey, ok := strings.CutPrefix(did, DIDPrefix)
+	return idKey, ok && idKey != ""
+}
+
+// FromAttestation renders a credential for every signer of att. A REVOKE
+// removes the signature from att.Signers, so revoked ones have none. now
+// stands in for the block time of unconfirmed signatures.
+func FromAttestation(att *types.Attestation, now time.Time) []Credential {
+	subject := Subject{AttestationHash: att.Id, Attribute: att.Attribute, Value: att.Value}
+	if len(att.Signers) > 0 {
+		subject.ID = DID(att.Signers[0].IDKey)
+	}
+
+	creds := []Credential{}
+	for _, s := range att.Signers {
+		issued := now
+		if s.Timestamp > 0 {
+			issued = time.Unix(int64(s.Timestamp), 0)
+		}
+		date := issued.UTC().Format(time.RFC3339)
+
+		creds = append(creds, Credential{
+			Context:           []interface{}{ContextV1, bapContext},
+			ID:                fmt.Sprintf("urn:bap:credential:%s:%s", att.Id, s.IDKey),
+			Type:              []string{TypeCredential, TypeAttestation},
+			Issuer:            DID(s.IDKey),
+			IssuanceDate:      date,
+			CredentialSubject: subject,
+			Proof: Proof{
+				Type:               proofType(s.Scheme),
+				Created:            date,
+				ProofPurpose:       "assertionMethod",
+				VerificationMethod: DID(s.IDKey) + "#" + s.Address,
+				Txid:               s.Txid,
+				Block:              s.Block,
+				Vout:               s.Vout,
+				SigInstance:        s.SigInstance,
+				SigningAddress:     s.Address,
+				Sequence:           s.Sequence,
+				ProofValue:         s.Signature,
+				SignedMessage:      s.Message,
+			},
+		})
+	}
+	return creds
+}
+
+// proofType is the proof type of a signing scheme. Signers indexed before
+// the scheme was recorded were signed with AIP.
+func proofType(scheme string) string {
+	if scheme == types.SchemeSigma {
+		return ProofSigma
+	}
+	return ProofAIP
+}
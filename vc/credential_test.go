@@ -0,0 +1,97 @@
+package vc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// A mainnet ATTEST signed with AIP, with the signature and the message it
+// signs as the crawler stores them
+const (
+	testIDKey   = "3QxhyGy6ZE5SUpzXVb6AwnXYwH8g"
+	testAddress = "134a6TXxzgQ9Az3w8BcvgdZyA5UqRL89da"
+	testHash    = "6386afa223e54d4f955e44a1ef4ae5b18bbb8689dff078627a7cb842fad4f7c6"
+	testTxid    = "98a5f6ef18eaea188bdfdc048f89a48af82627a15a76fd53584975f28ab3cc39"
+	testSig     = "ILrHdsFAsV3r/+P0JqCjDBy2RIxrc94NMlcpvzu7oPKaB5jSMsEM18WRYvPtcJNvVh5AWESIVk4j1lyAxFd0Sd4="
+	testMessage = "j1BAPSuaPnfGnSBM3GLV9yhxUdYe4vGbdMTATTEST" + testHash + "0|"
+)
+
+// testAttestation is the mainnet attestation, signed by the test identity
+// and by a second one that revoked its signature
+func testAttestation(t *testing.T) *types.Attestation {
+	t.Helper()
+	sig, err := base64.StdEncoding.DecodeString(testSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.Attestation{
+		Id:        testHash,
+		Attribute: "name",
+		Value:     "John Doe",
+		Signers: []*types.Signer{
+			{
+				IDKey:     testIDKey,
+				Address:   testAddress,
+				Txid:      testTxid,
+				Block:     590230,
+				Timestamp: 1565040000,
+				Scheme:    types.SchemeAIP,
+				Signature: sig,
+				Message:   []byte(testMessage),
+			},
+		},
+		Revocations: []types.Revocation{{
+			IDKey:   "revoked",
+			Address: "1Revoked",
+			Block:   590400,
+			Removed: []*types.Signer{{IDKey: "revoked", Address: "1Revoked", Block: 590300}},
+		}},
+	}
+}
+
+func TestFromAttestation(t *testing.T) {
+	att := testAttestation(t)
+	now := time.Unix(1700000000, 0)
+
+	creds := FromAttestation(att, now)
+	if len(creds) != 1 {
+		t.Fatalf("got %d credentials, want one for the signer that didn't revoke", len(creds))
+	}
+	c := creds[0]
+	if c.Issuer != DID(testIDKey) || c.CredentialSubject.ID != DID(testIDKey) || c.CredentialSubject.AttestationHash != testHash {
+		t.Errorf("issuer %s, subject %+v", c.Issuer, c.CredentialSubject)
+	}
+	if c.IssuanceDate != "2019-08-05T21:20:00Z" || c.Proof.Created != c.IssuanceDate {
+		t.Errorf("issued %s, proof created %s, want the block time", c.IssuanceDate, c.Proof.Created)
+	}
+	if c.Proof.Type != ProofAIP || c.Proof.Txid != testTxid || c.Proof.SigningAddress != testAddress {
+		t.Errorf("proof %+v", c.Proof)
+	}
+
+	// the signature travels as base64, the way a verifier gets it back
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields struct {
+		Proof struct {
+			ProofValue    string `json:"proofValue"`
+			SignedMessage string `json:"signedMessage"`
+		} `json:"proof"`
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields.Proof.ProofValue != testSig || fields.Proof.SignedMessage != base64.StdEncoding.EncodeToString([]byte(testMessage)) {
+		t.Errorf("proof value %q over %q", fields.Proof.ProofValue, fields.Proof.SignedMessage)
+	}
+
+	att.Signers[0].Timestamp = 0
+	if date := FromAttestation(att, now)[0].IssuanceDate; date != "2023-11-14T22:13:20Z" {
+		t.Errorf("unconfirmed signature issued %s, want now", date)
+	}
+}
@@ -0,0 +1,134 @@
+package vc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+	bsm "github.com/bitcoin-sv/go-sdk/compat/bsm"
+)
+
+// Source is where verification reads the index from
+type Source interface {
+	// Identity returns the identity with idKey, or nil when there is none
+	Identity(ctx context.Context, idKey string) (*types.Identity, error)
+	// Attestation returns the attestation with hash, or nil when there is none
+	Attestation(ctx context.Context, hash string) (*types.Attestation, error)
+	// Validity reports whether id is valid now, and why not
+	Validity(id *types.Identity) (bool, string)
+}
+
+// Verification is the outcome of checking a credential against the index
+type Verification struct {
+	Valid  bool    `json:"valid" example:"true"`
+	Checks []Check `json:"checks"`
+}
+
+// Check is one step of a verification
+type Check struct {
+	Name    string `json:"name" example:"signature"`
+	OK      bool   `json:"ok" example:"true"`
+	Message string `json:"message,omitempty" example:"no signature by the issuer on the attestation"`
+}
+
+// Verify checks c against the index: the attestation and the issuer's
+// signature on it must be indexed as the credential describes, the proof
+// value must be the signing address's signature of the signed message, the
+// issuer must be valid now, and the signing address must have been the
+// issuer's address when it signed. Checks stop at the first one the rest
+// depend on.
+func Verify(ctx context.Context, src Source, c *Credential) (*Verification, error) {
+	v := &Verification{Checks: []Check{}}
+	check := func(name string, ok bool, format string, args ...interface{}) bool {
+		chk := Check{Name: name, OK: ok}
+		if !ok {
+			chk.Message = fmt.Sprintf(format, args...)
+		}
+		v.Checks = append(v.Checks, chk)
+		return ok
+	}
+	done := func() (*Verification, error) {
+		v.Valid = !slices.ContainsFunc(v.Checks, func(chk Check) bool { return !chk.OK })
+		return v, nil
+	}
+
+	if !check("format", slices.Contains(c.Context, interface{}(ContextV1)) && slices.Contains(c.Type, TypeCredential) && slices.Contains(c.Type, TypeAttestation),
+		"not a %s with @context %s and type %s", TypeCredential, ContextV1, TypeAttestation) {
+		return done()
+	}
+	idKey, ok := IDKey(c.Issuer)
+	if !check("issuer", ok, "issuer %q is not a %s identifier", c.Issuer, DIDPrefix) {
+		return done()
+	}
+
+	att, err := src.Attestation(ctx, c.CredentialSubject.AttestationHash)
+	if err != nil {
+		return nil, err
+	}
+	if !check("attestation", att != nil, "attestation %s is not indexed", c.CredentialSubject.AttestationHash) {
+		return done()
+	}
+
+	var signer *types.Signer
+	for _, s := range att.Signers {
+		if s.IDKey == idKey {
+			signer = s
+		}
+	}
+	missing := fmt.Sprintf("no signature by %s on the attestation", idKey)
+	for _, r := range att.Revocations {
+		if r.IDKey == idKey {
+			missing = fmt.Sprintf("the signature by %s was revoked at block %d", idKey, r.Block)
+		}
+	}
+	if !check("signature", signer != nil, "%s", missing) {
+		return done()
+	}
+	p := c.Proof
+	check("proof", p.Type == proofType(signer.Scheme) && p.Txid == signer.Txid && p.Block == signer.Block && p.Vout == signer.Vout &&
+		p.SigInstance == signer.SigInstance && p.SigningAddress == signer.Address && p.Sequence == signer.Sequence &&
+		bytes.Equal(p.ProofValue, signer.Signature) && bytes.Equal(p.SignedMessage, signer.Message),
+		"proof doesn't match the indexed signature: %s in %s at block %d, output %d, instance %d, by %s, sequence %d",
+		proofType(signer.Scheme), signer.Txid, signer.Block, signer.Vout, signer.SigInstance, signer.Address, signer.Sequence)
+	if len(p.ProofValue) == 0 {
+		check("proof-value", false, "proof has no signature value")
+	} else {
+		check("proof-value", bsm.VerifyMessage(p.SigningAddress, p.ProofValue, p.SignedMessage) == nil,
+			"proof value is not a signature of the signed message by %s", p.SigningAddress)
+	}
+
+	s := c.CredentialSubject
+	subjectOK := (att.Attribute == "" || s.Attribute == att.Attribute) && (att.Value == "" || s.Value == att.Value) &&
+		(s.ID == "" || len(att.Signers) > 0 && s.ID == DID(att.Signers[0].IDKey))
+	check("subject", subjectOK, "credential subject doesn't match the indexed attestation")
+
+	issuer, err := src.Identity(ctx, idKey)
+	if err != nil {
+		return nil, err
+	}
+	if !check("issuer-identity", issuer != nil, "issuer identity %s is not indexed", idKey) {
+		return done()
+	}
+	valid, reason := src.Validity(issuer)
+	check("issuer-validity", valid, "issuer %s", reason)
+	check("signing-key", addressAt(issuer, signer.Block) == signer.Address,
+		"%s was not the issuer's address at block %d", signer.Address, signer.Block)
+	return done()
+}
+
+// addressAt returns the address id signed with at block, its current
+// address for unconfirmed signatures
+func addressAt(id *types.Identity, block uint32) string {
+	if block == 0 {
+		return id.CurrentAddress
+	}
+	address := ""
+	for _, a := range id.Addresses {
+		if a.Block > 0 && a.Block <= block {
+			address = a.Address
+		}
+	}
+	return address
+}
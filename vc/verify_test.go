@@ -0,0 +1,160 @@
+package vc
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/BitcoinSchema/go-bap-indexer/types"
+)
+
+// testSource is an index holding one attestation and its signers' identities
+type testSource struct {
+	att *types.Attestation
+	ids map[string]*types.Identity
+}
+
+func (s testSource) Identity(ctx context.Context, idKey string) (*types.Identity, error) {
+	return s.ids[idKey], nil
+}
+
+func (s testSource) Attestation(ctx context.Context, hash string) (*types.Attestation, error) {
+	if s.att == nil || s.att.Id != hash {
+		return nil, nil
+	}
+	return s.att, nil
+}
+
+func (s testSource) Validity(id *types.Identity) (bool, string) {
+	if id.Status == types.StatusDeactivated {
+		return false, "identity is deactivated"
+	}
+	return true, ""
+}
+
+func TestVerify(t *testing.T) {
+	identity := func() *types.Identity {
+		return &types.Identity{
+			IDKey:          testIDKey,
+			CurrentAddress: testAddress,
+			Addresses:      []types.Address{{Address: testAddress, Block: 590000}},
+		}
+	}
+
+	tests := []struct {
+		name string
+		// change alters the credential, the index or both
+		change func(c *Credential, src *testSource)
+		// failed are the checks that fail, nil for a valid credential
+		failed []string
+	}{
+		{
+			name:   "valid",
+			change: func(c *Credential, src *testSource) {},
+		},
+		{
+			name:   "proof value changed",
+			change: func(c *Credential, src *testSource) { c.Proof.ProofValue[10] ^= 1 },
+			failed: []string{"proof", "proof-value"},
+		},
+		{
+			name: "signed message changed",
+			change: func(c *Credential, src *testSource) {
+				c.Proof.SignedMessage = []byte("j1BAPSuaPnfGnSBM3GLV9yhxUdYe4vGbdMTATTEST" + testHash + "1|")
+			},
+			failed: []string{"proof", "proof-value"},
+		},
+		{
+			// a valid signature, but not the one the index holds
+			name: "proof value and message from another signature",
+			change: func(c *Credential, src *testSource) {
+				src.att.Signers[0].Signature = []byte("another signature")
+			},
+			failed: []string{"proof"},
+		},
+		{
+			name: "signature indexed without its value",
+			change: func(c *Credential, src *testSource) {
+				c.Proof.ProofValue, c.Proof.SignedMessage = nil, nil
+				src.att.Signers[0].Signature, src.att.Signers[0].Message = nil, nil
+			},
+			failed: []string{"proof-value"},
+		},
+		{
+			name:   "proof names another txid",
+			change: func(c *Credential, src *testSource) { c.Proof.Txid = testHash },
+			failed: []string{"proof"},
+		},
+		{
+			name:   "subject value changed",
+			change: func(c *Credential, src *testSource) { c.CredentialSubject.Value = "Jane Doe" },
+			failed: []string{"subject"},
+		},
+		{
+			name:   "attestation not indexed",
+			change: func(c *Credential, src *testSource) { src.att = nil },
+			failed: []string{"attestation"},
+		},
+		{
+			name: "signature revoked",
+			change: func(c *Credential, src *testSource) {
+				src.att.Revocations = append(src.att.Revocations, types.Revocation{IDKey: testIDKey, Block: 590500, Removed: src.att.Signers[:1]})
+				src.att.Signers = src.att.Signers[1:]
+			},
+			failed: []string{"signature"},
+		},
+		{
+			name:   "issuer deactivated",
+			change: func(c *Credential, src *testSource) { src.ids[testIDKey].Status = types.StatusDeactivated },
+			failed: []string{"issuer-validity"},
+		},
+		{
+			name: "address not the issuer's when it signed",
+			change: func(c *Credential, src *testSource) {
+				src.ids[testIDKey].Addresses[0].Block = 600000
+			},
+			failed: []string{"signing-key"},
+		},
+		{
+			name:   "not a did:bap issuer",
+			change: func(c *Credential, src *testSource) { c.Issuer = "did:web:example.com" },
+			failed: []string{"issuer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &testSource{att: testAttestation(t), ids: map[string]*types.Identity{testIDKey: identity()}}
+
+			// verified as it comes back from the client
+			b, err := json.Marshal(FromAttestation(src.att, time.Time{})[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Credential{}
+			if err := json.Unmarshal(b, c); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(c, src)
+
+			v, err := Verify(context.Background(), src, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var failed []string
+			for _, chk := range v.Checks {
+				if !chk.OK {
+					failed = append(failed, chk.Name)
+					if chk.Message == "" {
+						t.Errorf("check %s failed without a message", chk.Name)
+					}
+				}
+			}
+			if !slices.Equal(failed, tt.failed) || v.Valid != (tt.failed == nil) {
+				t.Errorf("valid %v, failed %v, want %v", v.Valid, failed, tt.failed)
+			}
+		})
+	}
+}